@@ -6,12 +6,19 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
+	"time"
 )
 
 var File struct {
 	EmailTmplDir string
 }
 
+var Settings struct {
+	EmailConfirmGrace time.Duration //сколько новая организация может входить без подтверждения email
+	TrustedProxies    []string      //прокси (ip или cidr), которым разрешено передавать ip клиента в X-Forwarded-For
+}
+
 var Env struct {
 	ServerName string
 
@@ -72,6 +79,27 @@ func loadJSON(configFilePath string) {
 	{
 		File.EmailTmplDir = getField("email_tmpl_dir")
 	}
+
+	//optional fields
+	{
+		Settings.EmailConfirmGrace = time.Hour * 72
+		if d, ok := data["email_confirm_grace"]; ok {
+			grace, err := time.ParseDuration(d)
+			if err != nil {
+				panic(fmt.Sprintf("email_confirm_grace: %s", err))
+			}
+			Settings.EmailConfirmGrace = grace
+		}
+
+		//по умолчанию прокси не доверяем: ip клиента - адрес соединения
+		if d, ok := data["trusted_proxies"]; ok {
+			for _, proxy := range strings.Split(d, ",") {
+				if proxy = strings.TrimSpace(proxy); proxy != "" {
+					Settings.TrustedProxies = append(Settings.TrustedProxies, proxy)
+				}
+			}
+		}
+	}
 }
 
 func loadEnv() {
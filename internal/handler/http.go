@@ -7,6 +7,7 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/iivkis/pos.7-era.backend/docs"
+	"github.com/iivkis/pos.7-era.backend/internal/config"
 	"github.com/iivkis/pos.7-era.backend/internal/myservice"
 
 	swaggerfiles "github.com/swaggo/files"
@@ -24,6 +25,9 @@ func NewHttpHandler(service myservice.MyService) HttpHandler {
 	//create engine
 	engine := gin.Default()
 
+	//X-Forwarded-For принимается только от своих прокси, иначе клиент мог бы подменить ip (ограничения входа считаются по ip)
+	engine.TrustedProxies = config.Settings.TrustedProxies
+
 	//set up recovery and logger
 	engine.Use(gin.Recovery())
 
@@ -32,7 +36,8 @@ func NewHttpHandler(service myservice.MyService) HttpHandler {
 		AllowAllOrigins:  true,
 		AllowCredentials: true,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", "Idempotency-Key"},
+		ExposeHeaders:    []string{"X-Total-Count", "Idempotent-Replayed"},
 		MaxAge:           12 * time.Hour,
 	}))
 
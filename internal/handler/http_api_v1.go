@@ -24,9 +24,26 @@ func (h *HttpHandler) connectApiV1(r *gin.RouterGroup) {
 		r.POST("/auth/signIn.Org", h.srv.Authorization.SignInOrg)
 		r.POST("/auth/signIn.Employee", h.srv.Mware.AuthOrg(), h.srv.Authorization.SignInEmployee)
 
+		//обновление токена и выход (отзыв сессий)
+		r.POST("/auth/refresh", h.srv.Authorization.Refresh)
+		r.POST("/auth/signOut.Org", h.srv.Mware.AuthOrg(), h.srv.Authorization.SignOutOrg)
+		r.POST("/auth/signOut.Org.All", h.srv.Mware.AuthOrg(), h.srv.Authorization.SignOutOrgAll)
+		r.POST("/auth/signOut.Employee", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.Authorization.SignOutEmployee)
+		r.POST("/auth/signOut.Employee.All", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.Authorization.SignOutEmployeeAll)
+
+		//журнал неудачных попыток входа
+		r.GET("/auth/signInAttempts", h.srv.Mware.AuthEmployee(r_owner, r_director), h.srv.SignInAttempts.GetAll)
+
 		//отправка код подтверждения на email и проверка
 		r.GET("/auth/sendCode", h.srv.Mware.AuthOrg(), h.srv.Authorization.SendCode)
 		r.GET("/auth/confirmCode", h.srv.Authorization.ConfirmCode)
+
+		//смена email организации (вступает в силу после подтверждения нового адреса)
+		r.POST("/auth/changeEmail", h.srv.Mware.AuthEmployee(r_owner), h.srv.Authorization.ChangeEmail)
+
+		//сброс пароля организации по коду из письма
+		r.POST("/auth/resetPassword.Request", h.srv.Authorization.ResetPasswordRequest)
+		r.POST("/auth/resetPassword.Confirm", h.srv.Authorization.ResetPasswordConfirm)
 	}
 
 	//api для сотрудников
@@ -36,21 +53,29 @@ func (h *HttpHandler) connectApiV1(r *gin.RouterGroup) {
 		r.DELETE("/employees/:id", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Employees.Delete)
 	}
 
+	//настройки организации
+	{
+		r.GET("/organization", h.srv.Mware.AuthEmployee(r_owner, r_director), h.srv.Organizations.Get)
+		r.PUT("/organization", h.srv.Mware.AuthEmployee(r_owner), h.srv.Organizations.UpdateFields)
+	}
+
 	//api для торговых точек
 	{
 		r.GET("/outlets", h.srv.Mware.AuthOrg(), h.srv.Outlets.GetAllForOrg)
-		r.POST("/outlets", h.srv.Mware.AuthEmployee(r_owner, r_director), h.srv.Outlets.Create)
+		r.POST("/outlets", h.srv.Mware.AuthEmployee(r_owner, r_director), h.srv.Mware.EmailConfirmed(), h.srv.Outlets.Create)
 		r.PUT("/outlets/:id", h.srv.Mware.AuthEmployee(r_owner, r_director), h.srv.Outlets.UpdateFields)
 		r.DELETE("/outlets/:id", h.srv.Mware.AuthEmployee(r_owner, r_director), h.srv.Outlets.Delete)
 	}
 
 	//api для сессий
 	{
-		r.POST("/sessions", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.Sessions.OpenOrClose)
+		r.POST("/sessions", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.Mware.Idempotency(), h.srv.Sessions.OpenOrClose)
 		r.GET("/sessions", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Sessions.GetAll)
 		r.GET("/sessions.Last", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.Sessions.GetLastForOutlet)
 		r.GET("/sessions.Last.Me", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.Sessions.GetLastForMe)
 		r.GET("/sessions.Last.Closed", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.Sessions.GetLastClosedForOutlet)
+		r.GET("/sessions/:id/report", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.Sessions.GetReport)
+		r.GET("/sessions.XReport", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.Sessions.GetXReport)
 	}
 
 	//api для категорий
@@ -64,6 +89,7 @@ func (h *HttpHandler) connectApiV1(r *gin.RouterGroup) {
 	//api для продуктов
 	{
 		r.GET("/products", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.Products.GetAll)
+		r.GET("/products.Cost", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Products.GetCost)
 		r.GET("/products/:id", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, repository.R_CASHIER), h.srv.Products.GetOne)
 		r.POST("/products", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Products.Create)
 		r.PUT("/products/:id", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Products.UpdateFields)
@@ -74,17 +100,46 @@ func (h *HttpHandler) connectApiV1(r *gin.RouterGroup) {
 	{
 		r.POST("/ingredients", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Ingredients.Create)
 		r.GET("/ingredients", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.Ingredients.GetAll)
+		r.GET("/ingredients.LowStock", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.Ingredients.GetLowStock)
+		r.GET("/ingredients.Units", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.Ingredients.GetUnits)
 		r.PUT("/ingredients/:id", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Ingredients.UpdateFields)
 		r.DELETE("/ingredients/:id", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Ingredients.Delete)
 
 		//поступление ингредиентов
-		r.POST("/ingredients.Arrival", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Ingredients.Arrival)
+		r.POST("/ingredients.Arrival", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Mware.Idempotency(), h.srv.Ingredients.Arrival)
+
+		//списание ингредиентов
+		r.POST("/ingredients.WriteOff", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Mware.Idempotency(), h.srv.Ingredients.WriteOff)
+
+		//журнал движения остатков
+		r.GET("/ingredients.Movements", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.StockMovements.GetAll)
+		r.GET("/ingredients.Balance", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.StockMovements.Balance)
+		r.GET("/ingredients.Prices", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.IngredientPrices.GetAll)
 
 		//история добавления ингредиентов
 		r.POST("/ingredients.History", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.IngredientsAddingHistory.Create)
 		r.GET("/ingredients.History", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.IngredientsAddingHistory.GetAll)
 	}
 
+	//поставщики
+	{
+		r.GET("/suppliers", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Suppliers.GetAll)
+		r.POST("/suppliers", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Suppliers.Create)
+		r.PUT("/suppliers/:id", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Suppliers.UpdateFields)
+		r.DELETE("/suppliers/:id", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Suppliers.Delete)
+	}
+
+	//заказы поставщикам
+	{
+		r.GET("/purchaseOrders", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.PurchaseOrders.GetAll)
+		r.GET("/purchaseOrders/:id", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.PurchaseOrders.GetOne)
+		r.POST("/purchaseOrders", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Mware.Idempotency(), h.srv.PurchaseOrders.Create)
+		r.PUT("/purchaseOrders/:id", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.PurchaseOrders.UpdateFields)
+		r.POST("/purchaseOrders/:id/send", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.PurchaseOrders.Send)
+		r.POST("/purchaseOrders/:id/cancel", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.PurchaseOrders.Cancel)
+		r.POST("/purchaseOrders/:id/receive", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Mware.Idempotency(), h.srv.PurchaseOrders.Receive)
+	}
+
 	//products with ingredients
 	{
 		r.GET("/pwis", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.ProductsWithIngredients.GetAll)
@@ -93,32 +148,70 @@ func (h *HttpHandler) connectApiV1(r *gin.RouterGroup) {
 		r.DELETE("/pwis/:id", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.ProductsWithIngredients.Delete)
 	}
 
+	//bundle products
+	{
+		r.GET("/bundleComponents", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.Bundles.GetAll)
+		r.POST("/bundleComponents", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Bundles.Create)
+		r.PUT("/bundleComponents/:id", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Bundles.UpdateFields)
+		r.DELETE("/bundleComponents/:id", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Bundles.Delete)
+	}
+
+	//product modifiers
+	{
+		r.GET("/modifierGroups", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.Modifiers.GetAllGroups)
+		r.POST("/modifierGroups", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Modifiers.CreateGroup)
+		r.PUT("/modifierGroups/:id", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Modifiers.UpdateGroup)
+		r.DELETE("/modifierGroups/:id", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Modifiers.DeleteGroup)
+
+		r.POST("/modifierOptions", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Modifiers.CreateOption)
+		r.PUT("/modifierOptions/:id", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Modifiers.UpdateOption)
+		r.DELETE("/modifierOptions/:id", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Modifiers.DeleteOption)
+	}
+
 	//order info
 	{
 		r.GET("/orderInfo", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.OrdersInfo.GetAll)
-		r.POST("/orderInfo", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.OrdersInfo.Create)
+		r.POST("/orderInfo", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.Mware.Idempotency(), h.srv.OrdersInfo.Create)
+		r.POST("/orderInfo.Checkout", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.Mware.Idempotency(), h.srv.OrdersInfo.Checkout)
 		r.DELETE("/orderInfo/:id", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.OrdersInfo.Delete)
 		r.POST("/orderInfo/:id", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.OrdersInfo.Recovery)
+		r.GET("/orderInfo/:id/payments", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.OrderPayments.GetAll)
+		r.POST("/orderInfo/:id/payments", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.Mware.Idempotency(), h.srv.OrderPayments.Set)
 	}
 
 	//order list
 	{
 		r.GET("/orderList", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.OrdersList.GetAll)
 		r.GET("/orderList.Calc", h.srv.Mware.AuthEmployee(r_owner, r_director), h.srv.OrdersList.Calc)
-		r.POST("/orderList", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.OrdersList.Create)
+		r.POST("/orderList", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.Mware.Idempotency(), h.srv.OrdersList.Create)
+	}
+
+	//analytics
+	{
+		r.GET("/analytics.Sales", h.srv.Mware.AuthEmployee(r_owner, r_director), h.srv.Analytics.Sales)
 	}
 
 	//cash changes
 	{
 		r.GET("cashChanges", h.srv.Mware.AuthEmployee(r_owner, r_director), h.srv.CashChages.GetAll)
 		r.GET("cashChanges.CurrentSession", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.CashChages.GetAllForCurrentSession)
-		r.POST("cashChanges", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.CashChages.Create)
+		r.POST("cashChanges", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.Mware.Idempotency(), h.srv.CashChages.Create)
+	}
+
+	//синхронизация событий, созданных кассой в офлайне
+	{
+		r.POST("/sync", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.Sync.Apply)
 	}
 
 	//invetoryHistory
 	{
 		r.GET("/inventoryHistory", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.InventoryHistory.GetAll)
 		r.POST("/inventoryHistory", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.InventoryHistory.Create)
+		r.POST("/inventoryHistory.Open", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.InventoryHistory.Open)
+		r.POST("/inventoryHistory/:id/counts", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin, r_cashier), h.srv.InventoryHistory.SubmitCounts)
+		r.GET("/inventoryHistory/:id/variances", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.InventoryHistory.GetVariances)
+		r.POST("/inventoryHistory/:id/commit", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.Mware.Idempotency(), h.srv.InventoryHistory.Commit)
+		r.POST("/inventoryHistory/:id/cancel", h.srv.Mware.AuthEmployee(r_owner, r_director, r_admin), h.srv.InventoryHistory.Cancel)
 	}
 
 	//inventoryList
@@ -129,7 +222,7 @@ func (h *HttpHandler) connectApiV1(r *gin.RouterGroup) {
 
 	//invites
 	{
-		r.POST("/invites", h.srv.Mware.AuthEmployee(r_owner, r_director), h.srv.Invitation.Create)
+		r.POST("/invites", h.srv.Mware.AuthEmployee(r_owner, r_director), h.srv.Mware.EmailConfirmed(), h.srv.Invitation.Create)
 		r.GET("/invites", h.srv.Mware.AuthEmployee(r_owner, r_director), h.srv.Invitation.GetAll)
 		r.GET("/invites.NotActivated", h.srv.Mware.AuthEmployee(r_owner, r_director), h.srv.Invitation.GetNotActivated)
 		r.GET("/invites.Activated", h.srv.Mware.AuthEmployee(r_owner, r_director), h.srv.Invitation.GetActivated)
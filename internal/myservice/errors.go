@@ -21,8 +21,9 @@ func init() {
 }
 
 type serviceError struct {
-	Code  uint16 `json:"code"`
-	Error string `json:"error"`
+	Code    uint16      `json:"code"`
+	Error   string      `json:"error"`
+	Details interface{} `json:"details,omitempty"` // подробности ошибки (например, нехватка ингредиентов)
 }
 
 func newServiceError(code uint16, err string) func(...string) *serviceError {
@@ -59,6 +60,7 @@ var (
 	errIncorrectInputData   = newServiceError(103, "incorrect input data")
 	errIncorrectConfirmCode = newServiceError(104, "incorrect confirm code")
 	errUploadFile           = newServiceError(105, "upload file error")
+	errPriceMismatch        = newServiceError(106, "product price mismatch")
 )
 
 // 200-299 - ошибки связанные с базой данных
@@ -69,6 +71,9 @@ var (
 	errIncorrectPassword   = newServiceError(204, "invalid password")
 	errRecordAlreadyExists = newServiceError(206, "the record already exists")
 	errForeignKey          = newServiceError(207, "foreign key error")
+	errIdempotencyConflict = newServiceError(208, "idempotency key conflict")
+	errStockConflict       = newServiceError(209, "ingredient stock conflict")
+	errStockShortfall      = newServiceError(210, "not enough ingredients in stock")
 )
 
 //300-399 - ошибки связанные с токеном и доступом
@@ -76,4 +81,8 @@ var (
 	errParsingJWT        = newServiceError(300, "jwt token parsing error")
 	errUndefinedJWT      = newServiceError(301, "jwt token undefined in header `Authorization`")
 	errPermissionDenided = newServiceError(303, "permission denided")
+	errTokenRevoked      = newServiceError(304, "token revoked or expired")
+	errTooManyAttempts   = newServiceError(305, "too many sign in attempts, try again later")
+	errEmailNotConfirmed = newServiceError(306, "email is not confirmed")
+	errTooManyRequests   = newServiceError(307, "too many requests, try again later")
 )
@@ -0,0 +1,146 @@
+package myservice
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iivkis/pos.7-era.backend/internal/repository"
+)
+
+type AnalyticsService struct {
+	repo *repository.Repository
+}
+
+func newAnalyticsService(repo *repository.Repository) *AnalyticsService {
+	return &AnalyticsService{
+		repo: repo,
+	}
+}
+
+type AnalyticsSalesInput struct {
+	GroupBy  string `form:"group_by" binding:"required,oneof=day week month hour product category employee outlet"`
+	Start    int64  `form:"start"`                                //unixmilli
+	End      int64  `form:"end"`                                  //unixmilli
+	TZOffset int    `form:"tz_offset" binding:"min=-840,max=840"` //смещение часового пояса в минутах (для day, week, month, hour)
+
+	ProductID  uint `form:"product_id"`
+	CategoryID uint `form:"category_id"`
+	EmployeeID uint `form:"employee_id"`
+
+	Components bool `form:"components"` //учитывать проданные комплекты по их компонентам
+}
+
+type AnalyticsSalesOutputModel struct {
+	Key          string  `json:"key"`  //день (2006-01-02), неделя (2006-W01), месяц (2006-01), час (00-23) или id
+	Name         string  `json:"name"` //название продукта, категории, точки или имя сотрудника
+	Revenue      float64 `json:"revenue"`
+	Cost         float64 `json:"cost"`         //себестоимость проданного
+	GrossProfit  float64 `json:"gross_profit"` //revenue - cost
+	Margin       float64 `json:"margin"`       //валовая маржа в процентах от выручки
+	Quantity     int     `json:"quantity"`
+	Receipts     int     `json:"receipts"`
+	AverageCheck float64 `json:"average_check"`
+}
+
+type AnalyticsSalesOutput struct {
+	GroupBy string                      `json:"group_by"`
+	Total   AnalyticsSalesOutputModel   `json:"total"`
+	Items   []AnalyticsSalesOutputModel `json:"items"`
+}
+
+func newAnalyticsSalesOutputModel(row *repository.SalesRow) AnalyticsSalesOutputModel {
+	model := AnalyticsSalesOutputModel{
+		Key:      row.GroupKey,
+		Name:     row.GroupName,
+		Revenue:  row.Revenue,
+		Cost:     row.Cost,
+		Quantity: row.Quantity,
+		Receipts: row.Receipts,
+	}
+
+	model.GrossProfit = model.Revenue - model.Cost
+	if model.Revenue != 0 {
+		model.Margin = model.GrossProfit / model.Revenue * 100
+	}
+
+	if model.Name == "" {
+		model.Name = model.Key
+	}
+
+	if model.Receipts != 0 {
+		model.AverageCheck = model.Revenue / float64(model.Receipts)
+	}
+	return model
+}
+
+//@Summary Аналитика продаж
+//@Description Выручка, себестоимость, валовая прибыль и маржа, кол-во проданных позиций, кол-во чеков и средний чек за период (по дате заказа).
+//@Description Себестоимость берется из снимка на момент продажи (`cost_price` позиции).
+//@Description `group_by` - группировка: day, week, month, hour (час дня), product, category, employee, outlet.
+//@Description С `components` проданные комплекты раскладываются на компоненты: выручка комплекта делится между ними пропорционально ценам компонентов на момент продажи.
+//@Description Без `outlet_id` считаются все точки организации, owner может указать `org_id` аффилированной организации
+//@Param type query AnalyticsSalesInput false "принимаемые поля"
+//@Accept json
+//@Produce json
+//@Success 200 {object} AnalyticsSalesOutput "аналитика продаж"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /analytics.Sales [get]
+func (s *AnalyticsService) Sales(c *gin.Context) {
+	var query AnalyticsSalesInput
+	if err := c.ShouldBindQuery(&query); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	filter := &repository.SalesFilter{
+		Start:    query.Start,
+		End:      query.End,
+		TZOffset: query.TZOffset,
+
+		ProductID:  query.ProductID,
+		CategoryID: query.CategoryID,
+		EmployeeID: query.EmployeeID,
+
+		Components: query.Components,
+
+		OutletID: claims.OutletID,
+		OrgID:    claims.OrganizationID,
+	}
+
+	if claims.HasRole(repository.R_OWNER) {
+		if stdQuery.OrgID != 0 && s.repo.Invitation.Exists(&repository.InvitationModel{OrgID: claims.OrganizationID, AffiliateOrgID: stdQuery.OrgID}) {
+			filter.OrgID = stdQuery.OrgID
+		}
+	}
+
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		filter.OutletID = stdQuery.OutletID
+	}
+
+	rows, err := s.repo.Analytics.Sales(query.GroupBy, filter)
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	total, err := s.repo.Analytics.SalesTotal(filter)
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	output := AnalyticsSalesOutput{
+		GroupBy: query.GroupBy,
+		Total:   newAnalyticsSalesOutputModel(&total),
+		Items:   make([]AnalyticsSalesOutputModel, len(rows)),
+	}
+
+	for i := range rows {
+		output.Items[i] = newAnalyticsSalesOutputModel(&rows[i])
+	}
+
+	NewResponse(c, http.StatusOK, output)
+}
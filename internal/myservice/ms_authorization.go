@@ -1,9 +1,16 @@
 package myservice
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"html/template"
+	"math"
 	"net/http"
 	"net/mail"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/iivkis/pos.7-era.backend/internal/config"
@@ -217,7 +224,9 @@ type SignInOrgInput struct {
 }
 
 type SignInOrgOutput struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`         // токен доступа, живет 15 минут
+	RefreshToken string `json:"refresh_token"` // токен обновления (одноразовый), см. /auth/refresh
+	ExpiresAt    int64  `json:"expires_at"`    // срок действия токена доступа (unix)
 }
 
 //@Summary Вход для организации
@@ -225,8 +234,13 @@ type SignInOrgOutput struct {
 //@Param json body SignInOrgInput true "Объект для входа в огранизацию."
 //@Accept json
 //@Produce json
-//@Success 200 {object} SignInOrgOutput "Возвращает `jwt токен` при успешной авторизации"
+//@Description Неудачные попытки ограничены по email и ip: после нескольких ошибок нужно ждать перед следующей попыткой,
+//@Description затем вход временно блокируется. Время ожидания в секундах возвращается в заголовке `Retry-After`
+//@Description Если email не подтвержден дольше разрешенного срока, то вход запрещен (403), а письмо с кодом подтверждения отправляется повторно
+//@Success 200 {object} SignInOrgOutput "Возвращает `jwt токен` и токен обновления при успешной авторизации"
 //@Failure 401 {object} serviceError
+//@Failure 403 {object} serviceError "email организации не подтвержден"
+//@Failure 429 {object} serviceError "слишком много неудачных попыток"
 //@Router /auth/signIn.Org [post]
 func (s *AuthorizationService) SignInOrg(c *gin.Context) {
 	var input SignInOrgInput
@@ -235,8 +249,29 @@ func (s *AuthorizationService) SignInOrg(c *gin.Context) {
 		return
 	}
 
+	keys := []signInKey{
+		{Key: "email:" + strings.ToLower(input.Email), Limit: repository.SignInLimitEmail},
+		{Key: "ip:" + c.ClientIP(), Limit: repository.SignInLimitIP},
+	}
+
+	attempt := repository.SignInAttemptModel{
+		Kind:  repository.SIGN_IN_ORG,
+		Login: input.Email,
+	}
+
+	if !checkSignInLimits(s.repo, c, keys, &attempt) {
+		return
+	}
+
 	org, err := s.repo.Organizations.SignIn(input.Email, input.Password)
 	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			if org != nil {
+				attempt.OrgID = org.ID
+			}
+			signInFailed(s.repo, c, &attempt)
+		}
+
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			NewResponse(c, http.StatusUnauthorized, errEmailNotFound())
 			return
@@ -249,8 +284,34 @@ func (s *AuthorizationService) SignInOrg(c *gin.Context) {
 		return
 	}
 
+	if err := signInSucceeded(s.repo, keys); err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	//после срока на подтверждение вход запрещен, пока email не подтвержден. Письмо с кодом отправляется повторно
+	if org.EmailConfirmOverdue() {
+		if _, err := s.sendConfirmCode(org.ID, org.Email); err != nil {
+			errUnknown(err.Error())
+		}
+		NewResponse(c, http.StatusForbidden, errEmailNotConfirmed("a confirmation email has been sent"))
+		return
+	}
+
+	session := repository.AuthSessionModel{
+		Kind:  repository.AUTH_SESSION_ORG,
+		OrgID: org.ID,
+	}
+
+	refreshToken, err := s.createSession(c, &session, authjwt.OrgRefreshTokenTTL)
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
 	claims := authjwt.OrganizationClaims{
 		OrganizationID: org.ID,
+		SessionID:      session.ID,
 	}
 
 	token, err := s.authjwt.SignInOrganization(&claims)
@@ -259,7 +320,7 @@ func (s *AuthorizationService) SignInOrg(c *gin.Context) {
 		return
 	}
 
-	output := SignInOrgOutput{Token: token}
+	output := SignInOrgOutput{Token: token, RefreshToken: refreshToken, ExpiresAt: claims.ExpiresAt}
 	NewResponse(c, http.StatusOK, output)
 }
 
@@ -269,8 +330,10 @@ type SignInEmployeeInput struct {
 }
 
 type SignInEmployeeOutput struct {
-	Token     string `json:"token"`
-	Affiliate bool   `json:"affiliate"` // является ли организация филиалом
+	Token        string `json:"token"`         // токен доступа, живет 15 минут
+	RefreshToken string `json:"refresh_token"` // токен обновления (одноразовый), см. /auth/refresh
+	ExpiresAt    int64  `json:"expires_at"`    // срок действия токена доступа (unix)
+	Affiliate    bool   `json:"affiliate"`     // является ли организация филиалом
 }
 
 //@Summary Вход для сотрудника
@@ -278,8 +341,12 @@ type SignInEmployeeOutput struct {
 //@Param json body SignInEmployeeInput true "Объект для входа в огранизацию."
 //@Accept json
 //@Produce json
+//@Description Неудачные попытки ограничены по сотруднику и по всей организации: после нескольких ошибок нужно ждать перед следующей попыткой,
+//@Description затем вход временно блокируется. Время ожидания в секундах возвращается в заголовке `Retry-After`
 //@Success 200 {object} SignInEmployeeOutput "Возвращает `jwt токен` при успешной авторизации"
 //@Failure 401 {object} serviceError
+//@Failure 403 {object} serviceError "email организации не подтвержден дольше разрешенного срока"
+//@Failure 429 {object} serviceError "слишком много неудачных попыток"
 //@Router /auth/signIn.Employee [post]
 func (s *AuthorizationService) SignInEmployee(c *gin.Context) {
 	var input SignInEmployeeInput
@@ -289,10 +356,28 @@ func (s *AuthorizationService) SignInEmployee(c *gin.Context) {
 	}
 	claims := mustGetOrganizationClaims(c)
 
+	keys := employeePinKeys(claims.OrganizationID, input.ID)
+
+	attempt := repository.SignInAttemptModel{
+		Kind:  repository.SIGN_IN_EMPLOYEE,
+		Login: strconv.FormatUint(uint64(input.ID), 10),
+		OrgID: claims.OrganizationID,
+	}
+
+	if s.repo.Employees.Exists(&repository.EmployeeModel{Model: gorm.Model{ID: input.ID}, OrgID: claims.OrganizationID}) {
+		attempt.EmployeeID = input.ID
+	}
+
+	if !checkSignInLimits(s.repo, c, keys, &attempt) {
+		return
+	}
+
 	//return employee model if find
 	empl, err := s.repo.Employees.SignIn(input.ID, input.Password, claims.OrganizationID)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		//неверный id и неверный пин-код не различаются в ответе
+		if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			signInFailed(s.repo, c, &attempt)
 			NewResponse(c, http.StatusUnauthorized, errRecordNotFound())
 			return
 		}
@@ -300,12 +385,35 @@ func (s *AuthorizationService) SignInEmployee(c *gin.Context) {
 		return
 	}
 
+	//общий счетчик организации не сбрасывается (попытка только возвращается), чтобы свой пин-код не позволял перебирать чужие
+	if err := signInSucceeded(s.repo, keys); err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	if !s.checkEmailConfirm(c, claims.OrganizationID) {
+		return
+	}
+
+	session := repository.AuthSessionModel{
+		Kind:       repository.AUTH_SESSION_EMPLOYEE,
+		EmployeeID: empl.ID,
+		OrgID:      claims.OrganizationID,
+	}
+
+	refreshToken, err := s.createSession(c, &session, authjwt.EmployeeRefreshTokenTTL)
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
 	//create new claims
 	newEmployeeClaims := authjwt.EmployeeClaims{
 		OrganizationID: claims.OrganizationID,
 		OutletID:       empl.OutletID,
 		EmployeeID:     empl.ID,
 		Role:           empl.Role,
+		SessionID:      session.ID,
 	}
 
 	token, err := s.authjwt.SignInEmployee(&newEmployeeClaims)
@@ -315,20 +423,346 @@ func (s *AuthorizationService) SignInEmployee(c *gin.Context) {
 	}
 
 	output := SignInEmployeeOutput{
-		Token:     token,
-		Affiliate: s.repo.Invitation.Exists(&repository.InvitationModel{AffiliateOrgID: claims.OrganizationID}),
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresAt:    newEmployeeClaims.ExpiresAt,
+		Affiliate:    s.repo.Invitation.Exists(&repository.InvitationModel{AffiliateOrgID: claims.OrganizationID}),
+	}
+
+	NewResponse(c, http.StatusOK, output)
+}
+
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required,max=100"`
+}
+
+type RefreshOutput struct {
+	Token        string `json:"token"`         // новый токен доступа
+	RefreshToken string `json:"refresh_token"` // новый токен обновления, старый больше не действует
+	ExpiresAt    int64  `json:"expires_at"`    // срок действия токена доступа (unix)
+}
+
+//@Summary Обновление токена доступа
+//@Description Выдает новый токен доступа и новый токен обновления (организации или сотрудника, в зависимости от сессии).
+//@Description Токен обновления одноразовый. Роль и точка сотрудника берутся из текущих данных сотрудника
+//@Param json body RefreshInput true "Токен обновления"
+//@Accept json
+//@Produce json
+//@Success 200 {object} RefreshOutput "Возвращает новую пару токенов"
+//@Failure 401 {object} serviceError
+//@Failure 403 {object} serviceError "email организации не подтвержден дольше разрешенного срока"
+//@Router /auth/refresh [post]
+func (s *AuthorizationService) Refresh(c *gin.Context) {
+	var input RefreshInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		NewResponse(c, http.StatusUnauthorized, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	hash := authjwt.HashRefreshToken(input.RefreshToken)
+
+	session, err := s.repo.AuthSessions.FindActive(&repository.AuthSessionModel{TokenHash: hash})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NewResponse(c, http.StatusUnauthorized, errTokenRevoked())
+			return
+		}
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	if !s.checkEmailConfirm(c, session.OrgID) {
+		return
+	}
+
+	var output RefreshOutput
+	var ttl time.Duration
+
+	switch session.Kind {
+	case repository.AUTH_SESSION_ORG:
+		claims := authjwt.OrganizationClaims{
+			OrganizationID: session.OrgID,
+			SessionID:      session.ID,
+		}
+
+		if output.Token, err = s.authjwt.SignInOrganization(&claims); err != nil {
+			NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+			return
+		}
+		output.ExpiresAt, ttl = claims.ExpiresAt, authjwt.OrgRefreshTokenTTL
+
+	case repository.AUTH_SESSION_EMPLOYEE:
+		empl, err := s.repo.Employees.FindFirst(&repository.EmployeeModel{Model: gorm.Model{ID: session.EmployeeID}, OrgID: session.OrgID})
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				s.repo.AuthSessions.Revoke(&repository.AuthSessionModel{ID: session.ID})
+				NewResponse(c, http.StatusUnauthorized, errTokenRevoked())
+				return
+			}
+			NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+			return
+		}
+
+		claims := authjwt.EmployeeClaims{
+			OrganizationID: session.OrgID,
+			OutletID:       empl.OutletID,
+			EmployeeID:     empl.ID,
+			Role:           empl.Role,
+			SessionID:      session.ID,
+		}
+
+		if output.Token, err = s.authjwt.SignInEmployee(&claims); err != nil {
+			NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+			return
+		}
+		output.ExpiresAt, ttl = claims.ExpiresAt, authjwt.EmployeeRefreshTokenTTL
+
+	default:
+		NewResponse(c, http.StatusUnauthorized, errTokenRevoked())
+		return
+	}
+
+	refreshToken, newHash, err := authjwt.NewRefreshToken()
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	//параллельный запрос с тем же токеном обновления получит ошибку
+	ok, err := s.repo.AuthSessions.Rotate(session.ID, hash, newHash, ttl)
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	if !ok {
+		NewResponse(c, http.StatusUnauthorized, errTokenRevoked())
+		return
 	}
 
+	output.RefreshToken = refreshToken
 	NewResponse(c, http.StatusOK, output)
 }
 
+//@Summary Выход организации
+//@Description Отзывает сессию текущего токена организации
+//@Success 200 {object} object "возвращает пустой объект"
+//@Failure 500 {object} serviceError
+//@Router /auth/signOut.Org [post]
+func (s *AuthorizationService) SignOutOrg(c *gin.Context) {
+	claims := mustGetOrganizationClaims(c)
+
+	if err := s.repo.AuthSessions.Revoke(&repository.AuthSessionModel{ID: claims.SessionID}); err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+	NewResponse(c, http.StatusOK, nil)
+}
+
+//@Summary Выход организации на всех устройствах
+//@Description Отзывает все сессии организации, включая сессии всех ее сотрудников
+//@Success 200 {object} object "возвращает пустой объект"
+//@Failure 500 {object} serviceError
+//@Router /auth/signOut.Org.All [post]
+func (s *AuthorizationService) SignOutOrgAll(c *gin.Context) {
+	claims := mustGetOrganizationClaims(c)
+
+	if err := s.repo.AuthSessions.Revoke(&repository.AuthSessionModel{OrgID: claims.OrganizationID}); err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+	NewResponse(c, http.StatusOK, nil)
+}
+
+//@Summary Выход сотрудника
+//@Description Отзывает сессию текущего токена сотрудника
+//@Success 200 {object} object "возвращает пустой объект"
+//@Failure 500 {object} serviceError
+//@Router /auth/signOut.Employee [post]
+func (s *AuthorizationService) SignOutEmployee(c *gin.Context) {
+	claims := mustGetEmployeeClaims(c)
+
+	if err := s.repo.AuthSessions.Revoke(&repository.AuthSessionModel{ID: claims.SessionID}); err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+	NewResponse(c, http.StatusOK, nil)
+}
+
+//@Summary Выход сотрудника на всех устройствах
+//@Description Отзывает все сессии текущего сотрудника
+//@Success 200 {object} object "возвращает пустой объект"
+//@Failure 500 {object} serviceError
+//@Router /auth/signOut.Employee.All [post]
+func (s *AuthorizationService) SignOutEmployeeAll(c *gin.Context) {
+	claims := mustGetEmployeeClaims(c)
+
+	if err := s.repo.AuthSessions.RevokeEmployee(claims.EmployeeID); err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+	NewResponse(c, http.StatusOK, nil)
+}
+
+//signInKey - ключ, по которому считаются неудачные попытки входа, и его ограничение
+type signInKey struct {
+	Key   string
+	Limit *repository.SignInLimit
+}
+
+//employeePinKeys - ключи неудачных попыток пин-кода сотрудника: по сотруднику и по всей организации
+func employeePinKeys(orgID, employeeID uint) []signInKey {
+	return []signInKey{
+		{Key: fmt.Sprintf("employee:%d:%d", orgID, employeeID), Limit: repository.SignInLimitEmployee},
+		{Key: fmt.Sprintf("org_pins:%d", orgID), Limit: repository.SignInLimitOrgPins},
+	}
+}
+
+//checkSignInLimits - проверяет ограничения неудачных попыток по всем ключам и заранее учитывает попытку как неудачную.
+//Если вход сейчас запрещен, то возвращает уже учтенные попытки, записывает попытку в журнал, отвечает 429 и возвращает false
+func checkSignInLimits(repo *repository.Repository, c *gin.Context, keys []signInKey, attempt *repository.SignInAttemptModel) bool {
+	var wait time.Duration
+	reserved := make([]signInKey, 0, len(keys))
+	for _, key := range keys {
+		d, err := repo.SignInAttempts.Reserve(key.Key, key.Limit)
+		if err != nil {
+			releaseSignInAttempts(repo, reserved)
+			NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+			return false
+		}
+
+		if d == 0 {
+			reserved = append(reserved, key)
+		} else if d > wait {
+			wait = d
+		}
+	}
+
+	if wait == 0 {
+		return true
+	}
+
+	releaseSignInAttempts(repo, reserved)
+
+	attempt.Reason = "locked"
+	auditSignInAttempt(repo, c, attempt)
+
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	NewResponse(c, http.StatusTooManyRequests, errTooManyAttempts())
+	return false
+}
+
+//signInSucceeded - сбрасывает счетчик по первому ключу и возвращает попытку, учтенную по остальным
+func signInSucceeded(repo *repository.Repository, keys []signInKey) error {
+	if err := repo.SignInAttempts.Reset(keys[0].Key); err != nil {
+		return err
+	}
+	releaseSignInAttempts(repo, keys[1:])
+	return nil
+}
+
+//releaseSignInAttempts - возвращает попытки, учтенные по ключам keys. Ошибки не мешают ответу на запрос
+func releaseSignInAttempts(repo *repository.Repository, keys []signInKey) {
+	for _, key := range keys {
+		if err := repo.SignInAttempts.Release(key.Key, key.Limit); err != nil {
+			errUnknown(err.Error())
+		}
+	}
+}
+
+//signInFailed - записывает неудачную попытку в журнал (по ключам она учтена в checkSignInLimits)
+func signInFailed(repo *repository.Repository, c *gin.Context, attempt *repository.SignInAttemptModel) {
+	attempt.Reason = "invalid credentials"
+	auditSignInAttempt(repo, c, attempt)
+}
+
+func auditSignInAttempt(repo *repository.Repository, c *gin.Context, attempt *repository.SignInAttemptModel) {
+	attempt.IP = c.ClientIP()
+	if attempt.UserAgent = c.Request.UserAgent(); len(attempt.UserAgent) > 255 {
+		attempt.UserAgent = attempt.UserAgent[:255]
+	}
+
+	if len(attempt.Login) > 100 {
+		attempt.Login = attempt.Login[:100]
+	}
+
+	if err := repo.SignInAttempts.Audit(attempt); err != nil {
+		errUnknown(err.Error())
+	}
+}
+
+//createSession - создает сессию входа со сроком жизни ttl и возвращает ее токен обновления
+func (s *AuthorizationService) createSession(c *gin.Context, session *repository.AuthSessionModel, ttl time.Duration) (string, error) {
+	refreshToken, hash, err := authjwt.NewRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	session.TokenHash = hash
+	session.IP = c.ClientIP()
+	if session.UserAgent = c.Request.UserAgent(); len(session.UserAgent) > 255 {
+		session.UserAgent = session.UserAgent[:255]
+	}
+
+	if err := s.repo.AuthSessions.Create(session, ttl); err != nil {
+		return "", err
+	}
+	return refreshToken, nil
+}
+
+//checkEmailConfirm - отвечает 403 и возвращает false, если email организации не подтвержден дольше разрешенного срока
+func (s *AuthorizationService) checkEmailConfirm(c *gin.Context, orgID uint) bool {
+	org, err := s.repo.Organizations.FindFirts(&repository.OrganizationModel{ID: orgID})
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return false
+	}
+
+	if org.EmailConfirmOverdue() {
+		NewResponse(c, http.StatusForbidden, errEmailNotConfirmed())
+		return false
+	}
+	return true
+}
+
+//sendConfirmCode - отправляет письмо с кодом подтверждения email организации.
+//Код содержит id организации, поэтому им нельзя подтвердить тот же адрес в другой организации.
+//Если письмо отправлялось недавно, то ничего не отправляет и возвращает, сколько нужно подождать
+func (s *AuthorizationService) sendConfirmCode(orgID uint, email string) (time.Duration, error) {
+	wait, err := s.repo.Organizations.TouchConfirmCodeSent(orgID)
+	if err != nil || wait != 0 {
+		return wait, err
+	}
+	return 0, s.mailConfirmCode(orgID, email)
+}
+
+func (s *AuthorizationService) mailConfirmCode(orgID uint, email string) error {
+	return s.mailagent.SendTemplate(email, "confirm_code.html", mailagent.Value{
+		"code":     s.strcode.Encode(fmt.Sprintf("%d|%s", orgID, email)),
+		"host":     config.Env.OutHost,
+		"port":     config.Env.OutPort,
+		"protocol": config.Env.OutProtocol,
+		"type":     "org",
+	})
+}
+
+//respondConfirmCodeThrottled - ответ 429, если письмо с кодом подтверждения отправлялось недавно
+func respondConfirmCodeThrottled(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	NewResponse(c, http.StatusTooManyRequests, errTooManyRequests("the confirmation email has already been sent recently"))
+}
+
 type SendCodeInputQuery struct {
-	Email string `form:"email" binding:"required"`
+	Email string `form:"email"`
 }
 
 //@Summary Отправка кода подтверждения почты
-//@param email query string false "адрес на который будет отправлено письмо (например: email@exmp.ru)"
+//@Description Отправляет письмо на ожидающий подтверждения новый email организации, иначе на текущий email.
+//@Description Письмо отправляется не чаще раза в минуту, время ожидания в секундах возвращается в заголовке `Retry-After`
+//@param email query string false "адрес организации, на который будет отправлено письмо (необязательно)"
 //@Success 200 {object} object "возвращает пустой объект"
+//@Failure 400 {object} serviceError
+//@Failure 429 {object} serviceError "письмо уже отправлялось недавно"
 //@Router /auth/sendCode [get]
 func (s *AuthorizationService) SendCode(c *gin.Context) {
 	var inputQ SendCodeInputQuery
@@ -337,23 +771,44 @@ func (s *AuthorizationService) SendCode(c *gin.Context) {
 		return
 	}
 
-	//проверка на сущ. email в БД
-	if !s.repo.Organizations.EmailExists(inputQ.Email) {
+	claims := mustGetOrganizationClaims(c)
+
+	org, err := s.repo.Organizations.FindFirts(&repository.OrganizationModel{ID: claims.OrganizationID})
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	email := org.PendingEmail
+	if email == "" {
+		email = org.Email
+	}
+
+	//адрес должен принадлежать организации
+	if inputQ.Email != "" && inputQ.Email != org.Email && inputQ.Email != org.PendingEmail {
 		NewResponse(c, http.StatusBadRequest, errEmailNotFound())
 		return
 	}
+	if inputQ.Email != "" {
+		email = inputQ.Email
+	}
+
+	if email == org.Email && org.EmailConfirmed {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData("email is already confirmed"))
+		return
+	}
 
 	//отправка письма с ссылкой для подтверждения
-	if err := s.mailagent.SendTemplate(inputQ.Email, "confirm_code.html", mailagent.Value{
-		"code":     s.strcode.Encode(inputQ.Email),
-		"host":     config.Env.OutHost,
-		"port":     config.Env.OutPort,
-		"protocol": config.Env.OutProtocol,
-		"type":     "org",
-	}); err != nil {
+	wait, err := s.sendConfirmCode(org.ID, email)
+	if err != nil {
 		NewResponse(c, http.StatusInternalServerError, errUnknown("error on send email"))
 		return
 	}
+
+	if wait != 0 {
+		respondConfirmCodeThrottled(c, wait)
+		return
+	}
 	NewResponse(c, http.StatusOK, nil)
 }
 
@@ -361,25 +816,307 @@ type AuthConfirmCodeQuery struct {
 	Code string `form:"code" binding:"required"`
 }
 
+//confirmLandingTmpl - страница, которая открывается по ссылке из письма с кодом подтверждения
+var confirmLandingTmpl = template.Must(template.New("confirm_landing").Parse(`<!DOCTYPE html>
+<html lang="ru">
+
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>POS-Ninja</title>
+</head>
+
+<body>
+    <h4>{{.title}}</h4>
+    <p>{{.message}}</p>
+</body>
+
+</html>`))
+
+//renderConfirmLanding - отвечает html-страницей с результатом подтверждения email
+func renderConfirmLanding(c *gin.Context, code int, title string, message string) {
+	var buf bytes.Buffer
+	if err := confirmLandingTmpl.Execute(&buf, map[string]string{"title": title, "message": message}); err != nil {
+		errUnknown(err.Error())
+	}
+	c.Data(code, "text/html; charset=utf-8", buf.Bytes())
+}
+
 //@Summary Проверка кода подтверждения
-//@param type query AuthConfirmCodeQuery false "адрес на который будет отправлено письмо (например: email@exmp.ru)"
-//@Success 200 {object} object "возвращает пустой объект"
+//@Description Открывается по ссылке из письма и возвращает html-страницу с результатом.
+//@Description Если подтвержден новый email организации, то он заменяет текущий
+//@param type query AuthConfirmCodeQuery false "код из письма"
+//@Produce html
+//@Success 200 {string} string "страница об успешном подтверждении"
+//@Failure 400 {string} string "страница с ошибкой"
 //@Router /auth/confirmCode [get]
 func (s *AuthorizationService) ConfirmCode(c *gin.Context) {
 	var inputQ AuthConfirmCodeQuery
 	if err := c.ShouldBindQuery(&inputQ); err != nil {
+		renderConfirmLanding(c, http.StatusBadRequest, "Ошибка подтверждения", "Ссылка неполная. Скопируйте ссылку из письма целиком.")
+		return
+	}
+
+	payload, err := s.strcode.Decode(inputQ.Code)
+	if err != nil {
+		renderConfirmLanding(c, http.StatusBadRequest, "Ошибка подтверждения", "Ссылка недействительна или устарела. Запросите новое письмо в приложении.")
+		return
+	}
+
+	//коды, отправленные до привязки к организации, содержат только email
+	parts := strings.SplitN(payload, "|", 2)
+	if len(parts) != 2 {
+		if err := s.repo.Organizations.SetConfirmEmail(payload, true); err != nil {
+			errUnknown(err.Error())
+			renderConfirmLanding(c, http.StatusInternalServerError, "Ошибка подтверждения", "Не удалось подтвердить email. Попробуйте позже.")
+			return
+		}
+		renderConfirmLanding(c, http.StatusOK, "Email подтвержден", "Адрес электронной почты успешно подтвержден. Можно вернуться в приложение.")
+		return
+	}
+
+	orgID, err := strconv.ParseUint(parts[0], 10, 0)
+	if err != nil {
+		renderConfirmLanding(c, http.StatusBadRequest, "Ошибка подтверждения", "Ссылка недействительна. Запросите новое письмо в приложении.")
+		return
+	}
+
+	org, err := s.repo.Organizations.FindFirts(&repository.OrganizationModel{ID: uint(orgID)})
+	if err != nil || (parts[1] != org.Email && parts[1] != org.PendingEmail) {
+		renderConfirmLanding(c, http.StatusBadRequest, "Ошибка подтверждения", "Адрес в ссылке больше не относится к организации. Запросите новое письмо в приложении.")
+		return
+	}
+
+	if err := s.repo.Organizations.ConfirmEmail(org, parts[1]); err != nil {
+		if dberr, ok := isDatabaseError(err); ok && dberr.Number == 1062 {
+			renderConfirmLanding(c, http.StatusBadRequest, "Ошибка подтверждения", "Этот адрес уже используется другой организацией.")
+			return
+		}
+		errUnknown(err.Error())
+		renderConfirmLanding(c, http.StatusInternalServerError, "Ошибка подтверждения", "Не удалось подтвердить email. Попробуйте позже.")
+		return
+	}
+
+	renderConfirmLanding(c, http.StatusOK, "Email подтвержден", "Адрес электронной почты успешно подтвержден. Можно вернуться в приложение.")
+}
+
+type ChangeEmailInput struct {
+	Email    string `json:"email" binding:"required,min=3,max=50"`
+	Password string `json:"password" binding:"required,max=45"` // текущий пароль организации
+}
+
+//@Summary Смена email организации
+//@Description На новый адрес отправляется письмо с кодом подтверждения. До подтверждения организация входит по старому email,
+//@Description после подтверждения новый email заменяет старый. Письмо отправляется не чаще раза в минуту
+//@param json body ChangeEmailInput true "Принимаемый объект"
+//@Accept json
+//@Produce json
+//@Success 200 {object} object "возвращает пустой объект"
+//@Failure 400 {object} serviceError
+//@Failure 429 {object} serviceError "письмо уже отправлялось недавно или слишком много неверных паролей"
+//@Failure 500 {object} serviceError
+//@Router /auth/changeEmail [post]
+func (s *AuthorizationService) ChangeEmail(c *gin.Context) {
+	var input ChangeEmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
 		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
 		return
 	}
 
-	email, err := s.strcode.Decode(inputQ.Code)
+	if _, err := mail.ParseAddress(input.Email); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectEmail(err.Error()))
+		return
+	}
+
+	claims := mustGetEmployeeClaims(c)
+
+	org, err := s.repo.Organizations.FindFirts(&repository.OrganizationModel{ID: claims.OrganizationID})
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	//проверка пароля ограничена так же, как вход организации, и по тем же счетчикам
+	keys := []signInKey{
+		{Key: "email:" + strings.ToLower(org.Email), Limit: repository.SignInLimitEmail},
+		{Key: "ip:" + c.ClientIP(), Limit: repository.SignInLimitIP},
+	}
+
+	attempt := repository.SignInAttemptModel{
+		Kind:  repository.SIGN_IN_ORG,
+		Login: org.Email,
+		OrgID: org.ID,
+	}
+
+	if !checkSignInLimits(s.repo, c, keys, &attempt) {
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(org.Password), []byte(input.Password)); err != nil {
+		signInFailed(s.repo, c, &attempt)
+		NewResponse(c, http.StatusBadRequest, errIncorrectPassword())
+		return
+	}
+
+	if err := signInSucceeded(s.repo, keys); err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	if input.Email == org.Email {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData("the new email matches the current one"))
+		return
+	}
+
+	if s.repo.Organizations.EmailExists(input.Email) {
+		NewResponse(c, http.StatusBadRequest, errEmailExists())
+		return
+	}
+
+	wait, err := s.repo.Organizations.TouchConfirmCodeSent(org.ID)
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	if wait != 0 {
+		respondConfirmCodeThrottled(c, wait)
+		return
+	}
+
+	if err := s.repo.Organizations.SetPendingEmail(org.ID, input.Email); err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	if err := s.mailConfirmCode(org.ID, input.Email); err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown("error on send email"))
+		return
+	}
+	NewResponse(c, http.StatusOK, nil)
+}
+
+type ResetPasswordRequestInput struct {
+	Email string `json:"email" binding:"required,max=50"`
+}
+
+//@Summary Запрос на сброс пароля организации
+//@Description Отправляет на email организации одноразовый код для сброса пароля (действует 1 час).
+//@Description Всегда возвращает успешный ответ, чтобы нельзя было проверить, зарегистрирован ли email.
+//@Description На один email письмо отправляется не чаще раза в минуту, письмо отправляется в фоне
+//@param json body ResetPasswordRequestInput true "Принимаемый объект"
+//@Accept json
+//@Produce json
+//@Success 200 {object} object "возвращает пустой объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /auth/resetPassword.Request [post]
+func (s *AuthorizationService) ResetPasswordRequest(c *gin.Context) {
+	var input ResetPasswordRequestInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	org, err := s.repo.Organizations.FindFirts(&repository.OrganizationModel{Email: input.Email})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NewResponse(c, http.StatusOK, nil)
+			return
+		}
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	if s.repo.PasswordResets.RequestedRecently(org.ID) {
+		NewResponse(c, http.StatusOK, nil)
+		return
+	}
+
+	//случайная часть кода генерируется так же, как токен обновления, на сервере хранится только ее хеш
+	nonce, hash, err := authjwt.NewRefreshToken()
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	reset := repository.PasswordResetModel{
+		TokenHash: hash,
+		IP:        c.ClientIP(),
+		OrgID:     org.ID,
+	}
+
+	if err := s.repo.PasswordResets.Create(&reset); err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	//письмо отправляется в фоне: ответ и время ответа не зависят от того, зарегистрирован ли email.
+	//Ошибка отправки только логируется, код можно запросить повторно
+	go func(email, code string) {
+		if err := s.mailagent.SendTemplate(email, "reset_password.html", mailagent.Value{
+			"code": code,
+			"ttl":  int(repository.PasswordResetTTL.Minutes()),
+		}); err != nil {
+			errUnknown(err.Error())
+		}
+	}(org.Email, s.strcode.Encode(nonce))
+
+	NewResponse(c, http.StatusOK, nil)
+}
+
+type ResetPasswordConfirmInput struct {
+	Code     string `json:"code" binding:"required,max=150"`
+	Password string `json:"password" binding:"required,min=6,max=45"`
+}
+
+//@Summary Установка нового пароля организации по коду из письма
+//@Description Код одноразовый. После смены пароля остальные коды сброса становятся недействительными,
+//@Description а все сессии организации и ее сотрудников отзываются
+//@param json body ResetPasswordConfirmInput true "Принимаемый объект"
+//@Accept json
+//@Produce json
+//@Success 200 {object} object "возвращает пустой объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /auth/resetPassword.Confirm [post]
+func (s *AuthorizationService) ResetPasswordConfirm(c *gin.Context) {
+	var input ResetPasswordConfirmInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	nonce, err := s.strcode.Decode(input.Code)
 	if err != nil {
 		NewResponse(c, http.StatusBadRequest, errIncorrectConfirmCode(err.Error()))
 		return
 	}
 
-	if err := s.repo.Organizations.SetConfirmEmail(email, true); err != nil {
-		NewResponse(c, http.StatusBadRequest, errUnknown(err.Error()))
+	//токен, пароль и сессии меняются вместе: при ошибке токен остается действительным
+	err = s.repo.Transaction(func(tx *repository.Repository) error {
+		reset, err := tx.PasswordResets.Use(authjwt.HashRefreshToken(nonce))
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Organizations.SetPassword(reset.OrgID, input.Password); err != nil {
+			return err
+		}
+
+		if err := tx.PasswordResets.Invalidate(reset.OrgID); err != nil {
+			return err
+		}
+		return tx.AuthSessions.Revoke(&repository.AuthSessionModel{OrgID: reset.OrgID})
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NewResponse(c, http.StatusBadRequest, errIncorrectConfirmCode("the code has expired or has already been used"))
+			return
+		}
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
 		return
 	}
+
+	NewResponse(c, http.StatusOK, nil)
 }
@@ -0,0 +1,280 @@
+package myservice
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iivkis/pos.7-era.backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+type BundleComponentOutputModel struct {
+	ID          uint `json:"id"`
+	Count       int  `json:"count"` // кол-во компонента в одном комплекте
+	BundleID    uint `json:"bundle_id"`
+	ComponentID uint `json:"component_id"`
+	OutletID    uint `json:"outlet_id"`
+}
+
+type BundlesService struct {
+	repo *repository.Repository
+}
+
+func newBundlesService(repo *repository.Repository) *BundlesService {
+	return &BundlesService{
+		repo: repo,
+	}
+}
+
+type BundleComponentCreateInput struct {
+	Count       int  `json:"count" binding:"min=1,max=1000"`
+	BundleID    uint `json:"bundle_id" binding:"min=1"`    // продукт-комплект (`is_bundle`)
+	ComponentID uint `json:"component_id" binding:"min=1"` // продукт, входящий в комплект
+}
+
+//@Summary Добавить продукт в комплект
+//@Description Комплект - продукт, созданный с `is_bundle`. Компонентом может быть только обычный продукт той же точки.
+//@Description При продаже комплекта ингредиенты списываются по рецептам компонентов
+//@param type body BundleComponentCreateInput false "Принимаемый объект"
+//@Accept json
+//@Produce json
+//@Success 201 {object} DefaultOutputModel "возвращает id созданной записи"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /bundleComponents [post]
+func (s *BundlesService) Create(c *gin.Context) {
+	var input BundleComponentCreateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	component := repository.BundleComponentModel{
+		Count:       input.Count,
+		BundleID:    input.BundleID,
+		ComponentID: input.ComponentID,
+		OutletID:    claims.OutletID,
+		OrgID:       claims.OrganizationID,
+	}
+
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		if stdQuery.OutletID != 0 && s.repo.Outlets.ExistsInOrg(stdQuery.OutletID, claims.OrganizationID) {
+			component.OutletID = stdQuery.OutletID
+		}
+	}
+
+	bundle, err := s.repo.Products.FindFirst(&repository.ProductModel{ID: component.BundleID, OutletID: component.OutletID, OrgID: component.OrgID})
+	if err != nil || !bundle.IsBundle {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData("undefined bundle product with this `bundle_id` in outlet"))
+		return
+	}
+
+	product, err := s.repo.Products.FindFirst(&repository.ProductModel{ID: component.ComponentID, OutletID: component.OutletID, OrgID: component.OrgID})
+	if err != nil || product.IsBundle {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData("undefined product with this `component_id` in outlet or the product is a bundle"))
+		return
+	}
+
+	if err := s.repo.Bundles.Create(&component); err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	NewResponse(c, http.StatusCreated, DefaultOutputModel{ID: component.ID})
+}
+
+type BundleComponentGetAllQuery struct {
+	BundleID uint `form:"bundle_id"`
+}
+
+type BundleComponentGetAllOutput []BundleComponentOutputModel
+
+//@Summary Состав комплектов точки
+//@param type query BundleComponentGetAllQuery false "Принимаемый объект"
+//@Accept json
+//@Produce json
+//@Success 200 {object} BundleComponentGetAllOutput "возвращаемый объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /bundleComponents [get]
+func (s *BundlesService) GetAll(c *gin.Context) {
+	var query BundleComponentGetAllQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	where := &repository.BundleComponentModel{
+		BundleID: query.BundleID,
+		OutletID: claims.OutletID,
+		OrgID:    claims.OrganizationID,
+	}
+
+	if claims.HasRole(repository.R_OWNER) {
+		if stdQuery.OrgID != 0 && s.repo.Invitation.Exists(&repository.InvitationModel{OrgID: claims.OrganizationID, AffiliateOrgID: stdQuery.OrgID}) {
+			where.OrgID = stdQuery.OrgID
+		}
+	}
+
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		where.OutletID = stdQuery.OutletID
+	}
+
+	components, err := s.repo.Bundles.Find(where)
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	output := make(BundleComponentGetAllOutput, len(*components))
+	for i, item := range *components {
+		output[i] = BundleComponentOutputModel{
+			ID:          item.ID,
+			Count:       item.Count,
+			BundleID:    item.BundleID,
+			ComponentID: item.ComponentID,
+			OutletID:    item.OutletID,
+		}
+	}
+	NewResponse(c, http.StatusOK, output)
+}
+
+type BundleComponentUpdateInput struct {
+	Count *int `json:"count,omitempty" binding:"omitempty,min=1,max=1000"`
+}
+
+//@Summary Изменить кол-во продукта в комплекте
+//@param type body BundleComponentUpdateInput false "Обновляемые поля"
+//@Accept json
+//@Produce json
+//@Success 200 {object} object "возвращает пустой объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /bundleComponents/:id [put]
+func (s *BundlesService) UpdateFields(c *gin.Context) {
+	var input BundleComponentUpdateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	component, ok := s.findComponent(c)
+	if !ok {
+		return
+	}
+
+	updatedFields := make(map[string]interface{})
+	if input.Count != nil {
+		updatedFields["count"] = *input.Count
+	}
+
+	if len(updatedFields) != 0 {
+		if err := s.repo.Bundles.UpdatesFull(&repository.BundleComponentModel{ID: component.ID}, &updatedFields); err != nil {
+			NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+			return
+		}
+	}
+
+	NewResponse(c, http.StatusOK, nil)
+}
+
+//@Summary Убрать продукт из комплекта
+//@Description Проданные комплекты сохраняют состав на момент продажи
+//@Accept json
+//@Produce json
+//@Success 200 {object} object "возвращает пустой объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /bundleComponents/:id [delete]
+func (s *BundlesService) Delete(c *gin.Context) {
+	component, ok := s.findComponent(c)
+	if !ok {
+		return
+	}
+
+	if err := s.repo.Bundles.Delete(&repository.BundleComponentModel{ID: component.ID}); err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	NewResponse(c, http.StatusOK, nil)
+}
+
+//findComponent - компонент комплекта из параметра `id` в пределах точки (организации для владельца и директора)
+func (s *BundlesService) findComponent(c *gin.Context) (*repository.BundleComponentModel, bool) {
+	idx, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return nil, false
+	}
+
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	where := &repository.BundleComponentModel{
+		ID:       uint(idx),
+		OutletID: claims.OutletID,
+		OrgID:    claims.OrganizationID,
+	}
+
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		where.OutletID = stdQuery.OutletID
+	}
+
+	component, err := s.repo.Bundles.FindFirst(where)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NewResponse(c, http.StatusBadRequest, errRecordNotFound("undefined bundle component with this id"))
+			return nil, false
+		}
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return nil, false
+	}
+	return component, true
+}
+
+//selectBundleComponents - снимок состава комплекта bundle на момент продажи и себестоимость одного комплекта.
+//Выручка комплекта делится между компонентами пропорционально их ценам в каталоге (кол-во * цена),
+//если у всех компонентов нулевая цена - пропорционально кол-ву
+func selectBundleComponents(repo *repository.Repository, bundle *repository.ProductModel) (components []repository.OrderListComponentModel, cost float64, err error) {
+	items, err := repo.Bundles.FindComponents(bundle.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var weightTotal, countTotal float64
+	for _, item := range *items {
+		weightTotal += item.ComponentModel.Price * float64(item.Count)
+		countTotal += float64(item.Count)
+	}
+
+	components = make([]repository.OrderListComponentModel, len(*items))
+	for i, item := range *items {
+		unitCost, err := repo.ProductsWithIngredients.UnitCost(item.ComponentID)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		share := float64(item.Count) / countTotal
+		if weightTotal > 0 {
+			share = item.ComponentModel.Price * float64(item.Count) / weightTotal
+		}
+
+		components[i] = repository.OrderListComponentModel{
+			ProductName: item.ComponentModel.Name,
+			Count:       item.Count,
+			Share:       share,
+			CostPrice:   unitCost,
+			ProductID:   item.ComponentID,
+			OutletID:    bundle.OutletID,
+			OrgID:       bundle.OrgID,
+		}
+		cost += unitCost * float64(item.Count)
+	}
+	return components, cost, nil
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/iivkis/pos.7-era.backend/internal/repository"
+	"github.com/iivkis/pos.7-era.backend/pkg/authjwt"
 	"gorm.io/gorm"
 )
 
@@ -53,13 +54,21 @@ func (s *CashChangesService) Create(c *gin.Context) {
 		return
 	}
 
-	claims := mustGetEmployeeClaims(c)
-
-	if !s.repo.Sessions.Exists(&repository.SessionModel{Model: gorm.Model{ID: input.SessionID}, EmployeeID: claims.EmployeeID}) {
-		NewResponse(c, http.StatusBadRequest, errRecordNotFound("session undefined"))
+	output, code, serr := s.create(s.repo, mustGetEmployeeClaims(c), &input)
+	if serr != nil {
+		NewResponse(c, code, serr)
 		return
 	}
 
+	NewResponse(c, http.StatusOK, output)
+}
+
+//create - добавляет запись об изменении баланса кассы в сессии сотрудника (repo - репозиторий или транзакция)
+func (s *CashChangesService) create(repo *repository.Repository, claims *authjwt.EmployeeClaims, input *CashChangesCreateInput) (output *DefaultOutputModel, code int, serr *serviceError) {
+	if !repo.Sessions.Exists(&repository.SessionModel{Model: gorm.Model{ID: input.SessionID}, EmployeeID: claims.EmployeeID}) {
+		return nil, http.StatusBadRequest, errRecordNotFound("session undefined")
+	}
+
 	model := repository.CashChangesModel{
 		Date:       input.Date,
 		Total:      input.Total,
@@ -71,12 +80,11 @@ func (s *CashChangesService) Create(c *gin.Context) {
 		OrgID:      claims.OrganizationID,
 	}
 
-	if err := s.repo.CashChanges.Create(&model); err != nil {
-		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
-		return
+	if err := repo.CashChanges.Create(&model); err != nil {
+		return nil, http.StatusInternalServerError, errUnknown(err.Error())
 	}
 
-	NewResponse(c, http.StatusOK, DefaultOutputModel{ID: model.ID})
+	return &DefaultOutputModel{ID: model.ID}, http.StatusOK, nil
 }
 
 type CashChangesGetAllQuery struct {
@@ -87,6 +95,9 @@ type CashChangesGetAllQuery struct {
 type CashChangesGetAllOutput []CashChangesOutputModel
 
 //@Summary Получить всю информацию о снятии\вкладе денежных средств (в точке)
+//@Description Поддерживает `offset`, `limit` и `sort` (id, date, total) из стандартного query.
+//@Description Общее кол-во записей возвращается в заголовке `X-Total-Count`
+//@Description Без `limit` возвращается 100 записей, если указаны `offset` или `sort`, иначе - до 1000 записей
 //@param type query CashChangesGetAllQuery false "Принимаемый объект"
 //@Success 201 {object} CashChangesGetAllOutput "список изменений баланса кассы"
 //@Accept json
@@ -113,11 +124,12 @@ func (s *CashChangesService) GetAll(c *gin.Context) {
 		}
 	}
 
-	items, err := s.repo.CashChanges.FindWithPeriod(query.Start, query.End, where)
+	items, total, err := s.repo.CashChanges.FindPage(where, stdQuery.listOptions(query.Start, query.End))
 	if err != nil {
-		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		listError(c, err)
 		return
 	}
+	setTotalCount(c, total)
 
 	var output = make(CashChangesGetAllOutput, len(*items))
 	for i, item := range *items {
@@ -71,17 +71,21 @@ func (s *EmployeesService) GetAll(c *gin.Context) {
 }
 
 type EmployeeUpdateFieldsInput struct {
-	Name     string `json:"name"`
-	Password string `json:"password" binding:"max=6"`
-	RoleID   int    `json:"role_id"`
+	Name            string `json:"name"`
+	Password        string `json:"password" binding:"max=6"`
+	CurrentPassword string `json:"current_password" binding:"max=6"` // текущий пин-код, нужен для смены своего пин-кода
+	RoleID          int    `json:"role_id"`
 }
 
 //@Summary Позволяет обновить поля сотрудника
+//@Description При смене роли все сессии сотрудника отзываются.
+//@Description Чтобы сменить свой пин-код, нужно указать текущий в `current_password`. Пин-код подчиненного управляющий меняет без текущего
 //@param type body EmployeeUpdateFieldsInput false "Принимаемый объект"
 //@Accept json
 //@Produce json
 //@Success 200 {object} object "возвращает пустой объект"
 //@Failure 400 {object} serviceError
+//@Failure 429 {object} serviceError "слишком много неверных `current_password`, время ожидания в заголовке `Retry-After`"
 //@Router /employees/:id [put]
 func (s *EmployeesService) UpdateFields(c *gin.Context) {
 	var input EmployeeUpdateFieldsInput
@@ -190,15 +194,52 @@ func (s *EmployeesService) UpdateFields(c *gin.Context) {
 		return
 	}
 
+	//свой пин-код меняется только с подтверждением текущего.
+	//Проверка ограничена так же, как вход сотрудника, и по тем же счетчикам
+	if updatedFields.Password != "" && claims.EmployeeID == editedEmployee.ID {
+		keys := employeePinKeys(claims.OrganizationID, editedEmployee.ID)
+
+		attempt := repository.SignInAttemptModel{
+			Kind:       repository.SIGN_IN_EMPLOYEE,
+			Login:      strconv.FormatUint(uint64(editedEmployee.ID), 10),
+			EmployeeID: editedEmployee.ID,
+			OrgID:      claims.OrganizationID,
+		}
+
+		if !checkSignInLimits(s.repo, c, keys, &attempt) {
+			return
+		}
+
+		if !s.repo.Employees.CheckPassword(editedEmployee.ID, input.CurrentPassword) {
+			signInFailed(s.repo, c, &attempt)
+			NewResponse(c, http.StatusBadRequest, errIncorrectPassword("incorrect `current_password`"))
+			return
+		}
+
+		if err := signInSucceeded(s.repo, keys); err != nil {
+			NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+			return
+		}
+	}
+
 	if err := s.repo.Employees.Updates(updatedFields, &repository.EmployeeModel{Model: gorm.Model{ID: uint(employeeID)}}); err != nil {
 		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
 		return
 	}
 
+	//при смене роли выданные токены сотрудника отзываются
+	if updatedFields.Role != "" && updatedFields.Role != editedEmployee.Role {
+		if err := s.repo.AuthSessions.RevokeEmployee(editedEmployee.ID); err != nil {
+			NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+			return
+		}
+	}
+
 	NewResponse(c, http.StatusOK, nil)
 }
 
 //@Summary Позволяет удалить сотрудника
+//@Description Все сессии сотрудника отзываются
 //@Accept json
 //@Produce json
 //@Success 200 {object} object "возвращает пустой объект"
@@ -246,5 +287,11 @@ func (s *EmployeesService) Delete(c *gin.Context) {
 		return
 	}
 
+	//токены удаленного сотрудника больше не действуют
+	if err := s.repo.AuthSessions.RevokeEmployee(deletedEmployee.ID); err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
 	NewResponse(c, http.StatusOK, nil)
 }
@@ -0,0 +1,107 @@
+package myservice
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iivkis/pos.7-era.backend/internal/repository"
+)
+
+type IngredientPriceOutputModel struct {
+	ID           uint    `json:"id"`
+	Reason       int     `json:"reason"`    // 1 - поступление, 2 - ручное изменение, 3 - начальная цена, 4 - смена единицы хранения
+	SourceID     uint    `json:"source_id"` // id документа-основания (поступление, ингредиент)
+	Price        float64 `json:"price"`     // закупочная цена после изменения
+	PriceBefore  float64 `json:"price_before"`
+	ArrivalCount float64 `json:"arrival_count"`
+	ArrivalPrice float64 `json:"arrival_price"`
+	CountBefore  float64 `json:"count_before"`
+	Date         int64   `json:"date"` //unixmilli
+	IngredientID uint    `json:"ingredient_id"`
+	EmployeeID   uint    `json:"employee_id"`
+	OutletID     uint    `json:"outlet_id"`
+}
+
+type IngredientPricesService struct {
+	repo *repository.Repository
+}
+
+func newIngredientPricesService(repo *repository.Repository) *IngredientPricesService {
+	return &IngredientPricesService{
+		repo: repo,
+	}
+}
+
+type IngredientPricesGetAllQuery struct {
+	IngredientID uint   `form:"ingredient_id"`
+	Reason       int    `form:"reason" binding:"min=0,max=3"`
+	Start        uint64 `form:"start"` //in unixmilli
+	End          uint64 `form:"end"`   //in unixmilli
+}
+
+type IngredientPricesGetAllOutput []IngredientPriceOutputModel
+
+//@Summary История закупочных цен ингредиентов
+//@Description Закупочная цена пересчитывается при каждом поступлении как средневзвешенная по остатку и поступлению.
+//@Description Поддерживает `offset`, `limit` и `sort` (id, date, price) из стандартного query.
+//@Description Общее кол-во записей возвращается в заголовке `X-Total-Count`
+//@Description Без `limit` возвращается 100 записей, если указаны `offset` или `sort`, иначе - до 1000 записей
+//@param type query IngredientPricesGetAllQuery false "Принимаемый объект"
+//@Accept json
+//@Produce json
+//@Success 200 {object} IngredientPricesGetAllOutput "возвращаемый объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /ingredients.Prices [get]
+func (s *IngredientPricesService) GetAll(c *gin.Context) {
+	var query IngredientPricesGetAllQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	where := &repository.IngredientPriceModel{
+		Reason:       query.Reason,
+		IngredientID: query.IngredientID,
+		OrgID:        claims.OrganizationID,
+		OutletID:     claims.OutletID,
+	}
+
+	if claims.HasRole(repository.R_OWNER) {
+		if stdQuery.OrgID != 0 && s.repo.Invitation.Exists(&repository.InvitationModel{OrgID: claims.OrganizationID, AffiliateOrgID: stdQuery.OrgID}) {
+			where.OrgID = stdQuery.OrgID
+		}
+	}
+
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		where.OutletID = stdQuery.OutletID
+	}
+
+	prices, total, err := s.repo.IngredientPrices.FindPage(where, stdQuery.listOptions(query.Start, query.End))
+	if err != nil {
+		listError(c, err)
+		return
+	}
+	setTotalCount(c, total)
+
+	output := make(IngredientPricesGetAllOutput, len(*prices))
+	for i, item := range *prices {
+		output[i] = IngredientPriceOutputModel{
+			ID:           item.ID,
+			Reason:       item.Reason,
+			SourceID:     item.SourceID,
+			Price:        item.Price,
+			PriceBefore:  item.PriceBefore,
+			ArrivalCount: item.ArrivalCount,
+			ArrivalPrice: item.ArrivalPrice,
+			CountBefore:  item.CountBefore,
+			Date:         item.Date,
+			IngredientID: item.IngredientID,
+			EmployeeID:   item.EmployeeID,
+			OutletID:     item.OutletID,
+		}
+	}
+	NewResponse(c, http.StatusOK, output)
+}
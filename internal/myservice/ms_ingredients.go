@@ -9,6 +9,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/iivkis/pos.7-era.backend/internal/repository"
+	"github.com/iivkis/pos.7-era.backend/pkg/authjwt"
 	"gorm.io/gorm"
 )
 
@@ -17,10 +18,17 @@ type IngredientOutputModel struct {
 	Name          string  `json:"name"`
 	Count         float64 `json:"count"`
 	MeasureUnit   int     `json:"measure_unit"`
+	PackSize      float64 `json:"pack_size"` // размер упаковки в единицах хранения (0 - не задан)
 	PurchasePrice float64 `json:"purchase_price"`
+	Version       uint    `json:"version"`       // версия остатков, меняется при каждом изменении count
+	MinCount      float64 `json:"min_count"`     // минимальный остаток (0 - не отслеживается)
+	ReorderCount  float64 `json:"reorder_count"` // сколько заказывать при пополнении
 	OutletID      uint    `json:"outlet_id"`
 }
 
+//кол-во попыток записать остаток, если его одновременно изменили (продажа, поступление)
+const stockUpdateMaxAttempts = 3
+
 type IngredientsService struct {
 	repo *repository.Repository
 }
@@ -35,7 +43,10 @@ type IngredientCreateInput struct {
 	Name          string  `json:"name" binding:"required"`
 	Count         float64 `json:"count" binding:"min=0"`
 	PurchasePrice float64 `json:"purchase_price" binding:"min=0"`
-	MeasureUnit   int     `json:"measure_unit" binding:"min=1,max=3"`
+	MeasureUnit   int     `json:"measure_unit" binding:"min=1,max=5"`
+	PackSize      float64 `json:"pack_size" binding:"min=0"`
+	MinCount      float64 `json:"min_count" binding:"min=0"`
+	ReorderCount  float64 `json:"reorder_count" binding:"min=0"`
 }
 
 // @Summary Добавить новый ингредиент в точку
@@ -60,6 +71,9 @@ func (s *IngredientsService) Create(c *gin.Context) {
 		Count:         input.Count,
 		PurchasePrice: input.PurchasePrice,
 		MeasureUnit:   input.MeasureUnit,
+		PackSize:      input.PackSize,
+		MinCount:      input.MinCount,
+		ReorderCount:  input.ReorderCount,
 		OutletID:      claims.OutletID,
 		OrgID:         claims.OrganizationID,
 	}
@@ -70,7 +84,42 @@ func (s *IngredientsService) Create(c *gin.Context) {
 		}
 	}
 
-	if err := s.repo.Ingredients.Create(&ingredient); err != nil {
+	//начальный остаток записывается в журнал движения, начальная цена - в историю цен
+	err := s.repo.Transaction(func(tx *repository.Repository) error {
+		if err := tx.Ingredients.Create(&ingredient); err != nil {
+			return err
+		}
+
+		now := time.Now().UTC().UnixMilli()
+
+		if err := tx.StockMovements.Create(&repository.StockMovementModel{
+			Reason:       repository.STOCK_MOVE_OPENING,
+			SourceID:     ingredient.ID,
+			Delta:        ingredient.Count,
+			Balance:      ingredient.Count,
+			Date:         now,
+			IngredientID: ingredient.ID,
+			EmployeeID:   claims.EmployeeID,
+			OutletID:     ingredient.OutletID,
+			OrgID:        ingredient.OrgID,
+		}); err != nil {
+			return err
+		}
+
+		return tx.IngredientPrices.Create(&repository.IngredientPriceModel{
+			Reason:       repository.PRICE_CHANGE_OPENING,
+			SourceID:     ingredient.ID,
+			Price:        ingredient.PurchasePrice,
+			PriceBefore:  ingredient.PurchasePrice,
+			CountBefore:  ingredient.Count,
+			Date:         now,
+			IngredientID: ingredient.ID,
+			EmployeeID:   claims.EmployeeID,
+			OutletID:     ingredient.OutletID,
+			OrgID:        ingredient.OrgID,
+		})
+	})
+	if err != nil {
 		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
 		return
 	}
@@ -113,26 +162,90 @@ func (s *IngredientsService) GetAll(c *gin.Context) {
 			Name:          ingredient.Name,
 			Count:         ingredient.Count,
 			MeasureUnit:   ingredient.MeasureUnit,
+			PackSize:      ingredient.PackSize,
 			PurchasePrice: ingredient.PurchasePrice,
+			Version:       ingredient.Version,
+			MinCount:      ingredient.MinCount,
+			ReorderCount:  ingredient.ReorderCount,
 			OutletID:      ingredient.OutletID,
 		}
 	}
 	NewResponse(c, http.StatusOK, output)
 }
 
+type IngredientLowStockOutputModel struct {
+	ID           uint    `json:"id"`
+	Name         string  `json:"name"`
+	Count        float64 `json:"count"`
+	MinCount     float64 `json:"min_count"`
+	ReorderCount float64 `json:"reorder_count"`
+	MeasureUnit  int     `json:"measure_unit"`
+	Negative     bool    `json:"negative"` // остаток отрицательный
+	OutletID     uint    `json:"outlet_id"`
+}
+
+type IngredientGetLowStockOutput []IngredientLowStockOutputModel
+
+// @Summary Получить ингредиенты точки, остаток которых ниже минимального или отрицательный
+// @Accept json
+// @Produce json
+// @Success 200 {object} IngredientGetLowStockOutput "возвращает ингредиенты, которые пора пополнить"
+// @Failure 400 {object} serviceError
+// @Failure 500 {object} serviceError
+// @Router /ingredients.LowStock [get]
+func (s *IngredientsService) GetLowStock(c *gin.Context) {
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	where := &repository.IngredientModel{
+		OrgID:    claims.OrganizationID,
+		OutletID: claims.OutletID,
+	}
+
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		where.OutletID = stdQuery.OutletID
+	}
+
+	ingredients, err := s.repo.Ingredients.FindLowStock(where)
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	output := make(IngredientGetLowStockOutput, len(*ingredients))
+	for i, ingredient := range *ingredients {
+		output[i] = IngredientLowStockOutputModel{
+			ID:           ingredient.ID,
+			Name:         ingredient.Name,
+			Count:        ingredient.Count,
+			MinCount:     ingredient.MinCount,
+			ReorderCount: ingredient.ReorderCount,
+			MeasureUnit:  ingredient.MeasureUnit,
+			Negative:     ingredient.Count < 0,
+			OutletID:     ingredient.OutletID,
+		}
+	}
+	NewResponse(c, http.StatusOK, output)
+}
+
 type IngredientUpdateInput struct {
 	Name          *string  `json:"name,omitempty"`
 	Count         *float64 `json:"count,omitempty"`
 	PurchasePrice *float64 `json:"purchase_price,omitempty"`
-	MeasureUnit   *int     `json:"measure_unit,omitempty"`
+	MeasureUnit   *int     `json:"measure_unit,omitempty"` // только в пределах величины (кг <-> г, л <-> мл): остатки, цена и рецепты пересчитываются
+	PackSize      *float64 `json:"pack_size,omitempty"`
+	Version       *uint    `json:"version,omitempty"` // если указана вместе с `count`, то остаток изменится, только если его версия не менялась
+	MinCount      *float64 `json:"min_count,omitempty"`
+	ReorderCount  *float64 `json:"reorder_count,omitempty"`
 }
 
 // @Summary Обновить ингредиент
+// @Description При смене `measure_unit` остальные значения запроса принимаются уже в новой единице
 // @param type body IngredientUpdateInput false "Обновляемые поля"
 // @Success 200 {object} object "возвращает пустой объект"
 // @Accept json
 // @Produce json
 // @Failure 400 {object} serviceError
+// @Failure 409 {object} serviceError "версия остатков изменилась (если указана `version`)"
 // @Failure 500 {object} serviceError
 // @Router /ingredients [put]
 func (s *IngredientsService) UpdateFields(c *gin.Context) {
@@ -168,26 +281,119 @@ func (s *IngredientsService) UpdateFields(c *gin.Context) {
 			}
 		}
 
-		if input.PurchasePrice != nil {
-			updated["purchase_price"] = *input.PurchasePrice
+		if input.PurchasePrice != nil && *input.PurchasePrice < 0 {
+			NewResponse(c, http.StatusBadRequest, errIncorrectInputData("purchase_price >= 0"))
+			return
+		}
+
+		if input.MinCount != nil {
+			if *input.MinCount < 0 {
+				NewResponse(c, http.StatusBadRequest, errIncorrectInputData("min_count >= 0"))
+				return
+			}
+			updated["min_count"] = *input.MinCount
 		}
 
-		if input.Count != nil {
-			updated["count"] = *input.Count
+		if input.ReorderCount != nil {
+			if *input.ReorderCount < 0 {
+				NewResponse(c, http.StatusBadRequest, errIncorrectInputData("reorder_count >= 0"))
+				return
+			}
+			updated["reorder_count"] = *input.ReorderCount
 		}
 
 		if input.MeasureUnit != nil {
-			if *input.MeasureUnit < 1 || *input.MeasureUnit > 3 {
-				NewResponse(c, http.StatusBadRequest, errIncorrectInputData("1 <= measure_unit <= 3"))
+			if !repository.IsStockUnit(*input.MeasureUnit) {
+				NewResponse(c, http.StatusBadRequest, errIncorrectInputData("1 <= measure_unit <= 5"))
+				return
+			}
+		}
+
+		if input.PackSize != nil {
+			if *input.PackSize < 0 {
+				NewResponse(c, http.StatusBadRequest, errIncorrectInputData("pack_size >= 0"))
 				return
 			}
-			updated["measure_unit"] = *input.MeasureUnit
+			updated["pack_size"] = *input.PackSize
 		}
 
 	}
 
-	if err := s.repo.Ingredients.UpdatesFull(where, &updated); err != nil {
-		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+	//поля и остаток меняются в одной транзакции, изменение остатка записывается в журнал.
+	//Если версия не указана, то при одновременном изменении остаток читается заново
+	for attempt := 0; attempt < stockUpdateMaxAttempts; attempt++ {
+		err = s.repo.Transaction(func(tx *repository.Repository) error {
+			//единица меняется первой: остальные значения передаются уже в новой единице
+			if input.MeasureUnit != nil {
+				ingredient, err := tx.Ingredients.FindFirts(where)
+				if err != nil {
+					return err
+				}
+
+				if input.Count != nil && input.Version != nil && *input.Version != ingredient.Version {
+					return repository.ErrStockVersionConflict
+				}
+
+				if err := tx.Ingredients.ChangeUnit(ingredient.ID, *input.MeasureUnit, claims.EmployeeID); err != nil {
+					return err
+				}
+			}
+
+			if len(updated) != 0 {
+				if err := tx.Ingredients.UpdatesFull(where, &updated); err != nil {
+					return err
+				}
+			}
+
+			if input.Count == nil && input.PurchasePrice == nil {
+				return nil
+			}
+
+			ingredient, err := tx.Ingredients.FindFirts(where)
+			if err != nil {
+				return err
+			}
+
+			//ручное изменение цены записывается в историю цен
+			if input.PurchasePrice != nil {
+				if err := tx.Ingredients.SetPurchasePrice(ingredient.ID, *input.PurchasePrice, claims.EmployeeID); err != nil {
+					return err
+				}
+			}
+
+			if input.Count == nil {
+				return nil
+			}
+
+			//при смене единицы версия уже проверена и увеличена
+			if input.Version != nil && input.MeasureUnit == nil && *input.Version != ingredient.Version {
+				return repository.ErrStockVersionConflict
+			}
+
+			return tx.Ingredients.SetCount(ingredient, *input.Count, repository.StockMovementModel{
+				Reason:     repository.STOCK_MOVE_MANUAL,
+				SourceID:   ingredient.ID,
+				EmployeeID: claims.EmployeeID,
+			})
+		})
+		if input.Version != nil || !errors.Is(err, repository.ErrStockVersionConflict) {
+			break
+		}
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrStockVersionConflict):
+			NewResponse(c, http.StatusConflict, errStockConflict(err.Error()))
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			NewResponse(c, http.StatusBadRequest, errRecordNotFound("undefined ingredient with this id"))
+		case errors.Is(err, repository.ErrIncompatibleUnit):
+			NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		case errors.Is(err, repository.ErrInventoryAlreadyOpen):
+			NewResponse(c, http.StatusBadRequest, errIncorrectInputData("measure_unit can't be changed while the outlet has an open inventory"))
+		default:
+			NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		}
 		return
 	}
 	NewResponse(c, http.StatusOK, nil)
@@ -252,8 +458,9 @@ func (s *IngredientsService) Delete(c *gin.Context) {
 type IngredientArrivalInput struct {
 	IngredientID uint    `json:"ingredient_id" binding:"min=1"`
 	Count        float64 `json:"count" binding:"min=0"`
+	Unit         int     `json:"unit" binding:"min=0,max=6"` // единица `count` и `price` (0 - единица хранения ингредиента)
 	WriteOff     bool    `json:"write_off"`
-	Price        float64 `json:"price" binding:"min=0"`
+	Price        float64 `json:"price" binding:"min=0"` // цена за единицу
 	Date         int64   `json:"date" binding:"min=1"`
 }
 
@@ -279,8 +486,6 @@ func (s *IngredientsService) Arrival(c *gin.Context) {
 
 	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
 
-	ingredients := make([]*repository.IngredientModel, len(input))
-
 	where := &repository.IngredientModel{
 		OutletID: claims.OutletID,
 		OrgID:    claims.OrganizationID,
@@ -288,37 +493,132 @@ func (s *IngredientsService) Arrival(c *gin.Context) {
 
 	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
 		if stdQuery.OutletID != 0 && s.repo.Outlets.ExistsInOrg(stdQuery.OutletID, claims.OrganizationID) {
-			where.OutletID = claims.OutletID
+			where.OutletID = stdQuery.OutletID
 		}
 	}
 
-	//получение инфы об ингредиентах
+	//проверка ингредиентов, кол-во и цена переводятся в единицы хранения
 	for i, arrival := range input {
 		where.ID = arrival.IngredientID
 		ingredient, err := s.repo.Ingredients.FindFirts(where)
 		if err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				NewResponse(c, http.StatusBadRequest, errRecordNotFound(fmt.Sprintf("undefined ingredent with id `%d`", where.ID)))
-			} else {
-				NewResponse(c, http.StatusBadRequest, errUnknown(err.Error()))
-			}
+			NewResponse(c, http.StatusBadRequest, errRecordNotFound(fmt.Sprintf("undefined ingredent with id `%d`", where.ID)))
+			return
+		}
+
+		count, serr := convertIngredientCount(ingredient, arrival.Count, arrival.Unit)
+		if serr != nil {
+			NewResponse(c, http.StatusBadRequest, serr)
+			return
+		}
+
+		price, err := repository.ConvertPrice(arrival.Price, arrival.Unit, ingredient)
+		if err != nil {
+			NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+			return
+		}
+		input[i].Count, input[i].Price, input[i].Unit = count, price, 0
+	}
+
+	//остатки, история и касса меняются в одной транзакции
+	err := s.repo.Transaction(func(tx *repository.Repository) error {
+		return receiveIngredients(tx, claims, where.OutletID, input, "receipt of goods")
+	})
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	NewResponse(c, http.StatusCreated, nil)
+}
+
+type IngredientWriteOffInput struct {
+	IngredientID uint    `json:"ingredient_id" binding:"min=1"`
+	Count        float64 `json:"count" binding:"gt=0"`
+	Unit         int     `json:"unit" binding:"min=0,max=6"` // единица `count` (0 - единица хранения ингредиента)
+}
+
+// @Summary Списание ингредиентов (порча, бой)
+// @param type body []IngredientWriteOffInput false "Принимаемый объект"
+// @Accept json
+// @Produce json
+// @Success 201 {object} object "возвращает пустой объект"
+// @Failure 400 {object} serviceError
+// @Failure 500 {object} serviceError
+// @Router /ingredients.WriteOff [post]
+func (s *IngredientsService) WriteOff(c *gin.Context) {
+	var input []IngredientWriteOffInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	if len(input) > 100 {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData("you can't transfer more than 100 objects"))
+		return
+	}
+
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	where := &repository.IngredientModel{
+		OutletID: claims.OutletID,
+		OrgID:    claims.OrganizationID,
+	}
+
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		if stdQuery.OutletID != 0 && s.repo.Outlets.ExistsInOrg(stdQuery.OutletID, claims.OrganizationID) {
+			where.OutletID = stdQuery.OutletID
+		}
+	}
+
+	//проверка ингредиентов, кол-во переводится в единицы хранения
+	for i, item := range input {
+		where.ID = item.IngredientID
+		ingredient, err := s.repo.Ingredients.FindFirts(where)
+		if err != nil {
+			NewResponse(c, http.StatusBadRequest, errRecordNotFound(fmt.Sprintf("undefined ingredent with id `%d`", where.ID)))
 			return
 		}
-		ingredients[i] = ingredient
+
+		count, serr := convertIngredientCount(ingredient, item.Count, item.Unit)
+		if serr != nil {
+			NewResponse(c, http.StatusBadRequest, serr)
+			return
+		}
+		input[i].Count, input[i].Unit = count, 0
+	}
+
+	err := s.repo.Transaction(func(tx *repository.Repository) error {
+		for _, item := range input {
+			if err := tx.Ingredients.AddCount(item.IngredientID, -item.Count, repository.StockMovementModel{
+				Reason:     repository.STOCK_MOVE_WRITE_OFF,
+				EmployeeID: claims.EmployeeID,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
 	}
 
-	//обновление и добавление в историю (ingredientsAddingHistory)
+	NewResponse(c, http.StatusCreated, nil)
+}
+
+//receiveIngredients - поступление ингредиентов в точку в транзакции tx: остатки (с записью в журнал движения),
+//история поступлений и запись в кассе о сумме, оплаченной из кассы (`write_off`). reason - причина в записи кассы.
+//Кол-во и цена в input - в единицах хранения ингредиентов
+func receiveIngredients(tx *repository.Repository, claims *authjwt.EmployeeClaims, outletID uint, input []IngredientArrivalInput, reason string) error {
 	var writeOffSum float64
-	for i, arrival := range input {
+	for _, arrival := range input {
 		if arrival.WriteOff {
 			writeOffSum += arrival.Price * arrival.Count
 		}
 
-		ingredients[i].Count += arrival.Count
-		s.repo.Ingredients.Updates(&repository.IngredientModel{ID: arrival.IngredientID}, ingredients[i])
-
 		//добавление в историю
-		if err := s.repo.IngredientsAddingHistory.Create(&repository.IngredientsAddingHistoryModel{
+		history := repository.IngredientsAddingHistoryModel{
 			Count:  arrival.Count,
 			Total:  arrival.Count * arrival.Price,
 			Status: 3,
@@ -326,27 +626,70 @@ func (s *IngredientsService) Arrival(c *gin.Context) {
 
 			IngredientID: arrival.IngredientID,
 			EmployeeID:   claims.EmployeeID,
-			OutletID:     claims.OutletID,
+			OutletID:     outletID,
 			OrgID:        claims.OrganizationID,
+		}
+
+		if err := tx.IngredientsAddingHistory.Create(&history); err != nil {
+			return err
+		}
+
+		//закупочная цена пересчитывается как средневзвешенная
+		if err := tx.Ingredients.Receive(arrival.IngredientID, arrival.Count, arrival.Price, repository.StockMovementModel{
+			Reason:     repository.STOCK_MOVE_ARRIVAL,
+			SourceID:   history.ID,
+			EmployeeID: claims.EmployeeID,
 		}); err != nil {
-			NewResponse(c, http.StatusBadRequest, errUnknown(err.Error()))
+			return err
 		}
 	}
 
 	//добавление инфы в кассу
-	model := &repository.CashChangesModel{
+	return tx.CashChanges.Create(&repository.CashChangesModel{
 		Date:       time.Now().UTC().UnixMilli(),
 		Total:      writeOffSum,
-		Reason:     "receipt of goods",
+		Reason:     reason,
 		EmployeeID: claims.EmployeeID,
-		OutletID:   claims.OutletID,
+		OutletID:   outletID,
 		OrgID:      claims.OrganizationID,
-	}
+	})
+}
 
-	if err := s.repo.CashChanges.Create(model); err != nil {
-		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
-		return
+type UnitOutputModel struct {
+	ID        int     `json:"id"`
+	Name      string  `json:"name"`
+	Dimension int     `json:"dimension"` // 1 - масса, 2 - объем, 3 - количество, 0 - зависит от ингредиента (упаковка)
+	Factor    float64 `json:"factor"`    // сколько базовых единиц (кг, л, шт) в одной единице (0 - зависит от ингредиента)
+	Stock     bool    `json:"stock"`     // можно использовать как единицу хранения ингредиента
+}
+
+type UnitsGetAllOutput []UnitOutputModel
+
+// @Summary Единицы измерения
+// @Description Рецепты, поступления, списания и инвентаризации принимают кол-во в любой единице той же величины, что и единица хранения ингредиента,
+// @Description или в упаковках (если у ингредиента задан `pack_size`). Кол-во переводится в единицы хранения при записи
+// @Produce json
+// @Success 200 {object} UnitsGetAllOutput "возвращает все единицы измерения"
+// @Router /ingredients.Units [get]
+func (s *IngredientsService) GetUnits(c *gin.Context) {
+	output := make(UnitsGetAllOutput, len(repository.Units))
+	for i, unit := range repository.Units {
+		output[i] = UnitOutputModel{
+			ID:        unit.ID,
+			Name:      unit.Name,
+			Dimension: unit.Dimension,
+			Factor:    unit.Factor,
+			Stock:     repository.IsStockUnit(unit.ID),
+		}
 	}
+	NewResponse(c, http.StatusOK, output)
+}
 
-	NewResponse(c, http.StatusCreated, nil)
+//convertIngredientCount - переводит count единиц unit в единицы хранения ингредиента
+func convertIngredientCount(ingredient *repository.IngredientModel, count float64, unit int) (float64, *serviceError) {
+	converted, err := repository.ConvertCount(count, unit, ingredient)
+	if err != nil {
+		return 0, errIncorrectInputData(err.Error())
+	}
+	return converted, nil
 }
@@ -95,6 +95,10 @@ type IngredientsAddingHistorytGetAllInput struct {
 type IngredientsAddingHistorytGetAllOutput []IngredientsAddingHistoryOutputModel
 
 //@Summary Получить историю добавления ингредиентов
+//@Description Поддерживает `offset`, `limit` и `sort` (id, date, count, total) из стандартного query.
+//@Description Общее кол-во записей возвращается в заголовке `X-Total-Count`
+//@Description Без `limit` возвращается 100 записей, если указаны `offset` или `sort`, иначе - до 1000 записей
+//@param type query IngredientsAddingHistorytGetAllInput false "Принимаемый объект"
 //@Accept json
 //@Produce json
 //@Success 200 {object} IngredientsAddingHistorytGetAllOutput "возвращаемый объект"
@@ -123,11 +127,12 @@ func (s *IngredientsAddingHistoryService) GetAll(c *gin.Context) {
 		where.OutletID = stdQuery.OutletID
 	}
 
-	histories, err := s.repo.IngredientsAddingHistory.FindWithPeriod(where, query.Start, query.End)
+	histories, total, err := s.repo.IngredientsAddingHistory.FindPage(where, stdQuery.listOptions(query.Start, query.End))
 	if err != nil {
-		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		listError(c, err)
 		return
 	}
+	setTotalCount(c, total)
 
 	var output = make(IngredientsAddingHistorytGetAllOutput, len(*histories))
 	for i, item := range *histories {
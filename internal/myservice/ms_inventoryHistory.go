@@ -1,17 +1,25 @@
 package myservice
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/iivkis/pos.7-era.backend/internal/repository"
+	"gorm.io/gorm"
 )
 
 type InventoryHistoryOutputModel struct {
-	ID         uint  `json:"id"`
-	Date       int64 `json:"date"`        //unixmilli
-	EmployeeID uint  `json:"employee_id"` //сотрудник, который делал инветаризацию
-	OutletID   uint  `json:"outlet_id"`
+	ID          uint  `json:"id"`
+	Status      int   `json:"status"`       // 1 - открыта, 2 - проведена, 3 - отменена
+	Date        int64 `json:"date"`         //unixmilli
+	CommittedAt int64 `json:"committed_at"` //unixmilli
+	EmployeeID  uint  `json:"employee_id"`  //сотрудник, который делал инветаризацию
+	CommittedBy uint  `json:"committed_by"` //сотрудник, который провел инвентаризацию
+	OutletID    uint  `json:"outlet_id"`
 }
 
 type InventoryHistoryService struct {
@@ -60,13 +68,17 @@ func (s *InventoryHistoryService) Create(c *gin.Context) {
 }
 
 type InventoryHistoryGetAllQuery struct {
-	Start uint64 `form:"start"` //in unixmilli
-	End   uint64 `form:"end"`   //in unixmilli
+	Status int    `form:"status" binding:"min=0,max=3"`
+	Start  uint64 `form:"start"` //in unixmilli
+	End    uint64 `form:"end"`   //in unixmilli
 }
 
 type InventoryHistoryGetAllOutput []InventoryHistoryOutputModel
 
 //@Summary Получить всю историю инвернтаризации
+//@Description Поддерживает `offset`, `limit` и `sort` (id, date) из стандартного query.
+//@Description Общее кол-во записей возвращается в заголовке `X-Total-Count`
+//@Description Без `limit` возвращается 100 записей, если указаны `offset` или `sort`, иначе - до 1000 записей
 //@param type query InventoryHistoryGetAllQuery false "Принимаемый объект"
 //@Accept json
 //@Produce json
@@ -84,6 +96,7 @@ func (s *InventoryHistoryService) GetAll(c *gin.Context) {
 	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
 
 	where := &repository.InventoryHistoryModel{
+		Status:   query.Status,
 		OrgID:    claims.OrganizationID,
 		OutletID: claims.OutletID,
 	}
@@ -98,20 +111,458 @@ func (s *InventoryHistoryService) GetAll(c *gin.Context) {
 		where.OutletID = stdQuery.OutletID
 	}
 
-	invetoryHistoryList, err := s.repo.InventoryHistory.FindWithPeriod(where, query.Start, query.End)
+	invetoryHistoryList, total, err := s.repo.InventoryHistory.FindPage(where, stdQuery.listOptions(query.Start, query.End))
 	if err != nil {
-		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		listError(c, err)
 		return
 	}
+	setTotalCount(c, total)
 
 	var output InventoryHistoryGetAllOutput = make(InventoryHistoryGetAllOutput, len(*invetoryHistoryList))
 	for i, item := range *invetoryHistoryList {
 		output[i] = InventoryHistoryOutputModel{
-			ID:         item.ID,
-			Date:       item.Date,
-			EmployeeID: item.EmployeeID,
-			OutletID:   item.OutletID,
+			ID:          item.ID,
+			Status:      item.Status,
+			Date:        item.Date,
+			CommittedAt: item.CommittedAt,
+			EmployeeID:  item.EmployeeID,
+			CommittedBy: item.CommittedBy,
+			OutletID:    item.OutletID,
+		}
+	}
+	NewResponse(c, http.StatusOK, output)
+}
+
+//errInventoryStatus - статус инвентаризации не позволяет выполнить операцию
+var errInventoryStatus = errors.New("inventory status does not allow this operation")
+
+//@Summary Открыть инвентаризацию
+//@Description Фиксирует ожидаемые остатки всех ингредиентов точки. Остатки не меняются, пока инвентаризация не проведена.
+//@Description В точке может быть только одна открытая инвентаризация
+//@param type body InventoryHistoryCreateInput false "Принимаемый объект"
+//@Accept json
+//@Produce json
+//@Success 201 {object} DefaultOutputModel "возвращает id созданной записи"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /inventoryHistory.Open [post]
+func (s *InventoryHistoryService) Open(c *gin.Context) {
+	var input InventoryHistoryCreateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	model := &repository.InventoryHistoryModel{
+		Date:       input.Date,
+		EmployeeID: claims.EmployeeID,
+		OutletID:   claims.OutletID,
+		OrgID:      claims.OrganizationID,
+	}
+
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		if stdQuery.OutletID != 0 && s.repo.Outlets.ExistsInOrg(stdQuery.OutletID, claims.OrganizationID) {
+			model.OutletID = stdQuery.OutletID
+		}
+	}
+
+	if model.Date == 0 {
+		model.Date = time.Now().UTC().UnixMilli()
+	}
+
+	err := s.repo.Transaction(func(tx *repository.Repository) error {
+		return tx.InventoryHistory.Open(model)
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrInventoryAlreadyOpen) {
+			NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+			return
+		}
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	NewResponse(c, http.StatusCreated, DefaultOutputModel{ID: model.ID})
+}
+
+type InventoryCountInput struct {
+	IngredientID uint    `json:"ingredient_id" binding:"min=1"`
+	Count        float64 `json:"count" binding:"min=0"`
+	Unit         int     `json:"unit" binding:"min=0,max=6"` // единица `count` (0 - единица хранения ингредиента)
+}
+
+type InventoryCountsInput struct {
+	Counts []InventoryCountInput `json:"counts" binding:"required,min=1,max=100,dive"`
+}
+
+//@Summary Передать пересчет ингредиентов в открытую инвентаризацию
+//@Description Несколько сотрудников могут считать разные места хранения: фактический остаток - сумма их пересчетов.
+//@Description Повторный пересчет ингредиента тем же сотрудником заменяет предыдущий
+//@param type body InventoryCountsInput false "Принимаемый объект"
+//@Accept json
+//@Produce json
+//@Success 200 {object} object "возвращает пустой объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /inventoryHistory/:id/counts [post]
+func (s *InventoryHistoryService) SubmitCounts(c *gin.Context) {
+	var input InventoryCountsInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	history, ok := s.findHistory(c)
+	if !ok {
+		return
+	}
+
+	claims := mustGetEmployeeClaims(c)
+
+	lines, err := s.repo.InventoryList.Find(&repository.InventoryListModel{InventoryHistoryID: history.ID})
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	inDraft := make(map[uint]bool, len(*lines))
+	for _, line := range *lines {
+		inDraft[line.IngredientID] = true
+	}
+
+	//кол-во переводится в единицы хранения ингредиента
+	for i, item := range input.Counts {
+		if !inDraft[item.IngredientID] {
+			NewResponse(c, http.StatusBadRequest, errRecordNotFound(fmt.Sprintf("ingredient with id `%d` is not in this inventory", item.IngredientID)))
+			return
+		}
+
+		if item.Unit == 0 {
+			continue
+		}
+
+		ingredient, err := s.repo.Ingredients.FindFirts(&repository.IngredientModel{ID: item.IngredientID})
+		if err != nil {
+			NewResponse(c, http.StatusBadRequest, errRecordNotFound(fmt.Sprintf("undefined ingredent with id `%d`", item.IngredientID)))
+			return
+		}
+
+		count, serr := convertIngredientCount(ingredient, item.Count, item.Unit)
+		if serr != nil {
+			NewResponse(c, http.StatusBadRequest, serr)
+			return
+		}
+		input.Counts[i].Count = count
+	}
+
+	now := time.Now().UTC().UnixMilli()
+
+	err = s.repo.Transaction(func(tx *repository.Repository) error {
+		if status, err := tx.InventoryHistory.LockStatus(history.ID); err != nil {
+			return err
+		} else if status != repository.INVENTORY_DRAFT {
+			return errInventoryStatus
+		}
+
+		for _, item := range input.Counts {
+			if err := tx.InventoryCounts.Submit(&repository.InventoryCountModel{
+				Count:              item.Count,
+				Date:               now,
+				InventoryHistoryID: history.ID,
+				IngredientID:       item.IngredientID,
+				EmployeeID:         claims.EmployeeID,
+				OutletID:           history.OutletID,
+				OrgID:              history.OrgID,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errInventoryStatus) {
+			NewResponse(c, http.StatusBadRequest, errIncorrectInputData("inventory is not open"))
+			return
+		}
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	NewResponse(c, http.StatusOK, nil)
+}
+
+type InventoryVarianceOutputModel struct {
+	InventoryListID uint    `json:"inventory_list_id"`
+	IngredientID    uint    `json:"ingredient_id"`
+	ExpectedCount   float64 `json:"expected_count"` // остаток в системе при открытии инвентаризации
+	Count           float64 `json:"count"`          // остаток в системе сейчас
+	Counted         bool    `json:"counted"`        // ингредиент пересчитан
+	CountedCount    float64 `json:"counted_count"`  // фактический остаток (сумма пересчетов)
+	Employees       int     `json:"employees"`      // кол-во сотрудников, пересчитавших ингредиент
+	Balance         float64 `json:"balance"`        // остаток в системе на момент последнего пересчета
+	Variance        float64 `json:"variance"`       // расхождение: факт - остаток на момент пересчета
+	LossPrice       float64 `json:"loss_price"`     // сумма недостачи по текущей закупочной цене (отрицательная - излишек)
+}
+
+type InventoryVariancesOutput []InventoryVarianceOutputModel
+
+//@Summary Расхождения открытой инвентаризации
+//@Description Расхождение считается относительно остатка на момент пересчета, поэтому продажи во время инвентаризации его не искажают
+//@Accept json
+//@Produce json
+//@Success 200 {object} InventoryVariancesOutput "возвращаемый объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /inventoryHistory/:id/variances [get]
+func (s *InventoryHistoryService) GetVariances(c *gin.Context) {
+	history, ok := s.findHistory(c)
+	if !ok {
+		return
+	}
+
+	lines, err := s.repo.InventoryList.Find(&repository.InventoryListModel{InventoryHistoryID: history.ID})
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	counts, err := s.repo.InventoryCounts.Find(&repository.InventoryCountModel{InventoryHistoryID: history.ID})
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+	totals := inventoryCountTotals(*counts)
+
+	ingredients, err := s.repo.Ingredients.Find(&repository.IngredientModel{OutletID: history.OutletID, OrgID: history.OrgID})
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	byID := make(map[uint]repository.IngredientModel, len(*ingredients))
+	for _, ingredient := range *ingredients {
+		byID[ingredient.ID] = ingredient
+	}
+
+	output := make(InventoryVariancesOutput, 0, len(*lines))
+	for _, line := range *lines {
+		ingredient, ok := byID[line.IngredientID]
+		if !ok {
+			continue //ингредиент удален
+		}
+
+		item := InventoryVarianceOutputModel{
+			InventoryListID: line.ID,
+			IngredientID:    line.IngredientID,
+			ExpectedCount:   line.OldCount,
+			Count:           ingredient.Count,
 		}
+
+		if total, ok := totals[line.IngredientID]; ok {
+			item.Counted = true
+			item.CountedCount = total.Count
+			item.Employees = total.Employees
+			item.Balance = total.Balance
+			item.Variance = total.Count - total.Balance
+			item.LossPrice = -item.Variance * ingredient.PurchasePrice
+		}
+		output = append(output, item)
 	}
 	NewResponse(c, http.StatusOK, output)
 }
+
+type InventoryCommitOutput struct {
+	Lines     int     `json:"lines"`      // кол-во проведенных позиций
+	LossPrice float64 `json:"loss_price"` // общая сумма недостачи (отрицательная - излишек)
+}
+
+//@Summary Провести инвентаризацию
+//@Description Остаток каждого пересчитанного ингредиента становится фактическим с учетом движения после пересчета:
+//@Description факт + (остаток сейчас - остаток на момент пересчета). Продажи во время инвентаризации не теряются.
+//@Description Непересчитанные ингредиенты не меняются и удаляются из инвентаризации. Все изменения выполняются в одной транзакции
+//@Accept json
+//@Produce json
+//@Success 200 {object} InventoryCommitOutput "возвращаемый объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /inventoryHistory/:id/commit [post]
+func (s *InventoryHistoryService) Commit(c *gin.Context) {
+	history, ok := s.findHistory(c)
+	if !ok {
+		return
+	}
+
+	claims := mustGetEmployeeClaims(c)
+
+	var output InventoryCommitOutput
+	err := s.repo.Transaction(func(tx *repository.Repository) error {
+		if status, err := tx.InventoryHistory.LockStatus(history.ID); err != nil {
+			return err
+		} else if status != repository.INVENTORY_DRAFT {
+			return errInventoryStatus
+		}
+
+		lines, err := tx.InventoryList.Find(&repository.InventoryListModel{InventoryHistoryID: history.ID})
+		if err != nil {
+			return err
+		}
+
+		counts, err := tx.InventoryCounts.Find(&repository.InventoryCountModel{InventoryHistoryID: history.ID})
+		if err != nil {
+			return err
+		}
+		totals := inventoryCountTotals(*counts)
+
+		for _, line := range *lines {
+			where := &repository.InventoryListModel{Model: gorm.Model{ID: line.ID}}
+
+			total, counted := totals[line.IngredientID]
+
+			ingredient, err := tx.Ingredients.FindFirts(&repository.IngredientModel{ID: line.IngredientID})
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				counted = false //ингредиент удален
+			} else if err != nil {
+				return err
+			}
+
+			if !counted {
+				if err := tx.InventoryList.Delete(where); err != nil {
+					return err
+				}
+				continue
+			}
+
+			lossPrice := (total.Balance - total.Count) * ingredient.PurchasePrice
+			if err := tx.InventoryList.UpdatesFull(where, &map[string]interface{}{
+				"old_count":  total.Balance,
+				"new_count":  total.Count,
+				"loss_price": lossPrice,
+			}); err != nil {
+				return err
+			}
+
+			//движение пишется и при совпадении остатков: в журнале видно, что остаток подтвержден
+			if err := tx.Ingredients.AddCount(line.IngredientID, total.Count-total.Balance, repository.StockMovementModel{
+				Reason:     repository.STOCK_MOVE_STOCKTAKE,
+				SourceID:   line.ID,
+				EmployeeID: claims.EmployeeID,
+			}); err != nil {
+				return err
+			}
+
+			output.Lines++
+			output.LossPrice += lossPrice
+		}
+
+		return tx.InventoryHistory.UpdatesFull(&repository.InventoryHistoryModel{Model: gorm.Model{ID: history.ID}}, &map[string]interface{}{
+			"status":       repository.INVENTORY_COMMITTED,
+			"committed_at": time.Now().UTC().UnixMilli(),
+			"committed_by": claims.EmployeeID,
+		})
+	})
+	if err != nil {
+		if errors.Is(err, errInventoryStatus) {
+			NewResponse(c, http.StatusBadRequest, errIncorrectInputData("inventory is not open"))
+			return
+		}
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	NewResponse(c, http.StatusOK, output)
+}
+
+//@Summary Отменить открытую инвентаризацию
+//@Description Остатки не меняются
+//@Accept json
+//@Produce json
+//@Success 200 {object} object "возвращает пустой объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /inventoryHistory/:id/cancel [post]
+func (s *InventoryHistoryService) Cancel(c *gin.Context) {
+	history, ok := s.findHistory(c)
+	if !ok {
+		return
+	}
+
+	err := s.repo.Transaction(func(tx *repository.Repository) error {
+		if status, err := tx.InventoryHistory.LockStatus(history.ID); err != nil {
+			return err
+		} else if status != repository.INVENTORY_DRAFT {
+			return errInventoryStatus
+		}
+
+		return tx.InventoryHistory.UpdatesFull(&repository.InventoryHistoryModel{Model: gorm.Model{ID: history.ID}}, &map[string]interface{}{
+			"status": repository.INVENTORY_CANCELLED,
+		})
+	})
+	if err != nil {
+		if errors.Is(err, errInventoryStatus) {
+			NewResponse(c, http.StatusBadRequest, errIncorrectInputData("inventory is not open"))
+			return
+		}
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	NewResponse(c, http.StatusOK, nil)
+}
+
+//findHistory - инвентаризация из параметра `id` в пределах точки (организации для владельца и директора)
+func (s *InventoryHistoryService) findHistory(c *gin.Context) (*repository.InventoryHistoryModel, bool) {
+	historyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return nil, false
+	}
+
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	where := &repository.InventoryHistoryModel{
+		Model:    gorm.Model{ID: uint(historyID)},
+		OutletID: claims.OutletID,
+		OrgID:    claims.OrganizationID,
+	}
+
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		where.OutletID = stdQuery.OutletID
+	}
+
+	history, err := s.repo.InventoryHistory.FindFirst(where)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NewResponse(c, http.StatusBadRequest, errRecordNotFound("undefined inventory with this id"))
+			return nil, false
+		}
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return nil, false
+	}
+	return history, true
+}
+
+//inventoryCountTotal - пересчеты одного ингредиента всеми сотрудниками
+type inventoryCountTotal struct {
+	Count     float64 // сумма пересчетов
+	Balance   float64 // остаток в системе на момент последнего пересчета
+	Position  uint    // позиция в журнале движения последнего пересчета
+	Employees int
+}
+
+//inventoryCountTotals - суммирует пересчеты по ингредиентам
+func inventoryCountTotals(counts []repository.InventoryCountModel) map[uint]inventoryCountTotal {
+	totals := make(map[uint]inventoryCountTotal)
+	for _, count := range counts {
+		total, ok := totals[count.IngredientID]
+		if !ok || count.Position >= total.Position {
+			total.Position = count.Position
+			total.Balance = count.Balance
+		}
+		total.Count += count.Count
+		total.Employees++
+		totals[count.IngredientID] = total
+	}
+	return totals
+}
@@ -1,6 +1,7 @@
 package myservice
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -30,6 +31,7 @@ func newInventoryListService(repo *repository.Repository) *InventoryListService
 
 type InventoryListCreateInput struct {
 	NewCount           float64 `json:"new_count"`
+	Unit               int     `json:"unit" binding:"min=0,max=6"` // единица `new_count` (0 - единица хранения ингредиента)
 	IngredientID       uint    `json:"ingredient_id"`
 	InventoryHistoryID uint    `json:"inventory_history_id"`
 }
@@ -50,45 +52,79 @@ func (s *InventoryListService) Create(c *gin.Context) {
 
 	claims := mustGetEmployeeClaims(c)
 
-	if !s.repo.Ingredients.Exists(&repository.IngredientModel{ID: input.IngredientID, OutletID: claims.OutletID}) {
+	ingredient, err := s.repo.Ingredients.FindFirts(&repository.IngredientModel{ID: input.IngredientID, OutletID: claims.OutletID})
+	if err != nil {
 		NewResponse(c, http.StatusBadRequest, errIncorrectInputData("undefined `ingredient` with this `id in outlet`"))
 		return
 	}
 
-	if !s.repo.InventoryHistory.Exists(&repository.InventoryHistoryModel{Model: gorm.Model{ID: input.InventoryHistoryID}, OutletID: claims.OutletID}) {
-		NewResponse(c, http.StatusBadRequest, errIncorrectInputData("undefined `inventoryHistory` with this `id` in outlet"))
+	newCount, serr := convertIngredientCount(ingredient, input.NewCount, input.Unit)
+	if serr != nil {
+		NewResponse(c, http.StatusBadRequest, serr)
 		return
 	}
 
-	ingredient, err := s.repo.Ingredients.FindFirts(&repository.IngredientModel{ID: input.IngredientID})
-	if err != nil {
-		NewResponse(c, http.StatusBadRequest, errUnknown(err.Error()))
+	if !s.repo.InventoryHistory.Exists(&repository.InventoryHistoryModel{Model: gorm.Model{ID: input.InventoryHistoryID}, OutletID: claims.OutletID}) {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData("undefined `inventoryHistory` with this `id` in outlet"))
 		return
 	}
 
 	model := &repository.InventoryListModel{
-		OldCount:           ingredient.Count,
-		NewCount:           input.NewCount,
+		NewCount:           newCount,
 		IngredientID:       input.IngredientID,
 		InventoryHistoryID: input.InventoryHistoryID,
 		OutletID:           claims.OutletID,
 		OrgID:              claims.OrganizationID,
-		LossPrice:          0,
 	}
 
-	if model.OldCount != model.NewCount {
-		model.LossPrice = (model.OldCount - model.NewCount) * ingredient.PurchasePrice
-
-		if err := s.repo.Ingredients.Updates(
-			&repository.IngredientModel{ID: ingredient.ID},
-			&repository.IngredientModel{Count: model.NewCount},
-		); err != nil {
-			NewResponse(c, http.StatusBadRequest, errUnknown(err.Error()))
-			return
+	//остаток перезаписывается, только если его не изменили с момента чтения (продажа, поступление).
+	//Иначе остаток читается заново
+	for attempt := 0; attempt < stockUpdateMaxAttempts; attempt++ {
+		err = s.repo.Transaction(func(tx *repository.Repository) error {
+			//позиции с немедленной перезаписью остатка пишутся только в проведенную инвентаризацию:
+			//в открытую передается пересчет (остатки меняются при ее проведении), в отмененную - ничего
+			status, err := tx.InventoryHistory.LockStatus(input.InventoryHistoryID)
+			if err != nil {
+				return err
+			}
+			if status != repository.INVENTORY_COMMITTED {
+				return errInventoryStatus
+			}
+
+			ingredient, err := tx.Ingredients.FindFirts(&repository.IngredientModel{ID: input.IngredientID})
+			if err != nil {
+				return err
+			}
+
+			model.OldCount = ingredient.Count
+			model.LossPrice = (model.OldCount - model.NewCount) * ingredient.PurchasePrice
+
+			if err := tx.InventoryList.Create(model); err != nil {
+				return err
+			}
+
+			//движение пишется и при совпадении остатков: в журнале видно, что остаток подтвержден
+			return tx.Ingredients.SetCount(ingredient, model.NewCount, repository.StockMovementModel{
+				Reason:     repository.STOCK_MOVE_STOCKTAKE,
+				SourceID:   model.ID,
+				EmployeeID: claims.EmployeeID,
+			})
+		})
+		if !errors.Is(err, repository.ErrStockVersionConflict) {
+			break
 		}
+		model.ID = 0
 	}
 
-	if err := s.repo.InventoryList.Create(model); err != nil {
+	if err != nil {
+		if errors.Is(err, errInventoryStatus) {
+			NewResponse(c, http.StatusBadRequest, errIncorrectInputData("inventory is not committed: submit counts of an open inventory to /inventoryHistory/:id/counts"))
+			return
+		}
+		if errors.Is(err, repository.ErrStockVersionConflict) {
+			NewResponse(c, http.StatusConflict, errStockConflict(err.Error()))
+			return
+		}
 		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
 		return
 	}
@@ -97,11 +133,16 @@ func (s *InventoryListService) Create(c *gin.Context) {
 }
 
 type InventoryListGetAllQuery struct {
-	InventoryHistoryID uint `form:"inventory_history_id"`
+	InventoryHistoryID uint   `form:"inventory_history_id"`
+	Start              uint64 `form:"start"` //in unixmilli, по времени создания записи
+	End                uint64 `form:"end"`   //in unixmilli, по времени создания записи
 }
 type InventoryListGetAllOutput []InventoryListOutputModel
 
 //@Summary Получить всю историю инвернтаризации
+//@Description Поддерживает `offset`, `limit` и `sort` (id, loss_price) из стандартного query.
+//@Description Общее кол-во записей возвращается в заголовке `X-Total-Count`
+//@Description Без `limit` возвращается 100 записей, если указаны `offset` или `sort`, иначе - до 1000 записей
 //@param type query InventoryListGetAllQuery false "Принимаемый объект"
 //@Accept json
 //@Produce json
@@ -134,11 +175,12 @@ func (s *InventoryListService) GetAll(c *gin.Context) {
 		where.OutletID = stdQuery.OutletID
 	}
 
-	invetoryList, err := s.repo.InventoryList.Find(where)
+	invetoryList, total, err := s.repo.InventoryList.FindPage(where, stdQuery.listOptions(query.Start, query.End))
 	if err != nil {
-		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		listError(c, err)
 		return
 	}
+	setTotalCount(c, total)
 
 	var output InventoryListGetAllOutput = make(InventoryListGetAllOutput, len(*invetoryList))
 	for i, item := range *invetoryList {
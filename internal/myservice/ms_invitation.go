@@ -33,10 +33,12 @@ type InvitationCreateOutput struct {
 }
 
 //@Summary Создать код приглашения
+//@Description Доступно только после подтверждения email организации
 //@Accept json
 //@Produce json
 //@Success 201 {object} InvitationCreateOutput "возвращает id созданной записи и код приглашения"
 //@Failure 400 {object} serviceError
+//@Failure 403 {object} serviceError "email организации не подтвержден дольше разрешенного срока"
 //@Router /invites [post]
 func (s *InvitationService) Create(c *gin.Context) {
 	claims := mustGetEmployeeClaims(c)
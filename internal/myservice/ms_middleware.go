@@ -1,11 +1,19 @@
 package myservice
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/iivkis/pos.7-era.backend/internal/repository"
 	"github.com/iivkis/pos.7-era.backend/pkg/authjwt"
+	"gorm.io/gorm"
 )
 
 type MiddlewareService struct {
@@ -36,6 +44,13 @@ func (s *MiddlewareService) AuthOrg() func(*gin.Context) {
 			return
 		}
 
+		//токен действует, пока не отозвана его сессия
+		if claims.SessionID == 0 || !s.repo.AuthSessions.IsActive(&repository.AuthSessionModel{ID: claims.SessionID, Kind: repository.AUTH_SESSION_ORG, OrgID: claims.OrganizationID}) {
+			NewResponse(c, http.StatusUnauthorized, errTokenRevoked())
+			c.Abort()
+			return
+		}
+
 		c.Set("claims", claims)
 	}
 }
@@ -75,16 +90,200 @@ func (s *MiddlewareService) AuthEmployee(allowedRoles ...string) func(*gin.Conte
 			return
 		}
 
+		//токен действует, пока не отозвана его сессия (выход, удаление сотрудника или смена роли)
+		if claims.SessionID == 0 || !s.repo.AuthSessions.IsActive(&repository.AuthSessionModel{ID: claims.SessionID, Kind: repository.AUTH_SESSION_EMPLOYEE, EmployeeID: claims.EmployeeID, OrgID: claims.OrganizationID}) {
+			NewResponse(c, http.StatusUnauthorized, errTokenRevoked())
+			c.Abort()
+			return
+		}
+
 		c.Set("claims", claims)
 	}
 }
 
+//EmailConfirmed - не пропускает организации, не подтвердившие email за разрешенный срок (используется после AuthEmployee)
+func (s *MiddlewareService) EmailConfirmed() func(*gin.Context) {
+	return func(c *gin.Context) {
+		claims := mustGetEmployeeClaims(c)
+
+		org, err := s.repo.Organizations.FindFirts(&repository.OrganizationModel{ID: claims.OrganizationID})
+		if err != nil {
+			NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+			c.Abort()
+			return
+		}
+
+		if org.EmailConfirmOverdue() {
+			NewResponse(c, http.StatusForbidden, errEmailNotConfirmed())
+			c.Abort()
+			return
+		}
+	}
+}
+
+//idempotencyResponseWriter - копирует тело ответа, чтобы сохранить его для повторных запросов
+type idempotencyResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyResponseWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyResponseWriter) WriteString(str string) (int, error) {
+	w.body.WriteString(str)
+	return w.ResponseWriter.WriteString(str)
+}
+
+//Idempotency - обработка заголовка `Idempotency-Key` (используется после AuthEmployee).
+//Если запрос с таким ключом уже выполнялся в организации, то возвращается сохраненный ответ и запись не происходит повторно.
+//Повторный запрос с тем же ключом, но другим телом, отклоняется с кодом 422.
+//Ответы с кодом 5xx не сохраняются, чтобы запрос можно было повторить
+func (s *MiddlewareService) Idempotency() func(*gin.Context) {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			return
+		}
+
+		if len(key) > 100 {
+			NewResponse(c, http.StatusBadRequest, errIncorrectInputData("`Idempotency-Key` must be no longer than 100 characters"))
+			c.Abort()
+			return
+		}
+
+		claims := mustGetEmployeeClaims(c)
+
+		//тело читается для хеша и возвращается обратно для обработчика
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		bodyHash := sha256.Sum256(body)
+
+		record := &repository.IdempotencyKeyModel{
+			Key:      key,
+			Method:   c.Request.Method,
+			Path:     c.FullPath(),
+			BodyHash: hex.EncodeToString(bodyHash[:]),
+			OrgID:    claims.OrganizationID,
+		}
+
+		if err := s.repo.IdempotencyKeys.Create(record); err != nil {
+			dberr, ok := isDatabaseError(err)
+			if !ok || dberr.Number != 1062 {
+				NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+				c.Abort()
+				return
+			}
+
+			//ключ уже использовался
+			stored, err := s.repo.IdempotencyKeys.FindFirts(&repository.IdempotencyKeyModel{Key: key, OrgID: claims.OrganizationID})
+			if err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					NewResponse(c, http.StatusConflict, errIdempotencyConflict("try again"))
+				} else {
+					NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+				}
+				c.Abort()
+				return
+			}
+
+			//срок хранения истек, но запись еще не удалена
+			if stored.ExpiresIn <= time.Now().UTC().UnixMilli() {
+				if err := s.repo.IdempotencyKeys.Delete(&repository.IdempotencyKeyModel{ID: stored.ID}); err != nil {
+					NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+					c.Abort()
+					return
+				}
+
+				if err := s.repo.IdempotencyKeys.Create(record); err != nil {
+					NewResponse(c, http.StatusConflict, errIdempotencyConflict("try again"))
+					c.Abort()
+					return
+				}
+			} else {
+				if stored.Method != record.Method || stored.Path != record.Path {
+					NewResponse(c, http.StatusUnprocessableEntity, errIdempotencyConflict("the key was used for another request"))
+					c.Abort()
+					return
+				}
+
+				//у ключей, сохраненных до появления хеша, тело не проверяется
+				if stored.BodyHash != "" && stored.BodyHash != record.BodyHash {
+					NewResponse(c, http.StatusUnprocessableEntity, errIdempotencyConflict("the key was used with another request body"))
+					c.Abort()
+					return
+				}
+
+				if stored.StatusCode == 0 {
+					NewResponse(c, http.StatusConflict, errIdempotencyConflict("a request with this key is still being processed"))
+					c.Abort()
+					return
+				}
+
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(stored.StatusCode, "application/json; charset=utf-8", []byte(stored.Response))
+				c.Abort()
+				return
+			}
+		}
+
+		writer := &idempotencyResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		if writer.Status() >= http.StatusInternalServerError {
+			s.repo.IdempotencyKeys.Delete(&repository.IdempotencyKeyModel{ID: record.ID})
+			return
+		}
+
+		if err := s.repo.IdempotencyKeys.SaveResponse(record.ID, writer.Status(), writer.body.String()); err != nil {
+			//ответ уже отправлен клиенту, поэтому ошибку только логируем
+			errUnknown(err.Error())
+		}
+	}
+}
+
 type MiddlewareStdQueryInput struct {
 	OutletID uint `form:"outlet_id"`
 	OrgID    uint `form:"org_id"`
 
-	Offset int `form:"offset"`
-	Limit  int `form:"limit"`
+	Offset int    `form:"offset" binding:"min=0"`
+	Limit  int    `form:"limit" binding:"min=0,max=1000"` //0 - repository.LIST_DEFAULT_LIMIT, если указаны offset или sort, иначе repository.LIST_MAX_LIMIT
+	Sort   string `form:"sort"`                           //поле сортировки, "-" в начале - по убыванию (например, "-date")
+}
+
+//listOptions - пагинация и сортировка из стандартного query с фильтром по периоду start-end (unixmilli)
+func (q *MiddlewareStdQueryInput) listOptions(start uint64, end uint64) *repository.ListOptions {
+	return &repository.ListOptions{
+		Offset: q.Offset,
+		Limit:  q.Limit,
+		Sort:   q.Sort,
+		Start:  start,
+		End:    end,
+	}
+}
+
+//setTotalCount - кол-во записей списка без учета пагинации (заголовок X-Total-Count)
+func setTotalCount(c *gin.Context, total int64) {
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+}
+
+//listError - ответ на ошибку получения списка
+func listError(c *gin.Context, err error) {
+	if errors.Is(err, repository.ErrUnknownSortField) {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+	NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
 }
 
 //Standart Query
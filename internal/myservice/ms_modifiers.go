@@ -0,0 +1,692 @@
+package myservice
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iivkis/pos.7-era.backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+type ModifierOptionIngredientOutputModel struct {
+	IngredientID uint    `json:"ingredient_id"`
+	Count        float64 `json:"count"` // в единицах хранения ингредиента
+}
+
+type ModifierOptionOutputModel struct {
+	ID              uint                                  `json:"id"`
+	Name            string                                `json:"name"`
+	PriceDelta      float64                               `json:"price_delta"` // надбавка к цене продукта
+	ModifierGroupID uint                                  `json:"modifier_group_id"`
+	Ingredients     []ModifierOptionIngredientOutputModel `json:"ingredients"` // расход ингредиентов на единицу продукта
+}
+
+type ModifierGroupOutputModel struct {
+	ID          uint                        `json:"id"`
+	Name        string                      `json:"name"`
+	MultiSelect bool                        `json:"multi_select"`
+	MinSelect   int                         `json:"min_select"` // 0 - группа необязательная
+	MaxSelect   int                         `json:"max_select"` // 0 - без ограничений
+	ProductID   uint                        `json:"product_id"`
+	CategoryID  uint                        `json:"category_id"`
+	OutletID    uint                        `json:"outlet_id"`
+	Options     []ModifierOptionOutputModel `json:"options"`
+}
+
+type ModifiersService struct {
+	repo *repository.Repository
+}
+
+func newModifiersService(repo *repository.Repository) *ModifiersService {
+	return &ModifiersService{
+		repo: repo,
+	}
+}
+
+type ModifierGroupCreateInput struct {
+	Name        string `json:"name" binding:"required,max=150"`
+	MultiSelect bool   `json:"multi_select"`
+	MinSelect   int    `json:"min_select" binding:"min=0,max=100"`
+	MaxSelect   int    `json:"max_select" binding:"min=0,max=100"`
+	ProductID   uint   `json:"product_id"`  // группа продукта
+	CategoryID  uint   `json:"category_id"` // группа всех продуктов категории
+}
+
+//@Summary Добавить группу модификаторов продукту или категории
+//@Description Нужно указать либо `product_id`, либо `category_id`.
+//@Description Если `multi_select` не указан, то в группе можно выбрать не больше одной опции
+//@param type body ModifierGroupCreateInput false "Принимаемый объект"
+//@Accept json
+//@Produce json
+//@Success 201 {object} DefaultOutputModel "возвращает id созданной записи"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /modifierGroups [post]
+func (s *ModifiersService) CreateGroup(c *gin.Context) {
+	var input ModifierGroupCreateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	group := repository.ModifierGroupModel{
+		Name:        input.Name,
+		MultiSelect: input.MultiSelect,
+		MinSelect:   input.MinSelect,
+		MaxSelect:   input.MaxSelect,
+		ProductID:   input.ProductID,
+		CategoryID:  input.CategoryID,
+		OutletID:    claims.OutletID,
+		OrgID:       claims.OrganizationID,
+	}
+
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		if stdQuery.OutletID != 0 && s.repo.Outlets.ExistsInOrg(stdQuery.OutletID, claims.OrganizationID) {
+			group.OutletID = stdQuery.OutletID
+		}
+	}
+
+	if (group.ProductID == 0) == (group.CategoryID == 0) {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData("either `product_id` or `category_id` must be set"))
+		return
+	}
+
+	if group.ProductID != 0 && !s.repo.Products.Exists(&repository.ProductModel{ID: group.ProductID, OutletID: group.OutletID, OrgID: group.OrgID}) {
+		NewResponse(c, http.StatusBadRequest, errRecordNotFound("undefined product with this id in outlet"))
+		return
+	}
+
+	if group.CategoryID != 0 && !s.repo.Categories.Exists(&repository.CategoryModel{ID: group.CategoryID, OutletID: group.OutletID, OrgID: group.OrgID}) {
+		NewResponse(c, http.StatusBadRequest, errRecordNotFound("undefined category with this id in outlet"))
+		return
+	}
+
+	if serr := checkModifierGroupSelect(group.MultiSelect, group.MinSelect, group.MaxSelect); serr != nil {
+		NewResponse(c, http.StatusBadRequest, serr)
+		return
+	}
+
+	if err := s.repo.Modifiers.CreateGroup(&group); err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	NewResponse(c, http.StatusCreated, DefaultOutputModel{ID: group.ID})
+}
+
+type ModifierGroupGetAllQuery struct {
+	ProductID  uint `form:"product_id"`  // группы продукта, включая группы его категории
+	CategoryID uint `form:"category_id"` // группы категории
+}
+
+type ModifierGroupGetAllOutput []ModifierGroupOutputModel
+
+//@Summary Группы модификаторов точки с опциями
+//@Description С `product_id` возвращает все группы, доступные продукту: его собственные и группы его категории
+//@param type query ModifierGroupGetAllQuery false "Принимаемый объект"
+//@Accept json
+//@Produce json
+//@Success 200 {object} ModifierGroupGetAllOutput "возвращаемый объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /modifierGroups [get]
+func (s *ModifiersService) GetAllGroups(c *gin.Context) {
+	var query ModifierGroupGetAllQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	where := &repository.ModifierGroupModel{
+		CategoryID: query.CategoryID,
+		OutletID:   claims.OutletID,
+		OrgID:      claims.OrganizationID,
+	}
+
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		where.OutletID = stdQuery.OutletID
+	}
+
+	var groups *[]repository.ModifierGroupModel
+	var err error
+
+	if query.ProductID != 0 {
+		var product *repository.ProductModel
+		if product, err = s.repo.Products.FindFirst(&repository.ProductModel{ID: query.ProductID, OutletID: where.OutletID, OrgID: where.OrgID}); err != nil {
+			NewResponse(c, http.StatusBadRequest, errRecordNotFound("undefined product with this id"))
+			return
+		}
+		groups, err = s.repo.Modifiers.FindProductGroups(product)
+	} else {
+		groups, err = s.repo.Modifiers.FindGroups(where)
+	}
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	output, err := s.newGroupOutputModels(*groups)
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+	NewResponse(c, http.StatusOK, output)
+}
+
+type ModifierGroupUpdateInput struct {
+	Name        *string `json:"name,omitempty" binding:"omitempty,min=1,max=150"`
+	MultiSelect *bool   `json:"multi_select,omitempty"`
+	MinSelect   *int    `json:"min_select,omitempty" binding:"omitempty,min=0,max=100"`
+	MaxSelect   *int    `json:"max_select,omitempty" binding:"omitempty,min=0,max=100"`
+}
+
+//@Summary Обновить группу модификаторов
+//@param type body ModifierGroupUpdateInput false "Обновляемые поля"
+//@Accept json
+//@Produce json
+//@Success 200 {object} object "возвращает пустой объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /modifierGroups/:id [put]
+func (s *ModifiersService) UpdateGroup(c *gin.Context) {
+	var input ModifierGroupUpdateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	group, ok := s.findGroup(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	updatedFields := make(map[string]interface{})
+	{
+		if input.Name != nil {
+			updatedFields["name"] = *input.Name
+		}
+
+		if input.MultiSelect != nil {
+			group.MultiSelect = *input.MultiSelect
+			updatedFields["multi_select"] = *input.MultiSelect
+		}
+
+		if input.MinSelect != nil {
+			group.MinSelect = *input.MinSelect
+			updatedFields["min_select"] = *input.MinSelect
+		}
+
+		if input.MaxSelect != nil {
+			group.MaxSelect = *input.MaxSelect
+			updatedFields["max_select"] = *input.MaxSelect
+		}
+	}
+
+	if serr := checkModifierGroupSelect(group.MultiSelect, group.MinSelect, group.MaxSelect); serr != nil {
+		NewResponse(c, http.StatusBadRequest, serr)
+		return
+	}
+
+	if len(updatedFields) != 0 {
+		if err := s.repo.Modifiers.UpdatesGroup(&repository.ModifierGroupModel{ID: group.ID}, &updatedFields); err != nil {
+			NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+			return
+		}
+	}
+
+	NewResponse(c, http.StatusOK, nil)
+}
+
+//@Summary Удалить группу модификаторов вместе с ее опциями
+//@Description Опции, выбранные в проданных позициях, остаются в истории заказов
+//@Accept json
+//@Produce json
+//@Success 200 {object} object "возвращает пустой объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /modifierGroups/:id [delete]
+func (s *ModifiersService) DeleteGroup(c *gin.Context) {
+	group, ok := s.findGroup(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	err := s.repo.Transaction(func(tx *repository.Repository) error {
+		return tx.Modifiers.DeleteGroup(&repository.ModifierGroupModel{ID: group.ID})
+	})
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	NewResponse(c, http.StatusOK, nil)
+}
+
+type ModifierOptionIngredientInput struct {
+	IngredientID uint    `json:"ingredient_id" binding:"min=1"`
+	Count        float64 `json:"count" binding:"gt=0"`
+	Unit         int     `json:"unit" binding:"min=0,max=6"` // единица `count` (0 - единица хранения ингредиента)
+}
+
+type ModifierOptionCreateInput struct {
+	ModifierGroupID uint                            `json:"modifier_group_id" binding:"min=1"`
+	Name            string                          `json:"name" binding:"required,max=150"`
+	PriceDelta      float64                         `json:"price_delta"`
+	Ingredients     []ModifierOptionIngredientInput `json:"ingredients" binding:"max=50,dive"` // расход ингредиентов на единицу продукта
+}
+
+//@Summary Добавить опцию в группу модификаторов
+//@Description Кол-во ингредиентов переводится в единицы хранения ингредиентов
+//@param type body ModifierOptionCreateInput false "Принимаемый объект"
+//@Accept json
+//@Produce json
+//@Success 201 {object} DefaultOutputModel "возвращает id созданной записи"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /modifierOptions [post]
+func (s *ModifiersService) CreateOption(c *gin.Context) {
+	var input ModifierOptionCreateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	group, ok := s.findGroup(c, strconv.FormatUint(uint64(input.ModifierGroupID), 10))
+	if !ok {
+		return
+	}
+
+	ingredients, serr := s.newOptionIngredients(group, input.Ingredients)
+	if serr != nil {
+		NewResponse(c, http.StatusBadRequest, serr)
+		return
+	}
+
+	option := repository.ModifierOptionModel{
+		Name:            input.Name,
+		PriceDelta:      input.PriceDelta,
+		ModifierGroupID: group.ID,
+		OutletID:        group.OutletID,
+		OrgID:           group.OrgID,
+	}
+
+	err := s.repo.Transaction(func(tx *repository.Repository) error {
+		if err := tx.Modifiers.CreateOption(&option); err != nil {
+			return err
+		}
+		return createOptionIngredients(tx, option.ID, ingredients)
+	})
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	NewResponse(c, http.StatusCreated, DefaultOutputModel{ID: option.ID})
+}
+
+type ModifierOptionUpdateInput struct {
+	Name        *string                          `json:"name,omitempty" binding:"omitempty,min=1,max=150"`
+	PriceDelta  *float64                         `json:"price_delta,omitempty"`
+	Ingredients *[]ModifierOptionIngredientInput `json:"ingredients,omitempty" binding:"omitempty,max=50,dive"` // если указаны, то заменяют все ингредиенты опции
+}
+
+//@Summary Обновить опцию модификатора
+//@param type body ModifierOptionUpdateInput false "Обновляемые поля"
+//@Accept json
+//@Produce json
+//@Success 200 {object} object "возвращает пустой объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /modifierOptions/:id [put]
+func (s *ModifiersService) UpdateOption(c *gin.Context) {
+	var input ModifierOptionUpdateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	option, group, ok := s.findOption(c)
+	if !ok {
+		return
+	}
+
+	updatedFields := make(map[string]interface{})
+	{
+		if input.Name != nil {
+			updatedFields["name"] = *input.Name
+		}
+
+		if input.PriceDelta != nil {
+			updatedFields["price_delta"] = *input.PriceDelta
+		}
+	}
+
+	var ingredients []repository.ModifierOptionIngredientModel
+	if input.Ingredients != nil {
+		var serr *serviceError
+		if ingredients, serr = s.newOptionIngredients(group, *input.Ingredients); serr != nil {
+			NewResponse(c, http.StatusBadRequest, serr)
+			return
+		}
+	}
+
+	err := s.repo.Transaction(func(tx *repository.Repository) error {
+		if len(updatedFields) != 0 {
+			if err := tx.Modifiers.UpdatesOption(&repository.ModifierOptionModel{ID: option.ID}, &updatedFields); err != nil {
+				return err
+			}
+		}
+
+		if input.Ingredients == nil {
+			return nil
+		}
+
+		if err := tx.Modifiers.DeleteOptionIngredients(&repository.ModifierOptionIngredientModel{ModifierOptionID: option.ID}); err != nil {
+			return err
+		}
+		return createOptionIngredients(tx, option.ID, ingredients)
+	})
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	NewResponse(c, http.StatusOK, nil)
+}
+
+//@Summary Удалить опцию модификатора
+//@Description Опция, выбранная в проданных позициях, остается в истории заказов
+//@Accept json
+//@Produce json
+//@Success 200 {object} object "возвращает пустой объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /modifierOptions/:id [delete]
+func (s *ModifiersService) DeleteOption(c *gin.Context) {
+	option, _, ok := s.findOption(c)
+	if !ok {
+		return
+	}
+
+	if err := s.repo.Modifiers.DeleteOption(&repository.ModifierOptionModel{ID: option.ID}); err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	NewResponse(c, http.StatusOK, nil)
+}
+
+//findGroup - группа модификаторов с id groupID в пределах точки (организации для владельца и директора)
+func (s *ModifiersService) findGroup(c *gin.Context, groupID string) (*repository.ModifierGroupModel, bool) {
+	idx, err := strconv.Atoi(groupID)
+	if err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return nil, false
+	}
+
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	where := &repository.ModifierGroupModel{
+		ID:       uint(idx),
+		OutletID: claims.OutletID,
+		OrgID:    claims.OrganizationID,
+	}
+
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		where.OutletID = stdQuery.OutletID
+	}
+
+	group, err := s.repo.Modifiers.FindFirstGroup(where)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NewResponse(c, http.StatusBadRequest, errRecordNotFound("undefined modifier group with this id"))
+			return nil, false
+		}
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return nil, false
+	}
+	return group, true
+}
+
+//findOption - опция модификатора из параметра `id` и ее группа
+func (s *ModifiersService) findOption(c *gin.Context) (*repository.ModifierOptionModel, *repository.ModifierGroupModel, bool) {
+	idx, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return nil, nil, false
+	}
+
+	claims := mustGetEmployeeClaims(c)
+
+	option, err := s.repo.Modifiers.FindFirstOption(&repository.ModifierOptionModel{ID: uint(idx), OrgID: claims.OrganizationID})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NewResponse(c, http.StatusBadRequest, errRecordNotFound("undefined modifier option with this id"))
+			return nil, nil, false
+		}
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return nil, nil, false
+	}
+
+	group, ok := s.findGroup(c, strconv.FormatUint(uint64(option.ModifierGroupID), 10))
+	if !ok {
+		return nil, nil, false
+	}
+	return option, group, true
+}
+
+//newOptionIngredients - проверяет, что ингредиенты есть в точке группы, и переводит кол-во в единицы хранения
+func (s *ModifiersService) newOptionIngredients(group *repository.ModifierGroupModel, input []ModifierOptionIngredientInput) ([]repository.ModifierOptionIngredientModel, *serviceError) {
+	ingredients := make([]repository.ModifierOptionIngredientModel, len(input))
+	for i, item := range input {
+		ingredient, err := s.repo.Ingredients.FindFirts(&repository.IngredientModel{ID: item.IngredientID, OutletID: group.OutletID, OrgID: group.OrgID})
+		if err != nil {
+			return nil, errRecordNotFound(fmt.Sprintf("undefined ingredent with id `%d`", item.IngredientID))
+		}
+
+		count, serr := convertIngredientCount(ingredient, item.Count, item.Unit)
+		if serr != nil {
+			return nil, serr
+		}
+
+		ingredients[i] = repository.ModifierOptionIngredientModel{
+			Count:        count,
+			IngredientID: ingredient.ID,
+			OutletID:     group.OutletID,
+			OrgID:        group.OrgID,
+		}
+	}
+	return ingredients, nil
+}
+
+//newGroupOutputModels - группы модификаторов с опциями и их ингредиентами
+func (s *ModifiersService) newGroupOutputModels(groups []repository.ModifierGroupModel) (ModifierGroupGetAllOutput, error) {
+	output := make(ModifierGroupGetAllOutput, len(groups))
+	if len(groups) == 0 {
+		return output, nil
+	}
+
+	groupIDs := make([]uint, len(groups))
+	for i, group := range groups {
+		groupIDs[i] = group.ID
+	}
+
+	options, err := s.repo.Modifiers.FindOptionsByGroups(groupIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	optionIDs := make([]uint, len(*options))
+	for i, option := range *options {
+		optionIDs[i] = option.ID
+	}
+
+	ingredientsByOption := make(map[uint][]ModifierOptionIngredientOutputModel)
+	if len(optionIDs) != 0 {
+		ingredients, err := s.repo.Modifiers.FindOptionIngredients(optionIDs)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range *ingredients {
+			ingredientsByOption[item.ModifierOptionID] = append(ingredientsByOption[item.ModifierOptionID], ModifierOptionIngredientOutputModel{
+				IngredientID: item.IngredientID,
+				Count:        item.Count,
+			})
+		}
+	}
+
+	optionsByGroup := make(map[uint][]ModifierOptionOutputModel)
+	for _, option := range *options {
+		ingredients := ingredientsByOption[option.ID]
+		if ingredients == nil {
+			ingredients = []ModifierOptionIngredientOutputModel{}
+		}
+
+		optionsByGroup[option.ModifierGroupID] = append(optionsByGroup[option.ModifierGroupID], ModifierOptionOutputModel{
+			ID:              option.ID,
+			Name:            option.Name,
+			PriceDelta:      option.PriceDelta,
+			ModifierGroupID: option.ModifierGroupID,
+			Ingredients:     ingredients,
+		})
+	}
+
+	for i, group := range groups {
+		options := optionsByGroup[group.ID]
+		if options == nil {
+			options = []ModifierOptionOutputModel{}
+		}
+
+		output[i] = ModifierGroupOutputModel{
+			ID:          group.ID,
+			Name:        group.Name,
+			MultiSelect: group.MultiSelect,
+			MinSelect:   group.MinSelect,
+			MaxSelect:   group.MaxSelect,
+			ProductID:   group.ProductID,
+			CategoryID:  group.CategoryID,
+			OutletID:    group.OutletID,
+			Options:     options,
+		}
+	}
+	return output, nil
+}
+
+func createOptionIngredients(tx *repository.Repository, optionID uint, ingredients []repository.ModifierOptionIngredientModel) error {
+	for i := range ingredients {
+		ingredients[i].ID = 0
+		ingredients[i].ModifierOptionID = optionID
+
+		if err := tx.Modifiers.CreateOptionIngredient(&ingredients[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//checkModifierGroupSelect - проверяет ограничения выбора опций группы
+func checkModifierGroupSelect(multiSelect bool, minSelect, maxSelect int) *serviceError {
+	if !multiSelect && (minSelect > 1 || maxSelect > 1) {
+		return errIncorrectInputData("`min_select` and `max_select` can't be greater than 1 without `multi_select`")
+	}
+
+	if maxSelect != 0 && minSelect > maxSelect {
+		return errIncorrectInputData("`min_select` can't be greater than `max_select`")
+	}
+	return nil
+}
+
+//selectModifiers - проверяет выбор опций модификаторов для продукта и фиксирует их название, цену и себестоимость.
+//Опции должны принадлежать группам продукта или его категории, а их кол-во в каждой группе - укладываться в ограничения группы
+func selectModifiers(repo *repository.Repository, product *repository.ProductModel, optionIDs []uint) (modifiers []repository.OrderListModifierModel, code int, serr *serviceError) {
+	groups, err := repo.Modifiers.FindProductGroups(product)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errUnknown(err.Error())
+	}
+
+	if len(*groups) == 0 {
+		if len(optionIDs) != 0 {
+			return nil, http.StatusBadRequest, errIncorrectInputData(fmt.Sprintf("product `%d` has no modifiers", product.ID))
+		}
+		return nil, http.StatusOK, nil
+	}
+
+	groupIDs := make([]uint, len(*groups))
+	for i, group := range *groups {
+		groupIDs[i] = group.ID
+	}
+
+	options, err := repo.Modifiers.FindOptionsByGroups(groupIDs)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errUnknown(err.Error())
+	}
+
+	byID := make(map[uint]repository.ModifierOptionModel, len(*options))
+	for _, option := range *options {
+		byID[option.ID] = option
+	}
+
+	selected := make(map[uint]int, len(*groups))
+	seen := make(map[uint]bool, len(optionIDs))
+	for _, id := range optionIDs {
+		option, ok := byID[id]
+		if !ok {
+			return nil, http.StatusBadRequest, errIncorrectInputData(fmt.Sprintf("modifier option `%d` is not available for product `%d`", id, product.ID))
+		}
+
+		if seen[id] {
+			return nil, http.StatusBadRequest, errIncorrectInputData(fmt.Sprintf("modifier option `%d` is selected twice", id))
+		}
+		seen[id] = true
+		selected[option.ModifierGroupID]++
+	}
+
+	for _, group := range *groups {
+		n := selected[group.ID]
+
+		if n < group.MinSelect {
+			return nil, http.StatusBadRequest, errIncorrectInputData(fmt.Sprintf("select at least %d option(s) in modifier group `%s`", group.MinSelect, group.Name))
+		}
+
+		if (!group.MultiSelect && n > 1) || (group.MaxSelect != 0 && n > group.MaxSelect) {
+			return nil, http.StatusBadRequest, errIncorrectInputData(fmt.Sprintf("too many options selected in modifier group `%s`", group.Name))
+		}
+	}
+
+	if len(optionIDs) == 0 {
+		return nil, http.StatusOK, nil
+	}
+
+	//себестоимость фиксируется на момент продажи
+	costs, err := repo.Modifiers.OptionUnitCosts(optionIDs)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errUnknown(err.Error())
+	}
+
+	costByID := make(map[uint]float64, len(costs))
+	for _, cost := range costs {
+		costByID[cost.ModifierOptionID] = cost.Cost
+	}
+
+	modifiers = make([]repository.OrderListModifierModel, len(optionIDs))
+	for i, id := range optionIDs {
+		option := byID[id]
+		modifiers[i] = repository.OrderListModifierModel{
+			Name:             option.Name,
+			PriceDelta:       option.PriceDelta,
+			CostPrice:        costByID[id],
+			ModifierOptionID: option.ID,
+			OutletID:         product.OutletID,
+			OrgID:            product.OrgID,
+		}
+	}
+	return modifiers, http.StatusOK, nil
+}
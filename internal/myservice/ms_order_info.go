@@ -7,6 +7,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/iivkis/pos.7-era.backend/internal/repository"
+	"github.com/iivkis/pos.7-era.backend/pkg/authjwt"
 	"gorm.io/gorm"
 )
 
@@ -18,8 +19,15 @@ type OrderInfoOutputModel struct {
 	IsDelete     bool   `json:"is_delete"`
 	SessionID    uint   `json:"session_id"`
 	OutletID     uint   `json:"outlet_id"`
+
+	Subtotal  float64 `json:"subtotal"`   // сумма по ценам каталога
+	Total     float64 `json:"total"`      // сумма по ценам продажи
+	LineCount int     `json:"line_count"` // кол-во позиций
 }
 
+//errOrderInfoNotChanged - заказ уже удален (или уже восстановлен)
+var errOrderInfoNotChanged = errors.New("order info not changed")
+
 type OrdersInfoService struct {
 	repo *repository.Repository
 }
@@ -87,13 +95,18 @@ func (s *OrdersInfoService) Create(c *gin.Context) {
 }
 
 type OrderInfoGetAllQuery struct {
-	SessionID uint `form:"session_id"`
+	SessionID uint   `form:"session_id"`
+	Start     uint64 `form:"start"` //in unixmilli
+	End       uint64 `form:"end"`   //in unixmilli
 }
 
 type OrdersInfoGetAllOutput []OrderInfoOutputModel
 
 //@Summary Получить список завершенных заказов (orderInfo)
-//Param type query OrdersInfoGetAllOutput false "Принимаемый объект"
+//@Description Поддерживает `offset`, `limit` и `sort` (id, date, total) из стандартного query, фильтр по `date` заказа.
+//@Description Общее кол-во записей возвращается в заголовке `X-Total-Count`
+//@Description Без `limit` возвращается 100 записей, если указаны `offset` или `sort`, иначе - до 1000 записей
+//@Param type query OrderInfoGetAllQuery false "Принимаемый объект"
 //@Accept json
 //@Produce json
 //@Success 200 {object} OrdersInfoGetAllOutput "список завершенных заказов"
@@ -104,6 +117,7 @@ func (s *OrdersInfoService) GetAll(c *gin.Context) {
 	var query OrderInfoGetAllQuery
 	if err := c.ShouldBindQuery(&query); err != nil {
 		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
 	}
 
 	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
@@ -118,11 +132,12 @@ func (s *OrdersInfoService) GetAll(c *gin.Context) {
 		where.OutletID = stdQuery.OutletID
 	}
 
-	list, err := s.repo.OrdersInfo.FindUnscoped(where)
+	list, total, err := s.repo.OrdersInfo.FindPageUnscoped(where, stdQuery.listOptions(query.Start, query.End))
 	if err != nil {
-		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		listError(c, err)
 		return
 	}
+	setTotalCount(c, total)
 
 	output := make(OrdersInfoGetAllOutput, len(*list))
 	for i, item := range *list {
@@ -134,6 +149,9 @@ func (s *OrdersInfoService) GetAll(c *gin.Context) {
 			IsDelete:     !item.DeletedAt.Time.IsZero(),
 			SessionID:    item.SessionID,
 			OutletID:     item.OutletID,
+			Subtotal:     item.Subtotal,
+			Total:        item.Total,
+			LineCount:    item.LineCount,
 		}
 	}
 	NewResponse(c, http.StatusOK, output)
@@ -165,42 +183,61 @@ func (s *OrdersInfoService) Delete(c *gin.Context) {
 		where.OutletID = stdQuery.OutletID
 	}
 
-	//есть ли orderInfo в точке и организации
-	if !s.repo.OrdersInfo.Exists(where) {
-		NewResponse(c, http.StatusBadRequest, errRecordNotFound("undefined `order_info` with this `id`"))
-		return
-	}
+	//заказ удаляется и ингредиенты возвращаются в одной транзакции.
+	//Повторное удаление не возвращает ингредиенты второй раз
+	err = s.repo.Transaction(func(tx *repository.Repository) error {
+		ok, err := tx.OrdersInfo.DeleteOnce(where)
+		if err != nil {
+			return err
+		}
 
-	orderLists, err := s.repo.OrdersList.Find(&repository.OrderListModel{OrderInfoID: where.ID})
-	if err != nil {
-		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
-		return
-	}
+		if !ok {
+			return errOrderInfoNotChanged
+		}
 
-	for _, orderList := range *orderLists {
-		if err := s.repo.ProductsWithIngredients.AdditionIngredients(orderList.ProductID, orderList.Count); err != nil {
-			NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
-			return
+		orderLists, err := tx.OrdersList.Find(&repository.OrderListModel{OrderInfoID: where.ID})
+		if err != nil {
+			return err
 		}
-	}
 
-	if err := s.repo.OrdersList.Delete(&repository.OrderListModel{OrderInfoID: uint(orderInfoID)}); err != nil {
-		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
-		return
-	}
+		details, err := findOrderLineDetails(tx, *orderLists)
+		if err != nil {
+			return err
+		}
 
-	if err := s.repo.OrdersInfo.Delete(where); err != nil {
+		for _, orderList := range *orderLists {
+			if err := returnOrderListIngredients(tx, &orderList, details[orderList.ID], repository.StockMovementModel{
+				Reason:     repository.STOCK_MOVE_REFUND,
+				SourceID:   where.ID,
+				EmployeeID: claims.EmployeeID,
+			}); err != nil {
+				return err
+			}
+		}
+
+		return tx.OrdersList.Delete(&repository.OrderListModel{OrderInfoID: where.ID})
+	})
+	if err != nil {
+		if errors.Is(err, errOrderInfoNotChanged) {
+			NewResponse(c, http.StatusBadRequest, errRecordNotFound("undefined `order_info` with this `id`"))
+			return
+		}
 		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
 		return
 	}
 	NewResponse(c, http.StatusOK, nil)
 }
 
+type OrderInfoRecoveryOutput struct {
+	StockWarnings []StockShortfallOutputModel `json:"stock_warnings,omitempty"` //ингредиенты, ушедшие в минус (политика остатков "предупредить")
+}
+
 //@Summary Восстановить orderInfo в точке по его id
-//@Success 200 {object} object "возвращает пустой объект"
+//@Success 200 {object} OrderInfoRecoveryOutput "возвращает пустой объект или ингредиенты, ушедшие в минус"
 //@Produce json
 //@Accept json
 //@Failure 400 {object} serviceError
+//@Failure 409 {object} serviceError "не хватает ингредиентов (политика остатков - запретить)"
 //@Failure 500 {object} serviceError
 //@Router /orderInfo/:id [post]
 func (s *OrdersInfoService) Recovery(c *gin.Context) {
@@ -229,45 +266,291 @@ func (s *OrdersInfoService) Recovery(c *gin.Context) {
 	}
 
 	//check orderInfo
-	{
-		orderInfo, err := s.repo.OrdersInfo.FindFirstUnscoped(where)
+	if !s.repo.OrdersInfo.ExistsUnscoped(where) {
+		NewResponse(c, http.StatusBadRequest, errRecordNotFound("undefined `order_info` with this `id`"))
+		return
+	}
+
+	//заказ восстанавливается и ингредиенты списываются в одной транзакции.
+	//Повторное восстановление не списывает ингредиенты второй раз
+	var warnings []StockShortfallOutputModel
+	err = s.repo.Transaction(func(tx *repository.Repository) error {
+		ok, err := tx.OrdersInfo.RecoveryOnce(where)
 		if err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				NewResponse(c, http.StatusBadRequest, errRecordNotFound("undefined `order_info` with this `id`"))
-			} else {
-				NewResponse(c, http.StatusBadRequest, errUnknown(err.Error()))
+			return err
+		}
+
+		if !ok {
+			return errOrderInfoNotChanged
+		}
+
+		orderLists, err := tx.OrdersList.FindUnscoped(&repository.OrderListModel{OrderInfoID: where.ID, OutletID: where.OutletID, OrgID: where.OrgID})
+		if err != nil {
+			return err
+		}
+
+		details, err := findOrderLineDetails(tx, *orderLists)
+		if err != nil {
+			return err
+		}
+
+		var deductions []repository.StockDeduction
+		for _, orderList := range *orderLists {
+			lineDeductions, err := subtractOrderListIngredients(tx, &orderList, details[orderList.ID], repository.StockMovementModel{
+				Reason:     repository.STOCK_MOVE_SALE,
+				SourceID:   where.ID,
+				EmployeeID: claims.EmployeeID,
+			})
+			if err != nil {
+				return err
 			}
-			return
+			deductions = append(deductions, lineDeductions...)
+		}
+
+		if err := tx.OrdersList.Recovery(&repository.OrderListModel{OrderInfoID: where.ID}); err != nil {
+			return err
+		}
+
+		if len(*orderLists) == 0 {
+			return nil
 		}
 
-		if orderInfo.DeletedAt.Time.IsZero() {
+		warnings, err = applyStockPolicy(tx, (*orderLists)[0].OutletID, deductions)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errOrderInfoNotChanged) {
 			NewResponse(c, http.StatusBadRequest, errRecordNotFound("record already recovered"))
 			return
 		}
+		if serr, ok := stockShortfallError(err); ok {
+			NewResponse(c, http.StatusConflict, serr)
+			return
+		}
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
 	}
 
-	orderLists, err := s.repo.OrdersList.FindUnscoped(&repository.OrderListModel{OrderInfoID: where.ID, OutletID: where.OutletID, OrgID: where.OrgID})
-	if err != nil {
-		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+	NewResponse(c, http.StatusOK, OrderInfoRecoveryOutput{StockWarnings: warnings})
+}
+
+type OrderInfoCheckoutListInput struct {
+	Count         int      `json:"count" binding:"min=1"`
+	ProductName   string   `json:"product_name"`               // не используется, название берется из каталога
+	ProductPrice  *float64 `json:"product_price,omitempty"`    // если не указана, то берется цена из каталога
+	PriceOverride bool     `json:"price_override"`             // продать по `product_price`, даже если она отличается от каталога (owner, director, admin)
+	Modifiers     []uint   `json:"modifiers" binding:"max=20"` // id выбранных опций модификаторов
+	ProductID     uint     `json:"product_id" binding:"min=1"`
+}
+
+type OrderInfoCheckoutInput struct {
+	PayType      int    `json:"pay_type" binding:"min=0,max=2"`
+	EmployeeName string `json:"employee_name" binding:"required"`
+	Date         int64  `json:"date" binding:"min=1"`
+	SessionID    uint   `json:"session_id" binding:"min=1"`
+
+	OrderList []OrderInfoCheckoutListInput `json:"order_list" binding:"required,min=1,max=100,dive"`
+	Payments  []OrderPaymentInput          `json:"payments" binding:"max=10,dive"` // если указаны, то `pay_type` определяется по ним
+}
+
+type OrderInfoCheckoutOutput struct {
+	ID            uint                        `json:"id"`                       //id созданного order info
+	OrderListIDs  []uint                      `json:"order_list_ids"`           //id созданных orderList (в порядке передачи)
+	StockWarnings []StockShortfallOutputModel `json:"stock_warnings,omitempty"` //ингредиенты, ушедшие в минус (политика остатков "предупредить")
+}
+
+//@Summary Оформить заказ целиком (orderInfo + orderList) одной транзакцией
+//@Description Создает orderInfo, все позиции orderList и списывает ингредиенты.
+//@Description Если хотя бы одна операция завершилась ошибкой, то ни одна запись не сохраняется.
+//@Description Необязательное поле `payments` сохраняет оплату заказа (см. /orderInfo/:id/payments).
+//@Description Если ингредиентов не хватает, то в зависимости от политики остатков точки заказ сохраняется,
+//@Description сохраняется с `stock_warnings` или отклоняется с кодом 409 и списком нехватки в `details`.
+//@param type body OrderInfoCheckoutInput false "Принимаемый объект"
+//@Accept json
+//@Produce json
+//@Success 201 {object} OrderInfoCheckoutOutput "возвращает id созданного order info и id позиций"
+//@Failure 400 {object} serviceError
+//@Failure 403 {object} serviceError "изменение цены без прав (`price_override`)"
+//@Failure 409 {object} serviceError "не хватает ингредиентов (политика остатков - запретить)"
+//@Failure 500 {object} serviceError
+//@Router /orderInfo.Checkout [post]
+func (s *OrdersInfoService) Checkout(c *gin.Context) {
+	var input OrderInfoCheckoutInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
 		return
 	}
 
-	for _, orderList := range *orderLists {
-		if err := s.repo.ProductsWithIngredients.SubractionIngredients(orderList.ProductID, orderList.Count); err != nil {
-			NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
-			return
+	output, code, serr := s.checkout(s.repo, mustGetEmployeeClaims(c), &input)
+	if serr != nil {
+		NewResponse(c, code, serr)
+		return
+	}
+
+	NewResponse(c, http.StatusCreated, output)
+}
+
+//checkout - проверяет входные данные и сохраняет заказ со всеми позициями в одной транзакции (repo - репозиторий или внешняя транзакция).
+//Возвращает http код и ошибку сервиса, если что-то пошло не так
+func (s *OrdersInfoService) checkout(repo *repository.Repository, claims *authjwt.EmployeeClaims, input *OrderInfoCheckoutInput) (output *OrderInfoCheckoutOutput, code int, serr *serviceError) {
+	//check session
+	sess, err := repo.Sessions.FindFirts(&repository.SessionModel{Model: gorm.Model{ID: input.SessionID}, OutletID: claims.OutletID})
+	if err != nil {
+		return nil, http.StatusInternalServerError, errUnknown(err.Error())
+	}
+
+	if sess.ID == 0 {
+		return nil, http.StatusBadRequest, errRecordNotFound("undefined session")
+	}
+
+	if sess.DateClose != 0 {
+		return nil, http.StatusBadRequest, errIncorrectInputData("session already closed")
+	}
+
+	orderInfo := repository.OrderInfoModel{
+		PayType:      input.PayType,
+		Date:         input.Date,
+		EmployeeName: input.EmployeeName,
+		SessionID:    input.SessionID,
+		LineCount:    len(input.OrderList),
+		OrgID:        claims.OrganizationID,
+		OutletID:     claims.OutletID,
+	}
+
+	//название и цена позиций берутся из каталога
+	orderList := make([]repository.OrderListModel, len(input.OrderList))
+	details := make([]orderLineDetails, len(input.OrderList))
+	for i, item := range input.OrderList {
+		if orderList[i], details[i], code, serr = newOrderListModel(repo, claims, item.ProductID, item.Count, item.Modifiers, item.ProductPrice, item.PriceOverride); serr != nil {
+			return nil, code, serr
 		}
+		orderList[i].SessionID = input.SessionID
+
+		orderInfo.Subtotal += orderList[i].CatalogPrice * float64(orderList[i].Count)
+		orderInfo.Total += orderList[i].ProductPrice * float64(orderList[i].Count)
 	}
 
-	if err := s.repo.OrdersList.Recovery(&repository.OrderListModel{OrderInfoID: uint(orderInfoID)}); err != nil {
-		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
-		return
+	//оплата заказа
+	var payments []repository.OrderPaymentModel
+	if len(input.Payments) != 0 {
+		if payments, orderInfo.PayType, serr = newOrderPaymentModels(input.Payments, orderInfo.Total); serr != nil {
+			return nil, http.StatusBadRequest, serr
+		}
 	}
 
-	if err := s.repo.OrdersInfo.Recovery(where); err != nil {
-		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
-		return
+	//сохраняем заказ, позиции и списываем ингредиенты.
+	//Политика остатков проверяется по всем списаниям заказа в той же транзакции
+	var warnings []StockShortfallOutputModel
+	err = repo.Transaction(func(tx *repository.Repository) error {
+		if err := tx.OrdersInfo.Create(&orderInfo); err != nil {
+			return err
+		}
+
+		var deductions []repository.StockDeduction
+		for i := range orderList {
+			orderList[i].OrderInfoID = orderInfo.ID
+
+			lineDeductions, err := subtractOrderListIngredients(tx, &orderList[i], &details[i], repository.StockMovementModel{
+				Reason:     repository.STOCK_MOVE_SALE,
+				SourceID:   orderInfo.ID,
+				EmployeeID: claims.EmployeeID,
+			})
+			if err != nil {
+				return err
+			}
+			deductions = append(deductions, lineDeductions...)
+
+			if err := tx.OrdersList.Create(&orderList[i]); err != nil {
+				return err
+			}
+
+			if err := createOrderLineDetails(tx, orderList[i].ID, &details[i]); err != nil {
+				return err
+			}
+		}
+
+		for i := range payments {
+			payments[i].OrderInfoID = orderInfo.ID
+			payments[i].SessionID = orderInfo.SessionID
+			payments[i].OutletID = orderInfo.OutletID
+			payments[i].OrgID = orderInfo.OrgID
+
+			if err := tx.OrderPayments.Create(&payments[i]); err != nil {
+				return err
+			}
+		}
+
+		warnings, err = applyStockPolicy(tx, orderInfo.OutletID, deductions)
+		return err
+	})
+	if err != nil {
+		if serr, ok := stockShortfallError(err); ok {
+			return nil, http.StatusConflict, serr
+		}
+		return nil, http.StatusInternalServerError, errUnknown(err.Error())
 	}
 
-	NewResponse(c, http.StatusOK, nil)
+	output = &OrderInfoCheckoutOutput{
+		ID:            orderInfo.ID,
+		OrderListIDs:  make([]uint, len(orderList)),
+		StockWarnings: warnings,
+	}
+	for i, item := range orderList {
+		output.OrderListIDs[i] = item.ID
+	}
+	return output, http.StatusCreated, nil
+}
+
+type StockShortfallOutputModel struct {
+	IngredientID uint    `json:"ingredient_id"`
+	Name         string  `json:"name"`
+	Required     float64 `json:"required"`  // сколько нужно списать
+	Available    float64 `json:"available"` // остаток до списания
+}
+
+func newStockShortfallOutputModels(shortfalls []repository.StockShortfall) []StockShortfallOutputModel {
+	output := make([]StockShortfallOutputModel, len(shortfalls))
+	for i, item := range shortfalls {
+		output[i] = StockShortfallOutputModel{
+			IngredientID: item.IngredientID,
+			Name:         item.Name,
+			Required:     item.Required,
+			Available:    item.Available,
+		}
+	}
+	return output
+}
+
+//applyStockPolicy - проверяет списания продажи по политике отрицательных остатков точки. Вызывается в транзакции списания.
+//"Запретить" - возвращает *repository.StockShortfallError (транзакция откатывается), "предупредить" - нехватку для ответа
+func applyStockPolicy(tx *repository.Repository, outletID uint, deductions []repository.StockDeduction) (warnings []StockShortfallOutputModel, err error) {
+	shortfalls := repository.StockShortfalls(deductions)
+	if len(shortfalls) == 0 {
+		return nil, nil
+	}
+
+	policy, err := tx.Outlets.StockPolicy(outletID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch policy {
+	case repository.STOCK_POLICY_BLOCK:
+		return nil, &repository.StockShortfallError{Shortfalls: shortfalls}
+	case repository.STOCK_POLICY_WARN:
+		return newStockShortfallOutputModels(shortfalls), nil
+	}
+	return nil, nil
+}
+
+//stockShortfallError - ошибка сервиса со списком нехватки, если продажа отклонена политикой остатков
+func stockShortfallError(err error) (*serviceError, bool) {
+	var shortfall *repository.StockShortfallError
+	if !errors.As(err, &shortfall) {
+		return nil, false
+	}
+
+	serr := errStockShortfall(err.Error())
+	serr.Details = newStockShortfallOutputModels(shortfall.Shortfalls)
+	return serr, true
 }
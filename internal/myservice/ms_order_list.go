@@ -1,10 +1,14 @@
 package myservice
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/iivkis/pos.7-era.backend/internal/repository"
+	"github.com/iivkis/pos.7-era.backend/pkg/authjwt"
 	"gorm.io/gorm"
 )
 
@@ -13,6 +17,11 @@ type OrderListOutputModel struct {
 	Count        int     `json:"count"`
 	ProductName  string  `json:"product_name"`
 	ProductPrice float64 `json:"product_price"`
+	CatalogPrice float64 `json:"catalog_price"`
+	CostPrice    float64 `json:"cost_price"` // себестоимость единицы на момент продажи
+
+	Modifiers  []OrderListModifierOutputModel  `json:"modifiers"`  // выбранные опции модификаторов
+	Components []OrderListComponentOutputModel `json:"components"` // состав комплекта на момент продажи
 
 	ProductID   uint `json:"product_id"`
 	OrderInfoID uint `json:"order_info_id"`
@@ -20,6 +29,18 @@ type OrderListOutputModel struct {
 	OutletID    uint `json:"outlet_id"`
 }
 
+type OrderListModifierOutputModel struct {
+	ModifierOptionID uint    `json:"modifier_option_id"`
+	Name             string  `json:"name"`
+	PriceDelta       float64 `json:"price_delta"`
+}
+
+type OrderListComponentOutputModel struct {
+	ProductID   uint   `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Count       int    `json:"count"` // кол-во в одном комплекте
+}
+
 type OrdersListService struct {
 	repo *repository.Repository
 }
@@ -31,21 +52,32 @@ func newOrderListService(repo *repository.Repository) *OrdersListService {
 }
 
 type OrderListCreateInput struct {
-	Count        int     `json:"count"`
-	ProductName  string  `json:"product_name"`
-	ProductPrice float64 `json:"product_price"`
+	Count         int      `json:"count" binding:"min=1"`
+	ProductName   string   `json:"product_name"`               // не используется, название берется из каталога
+	ProductPrice  *float64 `json:"product_price,omitempty"`    // если не указана, то берется цена из каталога
+	PriceOverride bool     `json:"price_override"`             // продать по `product_price`, даже если она отличается от каталога (owner, director, admin)
+	Modifiers     []uint   `json:"modifiers" binding:"max=20"` // id выбранных опций модификаторов
 
 	ProductID   uint `json:"product_id" binding:"min=1"`
 	OrderInfoID uint `json:"order_info_id" binding:"min=1"`
 	SessionID   uint `json:"session_id" binding:"min=1"`
 }
 
+type OrderListCreateOutput struct {
+	ID            uint                        `json:"id"`
+	StockWarnings []StockShortfallOutputModel `json:"stock_warnings,omitempty"` //ингредиенты, ушедшие в минус (политика остатков "предупредить")
+}
+
 //@Summary Добавить orderList (список продутктов из которых состоит заказ)
+//@Description Название и цена позиции берутся из каталога продуктов, к цене прибавляются надбавки выбранных опций модификаторов.
+//@Description Если `product_price` отличается от цены в каталоге, то позиция отклоняется, если не указан `price_override` (доступно owner, director, admin).
 //@param type body OrderListCreateInput false "Принимаемый объект"
-//@Success 201 {object} DefaultOutputModel "возвращает id созданной записи"
+//@Success 201 {object} OrderListCreateOutput "возвращает id созданной записи"
 //@Accept json
 //@Produce json
 //@Failure 400 {object} serviceError
+//@Failure 403 {object} serviceError "изменение цены без прав (`price_override`)"
+//@Failure 409 {object} serviceError "не хватает ингредиентов (политика остатков - запретить)"
 //@Router /orderList [post]
 func (s *OrdersListService) Create(c *gin.Context) {
 	var input OrderListCreateInput
@@ -56,55 +88,254 @@ func (s *OrdersListService) Create(c *gin.Context) {
 
 	claims := mustGetEmployeeClaims(c)
 
-	model := repository.OrderListModel{
-		ProductName:  input.ProductName,
-		ProductPrice: input.ProductPrice,
-		ProductID:    input.ProductID,
-		Count:        input.Count,
-		OrderInfoID:  input.OrderInfoID,
-		SessionID:    input.SessionID,
-		OutletID:     claims.OutletID,
-		OrgID:        claims.OrganizationID,
-	}
-
-	if !s.repo.Sessions.Exists(&repository.SessionModel{Model: gorm.Model{ID: model.SessionID}, OutletID: model.OutletID}) {
+	if !s.repo.Sessions.Exists(&repository.SessionModel{Model: gorm.Model{ID: input.SessionID}, OutletID: claims.OutletID}) {
 		NewResponse(c, http.StatusBadRequest, errIncorrectInputData("undefined `session_id` with this `id`"))
 		return
 	}
 
-	if !s.repo.OrdersInfo.Exists(&repository.OrderInfoModel{Model: gorm.Model{ID: model.OrderInfoID}, OutletID: model.OutletID}) {
+	if !s.repo.OrdersInfo.Exists(&repository.OrderInfoModel{Model: gorm.Model{ID: input.OrderInfoID}, OutletID: claims.OutletID}) {
 		NewResponse(c, http.StatusBadRequest, errIncorrectInputData("undefined `order_info_id` with this `id`"))
 		return
 	}
 
-	if !s.repo.Products.Exists(&repository.ProductModel{ID: model.ProductID, OutletID: model.OutletID}) {
-		NewResponse(c, http.StatusBadRequest, errIncorrectInputData("undefined `product_id` with this `id`"))
+	model, details, code, serr := newOrderListModel(s.repo, claims, input.ProductID, input.Count, input.Modifiers, input.ProductPrice, input.PriceOverride)
+	if serr != nil {
+		NewResponse(c, code, serr)
 		return
 	}
+	model.OrderInfoID = input.OrderInfoID
+	model.SessionID = input.SessionID
+
+	var warnings []StockShortfallOutputModel
+	err := s.repo.Transaction(func(tx *repository.Repository) error {
+		deductions, err := subtractOrderListIngredients(tx, &model, &details, repository.StockMovementModel{
+			Reason:     repository.STOCK_MOVE_SALE,
+			SourceID:   model.OrderInfoID,
+			EmployeeID: claims.EmployeeID,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := tx.OrdersList.Create(&model); err != nil {
+			return err
+		}
+
+		if err := createOrderLineDetails(tx, model.ID, &details); err != nil {
+			return err
+		}
+
+		if err := tx.OrdersInfo.AddToTotals(model.OrderInfoID, model.CatalogPrice*float64(model.Count), model.ProductPrice*float64(model.Count)); err != nil {
+			return err
+		}
 
-	if err := s.repo.ProductsWithIngredients.SubractionIngredients(model.ProductID, model.Count); err != nil {
+		warnings, err = applyStockPolicy(tx, model.OutletID, deductions)
+		return err
+	})
+	if err != nil {
+		if serr, ok := stockShortfallError(err); ok {
+			NewResponse(c, http.StatusConflict, serr)
+			return
+		}
 		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
 		return
 	}
 
-	if err := s.repo.OrdersList.Create(&model); err != nil {
-		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
-		return
+	NewResponse(c, http.StatusCreated, OrderListCreateOutput{ID: model.ID, StockWarnings: warnings})
+}
+
+//orderLineDetails - выбранные опции модификаторов и состав комплекта позиции заказа
+type orderLineDetails struct {
+	Modifiers  []repository.OrderListModifierModel
+	Components []repository.OrderListComponentModel
+}
+
+//newOrderListModel - создает позицию заказа по данным продукта из каталога точки и выбранным опциям модификаторов (modifierIDs).
+//Цена в каталоге - цена продукта с надбавками опций. Для комплекта фиксируется его состав.
+//Цена, переданная клиентом, должна совпадать с ценой в каталоге, если только управляющий не подтвердил изменение цены (priceOverride)
+func newOrderListModel(repo *repository.Repository, claims *authjwt.EmployeeClaims, productID uint, count int, modifierIDs []uint, clientPrice *float64, priceOverride bool) (model repository.OrderListModel, details orderLineDetails, code int, serr *serviceError) {
+	product, err := repo.Products.FindFirst(&repository.ProductModel{ID: productID, OutletID: claims.OutletID})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model, details, http.StatusBadRequest, errIncorrectInputData(fmt.Sprintf("undefined `product_id` with id `%d`", productID))
+		}
+		return model, details, http.StatusInternalServerError, errUnknown(err.Error())
+	}
+
+	//себестоимость фиксируется на момент продажи.
+	//Себестоимость комплекта - сумма себестоимостей компонентов
+	var cost float64
+	if product.IsBundle {
+		details.Components, cost, err = selectBundleComponents(repo, product)
+	} else {
+		cost, err = repo.ProductsWithIngredients.UnitCost(product.ID)
+	}
+	if err != nil {
+		return model, details, http.StatusInternalServerError, errUnknown(err.Error())
+	}
+
+	if details.Modifiers, code, serr = selectModifiers(repo, product, modifierIDs); serr != nil {
+		return model, details, code, serr
+	}
+
+	price := product.Price
+	for _, modifier := range details.Modifiers {
+		price += modifier.PriceDelta
+		cost += modifier.CostPrice
+	}
+
+	if price < 0 {
+		return model, details, http.StatusBadRequest, errIncorrectInputData(fmt.Sprintf("price of product `%d` with modifiers can't be negative", product.ID))
+	}
+
+	model = repository.OrderListModel{
+		ProductName:  product.Name,
+		ProductPrice: price,
+		CatalogPrice: price,
+		CostPrice:    cost,
+		Count:        count,
+		ProductID:    product.ID,
+		OutletID:     claims.OutletID,
+		OrgID:        claims.OrganizationID,
+	}
+
+	if clientPrice != nil && math.Abs(*clientPrice-price) >= 0.01 {
+		if !priceOverride {
+			return model, details, http.StatusBadRequest, errPriceMismatch(fmt.Sprintf("product `%d` costs %.2f", product.ID, price))
+		}
+
+		if !claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR, repository.R_ADMIN) {
+			return model, details, http.StatusForbidden, errPermissionDenided("only owner, director or admin can override the product price")
+		}
+
+		if *clientPrice < 0 {
+			return model, details, http.StatusBadRequest, errIncorrectInputData("`product_price` can't be negative")
+		}
+
+		model.ProductPrice = *clientPrice
 	}
 
-	NewResponse(c, http.StatusCreated, DefaultOutputModel{ID: model.ID})
+	return model, details, http.StatusOK, nil
+}
+
+//createOrderLineDetails - сохраняет опции модификаторов и состав комплекта позиции заказа orderListID
+func createOrderLineDetails(tx *repository.Repository, orderListID uint, details *orderLineDetails) error {
+	for i := range details.Modifiers {
+		details.Modifiers[i].ID = 0
+		details.Modifiers[i].OrderListID = orderListID
+	}
+
+	if err := tx.Modifiers.CreateLineModifiers(details.Modifiers); err != nil {
+		return err
+	}
+
+	for i := range details.Components {
+		details.Components[i].ID = 0
+		details.Components[i].OrderListID = orderListID
+	}
+	return tx.Bundles.CreateLineComponents(details.Components)
+}
+
+//subtractOrderListIngredients - списывает ингредиенты позиции заказа: по рецепту продукта (для комплекта - по рецептам компонентов)
+//и по выбранным опциям модификаторов
+func subtractOrderListIngredients(tx *repository.Repository, line *repository.OrderListModel, details *orderLineDetails, move repository.StockMovementModel) ([]repository.StockDeduction, error) {
+	var deductions []repository.StockDeduction
+	if len(details.Components) != 0 {
+		for _, component := range details.Components {
+			componentDeductions, err := tx.ProductsWithIngredients.SubractionIngredients(component.ProductID, line.Count*component.Count, move)
+			if err != nil {
+				return nil, err
+			}
+			deductions = append(deductions, componentDeductions...)
+		}
+	} else {
+		var err error
+		if deductions, err = tx.ProductsWithIngredients.SubractionIngredients(line.ProductID, line.Count, move); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, modifier := range details.Modifiers {
+		optionDeductions, err := tx.Modifiers.SubtractOptionIngredients(modifier.ModifierOptionID, line.Count, move)
+		if err != nil {
+			return nil, err
+		}
+		deductions = append(deductions, optionDeductions...)
+	}
+	return deductions, nil
+}
+
+//returnOrderListIngredients - возвращает ингредиенты позиции заказа: по рецепту продукта (для комплекта - по рецептам компонентов)
+//и по выбранным опциям модификаторов
+func returnOrderListIngredients(tx *repository.Repository, line *repository.OrderListModel, details *orderLineDetails, move repository.StockMovementModel) error {
+	if len(details.Components) != 0 {
+		for _, component := range details.Components {
+			if err := tx.ProductsWithIngredients.AdditionIngredients(component.ProductID, line.Count*component.Count, move); err != nil {
+				return err
+			}
+		}
+	} else {
+		if err := tx.ProductsWithIngredients.AdditionIngredients(line.ProductID, line.Count, move); err != nil {
+			return err
+		}
+	}
+
+	for _, modifier := range details.Modifiers {
+		if err := tx.Modifiers.AddOptionIngredients(modifier.ModifierOptionID, line.Count, move); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//findOrderLineDetails - опции модификаторов и состав комплектов позиций заказа, по id позиции
+func findOrderLineDetails(repo *repository.Repository, lines []repository.OrderListModel) (map[uint]*orderLineDetails, error) {
+	byLine := make(map[uint]*orderLineDetails, len(lines))
+	if len(lines) == 0 {
+		return byLine, nil
+	}
+
+	ids := make([]uint, len(lines))
+	for i, line := range lines {
+		ids[i] = line.ID
+		byLine[line.ID] = &orderLineDetails{}
+	}
+
+	modifiers, err := repo.Modifiers.FindLineModifiers(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, modifier := range *modifiers {
+		byLine[modifier.OrderListID].Modifiers = append(byLine[modifier.OrderListID].Modifiers, modifier)
+	}
+
+	components, err := repo.Bundles.FindLineComponents(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, component := range *components {
+		byLine[component.OrderListID].Components = append(byLine[component.OrderListID].Components, component)
+	}
+	return byLine, nil
 }
 
 type OrderListGetAllQuery struct {
-	SessionID   uint `form:"session_id"`
-	OrderInfoID uint `form:"order_info_id"`
-	ProductID   uint `form:"product_id"`
+	SessionID   uint   `form:"session_id"`
+	OrderInfoID uint   `form:"order_info_id"`
+	ProductID   uint   `form:"product_id"`
+	Start       uint64 `form:"start"` //in unixmilli, по времени создания позиции
+	End         uint64 `form:"end"`   //in unixmilli, по времени создания позиции
 }
 
 type OrderListGetAllOutput []OrderListOutputModel
 
 //@Summary Получить список orderList точки (список продутктов из которых состоит заказ)
-//Param type query OrderListGetAllQuery false "Принимаемый объект"
+//@Description Поддерживает `offset`, `limit` и `sort` (id, count, product_price) из стандартного query.
+//@Description Общее кол-во записей возвращается в заголовке `X-Total-Count`
+//@Description Без `limit` возвращается 100 записей, если указаны `offset` или `sort`, иначе - до 1000 записей
+//@Param type query OrderListGetAllQuery false "Принимаемый объект"
 //@Accept json
 //@Produce json
 //@Success 200 {object} OrderListGetAllOutput "список orderList точки"
@@ -114,6 +345,7 @@ func (s *OrdersListService) GetAll(c *gin.Context) {
 	var query OrderListGetAllQuery
 	if err := c.ShouldBindQuery(&query); err != nil {
 		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
 	}
 
 	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
@@ -136,18 +368,48 @@ func (s *OrdersListService) GetAll(c *gin.Context) {
 		where.OutletID = stdQuery.OutletID
 	}
 
-	models, err := s.repo.OrdersList.FindUnscoped(where)
+	models, total, err := s.repo.OrdersList.FindPageUnscoped(where, stdQuery.listOptions(query.Start, query.End))
+	if err != nil {
+		listError(c, err)
+		return
+	}
+	setTotalCount(c, total)
+
+	details, err := findOrderLineDetails(s.repo, *models)
 	if err != nil {
 		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
 	}
 
 	var output OrderListGetAllOutput = make(OrderListGetAllOutput, len(*models))
 	for i, item := range *models {
+		lineModifiers := make([]OrderListModifierOutputModel, len(details[item.ID].Modifiers))
+		for j, modifier := range details[item.ID].Modifiers {
+			lineModifiers[j] = OrderListModifierOutputModel{
+				ModifierOptionID: modifier.ModifierOptionID,
+				Name:             modifier.Name,
+				PriceDelta:       modifier.PriceDelta,
+			}
+		}
+
+		lineComponents := make([]OrderListComponentOutputModel, len(details[item.ID].Components))
+		for j, component := range details[item.ID].Components {
+			lineComponents[j] = OrderListComponentOutputModel{
+				ProductID:   component.ProductID,
+				ProductName: component.ProductName,
+				Count:       component.Count,
+			}
+		}
+
 		output[i] = OrderListOutputModel{
 			ID:           item.ID,
 			Count:        item.Count,
 			ProductName:  item.ProductName,
 			ProductPrice: item.ProductPrice,
+			CatalogPrice: item.CatalogPrice,
+			CostPrice:    item.CostPrice,
+			Modifiers:    lineModifiers,
+			Components:   lineComponents,
 			ProductID:    item.ProductID,
 			OrderInfoID:  item.OrderInfoID,
 			SessionID:    item.SessionID,
@@ -172,6 +434,7 @@ func (s *OrdersListService) Calc(c *gin.Context) {
 	var query OrderListGetAllQuery
 	if err := c.ShouldBindQuery(&query); err != nil {
 		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
 	}
 
 	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
@@ -194,15 +457,13 @@ func (s *OrdersListService) Calc(c *gin.Context) {
 		where.OutletID = stdQuery.OutletID
 	}
 
-	models, err := s.repo.OrdersList.FindForCalculation(where)
+	total, err := s.repo.OrdersList.SumTotal(where)
 	if err != nil {
 		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
 	}
 
-	output := OrderListCalcOutput{}
-	for _, item := range *models {
-		output.Total += item.ProductPrice * float64(item.Count)
-	}
+	output := OrderListCalcOutput{Total: total}
 
 	NewResponse(c, http.StatusOK, output)
 }
@@ -0,0 +1,227 @@
+package myservice
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iivkis/pos.7-era.backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+type OrderPaymentOutputModel struct {
+	ID          uint    `json:"id"`
+	Type        int     `json:"type"` // 0 - наличные, 1 - карта, 2 - перевод, 3 - подарочная карта
+	Amount      float64 `json:"amount"`
+	ChangeGiven float64 `json:"change_given"`
+	OrderInfoID uint    `json:"order_info_id"`
+}
+
+type OrderPaymentsService struct {
+	repo *repository.Repository
+}
+
+func newOrderPaymentsService(repo *repository.Repository) *OrderPaymentsService {
+	return &OrderPaymentsService{
+		repo: repo,
+	}
+}
+
+type OrderPaymentInput struct {
+	Type        int     `json:"type" binding:"min=0,max=3"`   // 0 - наличные, 1 - карта, 2 - перевод, 3 - подарочная карта
+	Amount      float64 `json:"amount" binding:"gt=0"`        // сколько внесено
+	ChangeGiven float64 `json:"change_given" binding:"min=0"` // сдача (только для наличных)
+}
+
+//newOrderPaymentModels - проверяет, что оплата покрывает сумму заказа total, и возвращает записи об оплате.
+//payType - тип оплаты заказа по способам оплаты (0 - наличные, 1 - безналичные, 2 - смешанный)
+func newOrderPaymentModels(input []OrderPaymentInput, total float64) (payments []repository.OrderPaymentModel, payType int, serr *serviceError) {
+	var paid float64
+	var hasCash, hasBank bool
+
+	payments = make([]repository.OrderPaymentModel, len(input))
+	for i, item := range input {
+		if item.Type == repository.PAYMENT_CASH {
+			hasCash = true
+		} else {
+			hasBank = true
+			if item.ChangeGiven != 0 {
+				return nil, 0, errIncorrectInputData("`change_given` can be only for cash payment")
+			}
+		}
+
+		if item.ChangeGiven > item.Amount {
+			return nil, 0, errIncorrectInputData("`change_given` can't be greater than `amount`")
+		}
+
+		paid += item.Amount - item.ChangeGiven
+		payments[i] = repository.OrderPaymentModel{
+			Type:        item.Type,
+			Amount:      item.Amount,
+			ChangeGiven: item.ChangeGiven,
+		}
+	}
+
+	if math.Abs(paid-total) >= 0.01 {
+		return nil, 0, errIncorrectInputData("the sum of payments minus change must be equal to the order total")
+	}
+
+	switch {
+	case hasCash && hasBank:
+		payType = 2
+	case hasBank:
+		payType = 1
+	default:
+		payType = 0
+	}
+	return payments, payType, nil
+}
+
+//@Summary Записать оплату заказа (orderInfo)
+//@Description Заменяет записи об оплате заказа. Сумма оплат за вычетом сдачи должна совпадать с суммой заказа.
+//@Description `pay_type` заказа пересчитывается по способам оплаты. Изменить оплату можно только в открытой сессии.
+//@param type body []OrderPaymentInput false "Принимаемый объект"
+//@Accept json
+//@Produce json
+//@Success 201 {object} object "возвращает пустой объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /orderInfo/:id/payments [post]
+func (s *OrderPaymentsService) Set(c *gin.Context) {
+	orderInfoID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	var input []OrderPaymentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	if len(input) == 0 || len(input) > 10 {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData("you can transfer from 1 to 10 payments"))
+		return
+	}
+
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	where := &repository.OrderInfoModel{
+		Model:    gorm.Model{ID: uint(orderInfoID)},
+		OutletID: claims.OutletID,
+		OrgID:    claims.OrganizationID,
+	}
+
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		where.OutletID = stdQuery.OutletID
+	}
+
+	orderInfo, err := s.repo.OrdersInfo.FindFirst(where)
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	if orderInfo.ID == 0 {
+		NewResponse(c, http.StatusBadRequest, errRecordNotFound("undefined `order_info` with this `id`"))
+		return
+	}
+
+	sess, err := s.repo.Sessions.FindFirts(&repository.SessionModel{Model: gorm.Model{ID: orderInfo.SessionID}})
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	if sess.DateClose != 0 {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData("session already closed"))
+		return
+	}
+
+	payments, payType, serr := newOrderPaymentModels(input, orderInfo.Total)
+	if serr != nil {
+		NewResponse(c, http.StatusBadRequest, serr)
+		return
+	}
+
+	err = s.repo.Transaction(func(tx *repository.Repository) error {
+		if err := tx.OrderPayments.Delete(&repository.OrderPaymentModel{OrderInfoID: orderInfo.ID}); err != nil {
+			return err
+		}
+
+		for i := range payments {
+			payments[i].OrderInfoID = orderInfo.ID
+			payments[i].SessionID = orderInfo.SessionID
+			payments[i].OutletID = orderInfo.OutletID
+			payments[i].OrgID = orderInfo.OrgID
+
+			if err := tx.OrderPayments.Create(&payments[i]); err != nil {
+				return err
+			}
+		}
+
+		return tx.OrdersInfo.UpdatesFull(&repository.OrderInfoModel{Model: gorm.Model{ID: orderInfo.ID}}, &map[string]interface{}{"pay_type": payType})
+	})
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	NewResponse(c, http.StatusCreated, nil)
+}
+
+type OrderPaymentsGetAllOutput []OrderPaymentOutputModel
+
+//@Summary Получить оплату заказа (orderInfo)
+//@Accept json
+//@Produce json
+//@Success 200 {object} OrderPaymentsGetAllOutput "список оплат заказа"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /orderInfo/:id/payments [get]
+func (s *OrderPaymentsService) GetAll(c *gin.Context) {
+	orderInfoID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	where := &repository.OrderPaymentModel{
+		OrderInfoID: uint(orderInfoID),
+		OutletID:    claims.OutletID,
+		OrgID:       claims.OrganizationID,
+	}
+
+	if claims.HasRole(repository.R_OWNER) {
+		if stdQuery.OrgID != 0 && s.repo.Invitation.Exists(&repository.InvitationModel{OrgID: claims.OrganizationID, AffiliateOrgID: stdQuery.OrgID}) {
+			where.OrgID = stdQuery.OrgID
+		}
+	}
+
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		where.OutletID = stdQuery.OutletID
+	}
+
+	payments, err := s.repo.OrderPayments.Find(where)
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	output := make(OrderPaymentsGetAllOutput, len(*payments))
+	for i, item := range *payments {
+		output[i] = OrderPaymentOutputModel{
+			ID:          item.ID,
+			Type:        item.Type,
+			Amount:      item.Amount,
+			ChangeGiven: item.ChangeGiven,
+			OrderInfoID: item.OrderInfoID,
+		}
+	}
+
+	NewResponse(c, http.StatusOK, output)
+}
@@ -0,0 +1,95 @@
+package myservice
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iivkis/pos.7-era.backend/internal/repository"
+)
+
+type OrganizationOutputModel struct {
+	ID                   uint   `json:"id"`
+	Name                 string `json:"name"`
+	Email                string `json:"email"`
+	EmailConfirmed       bool   `json:"email_confirmed"`
+	EmailConfirmDeadline int64  `json:"email_confirm_deadline"` // до какого момента можно входить без подтверждения email (unixmilli)
+	PendingEmail         string `json:"pending_email"`          // новый email, ожидающий подтверждения (см. /auth/changeEmail)
+	StockPolicy          int    `json:"stock_policy"`           // политика отрицательных остатков для точек [0, 1 - разрешить, 2 - предупредить, 3 - запретить]
+}
+
+type OrganizationsService struct {
+	repo *repository.Repository
+}
+
+func newOrganizationsService(repo *repository.Repository) *OrganizationsService {
+	return &OrganizationsService{
+		repo: repo,
+	}
+}
+
+//@Summary Получить настройки организации
+//@Accept json
+//@Produce json
+//@Success 200 {object} OrganizationOutputModel "возвращаемый объект"
+//@Failure 500 {object} serviceError
+//@Router /organization [get]
+func (s *OrganizationsService) Get(c *gin.Context) {
+	claims := mustGetEmployeeClaims(c)
+
+	org, err := s.repo.Organizations.FindFirts(&repository.OrganizationModel{ID: claims.OrganizationID})
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	NewResponse(c, http.StatusOK, OrganizationOutputModel{
+		ID:                   org.ID,
+		Name:                 org.Name,
+		Email:                org.Email,
+		EmailConfirmed:       org.EmailConfirmed,
+		EmailConfirmDeadline: org.EmailConfirmDeadline,
+		PendingEmail:         org.PendingEmail,
+		StockPolicy:          org.StockPolicy,
+	})
+}
+
+type OrganizationUpdateFieldsInput struct {
+	Name        *string `json:"name,omitempty" binding:"omitempty,min=1,max=100"`
+	StockPolicy *int    `json:"stock_policy,omitempty" binding:"omitempty,min=0,max=3"` // 0, 1 - разрешить, 2 - предупредить, 3 - запретить
+}
+
+//@Summary Обновить настройки организации
+//@param type body OrganizationUpdateFieldsInput false "Обновляемые поля"
+//@Accept json
+//@Produce json
+//@Success 200 {object} object "возвращает пустой объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /organization [put]
+func (s *OrganizationsService) UpdateFields(c *gin.Context) {
+	var input OrganizationUpdateFieldsInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	claims := mustGetEmployeeClaims(c)
+
+	updatedFields := make(map[string]interface{})
+	if input.Name != nil {
+		updatedFields["name"] = *input.Name
+	}
+
+	if input.StockPolicy != nil {
+		updatedFields["stock_policy"] = *input.StockPolicy
+	}
+
+	if len(updatedFields) != 0 {
+		if err := s.repo.Organizations.UpdatesFull(&repository.OrganizationModel{ID: claims.OrganizationID}, &updatedFields); err != nil {
+			NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+			return
+		}
+	}
+
+	NewResponse(c, http.StatusOK, nil)
+}
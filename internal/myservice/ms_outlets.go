@@ -14,8 +14,9 @@ type OutletsService struct {
 }
 
 type outletOutputModel struct {
-	ID   uint   `json:"id"`
-	Name string `json:"name"`
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	StockPolicy int    `json:"stock_policy"` // политика отрицательных остатков [0 - как у организации, 1 - разрешить, 2 - предупредить, 3 - запретить]
 }
 
 func newOutletsService(repo *repository.Repository) *OutletsService {
@@ -29,11 +30,12 @@ type OutletCreateInput struct {
 }
 
 //@Summary Добавить торговую точку (токен юзера)
-//@Description Метод позволяет добавить торговую точку
+//@Description Метод позволяет добавить торговую точку. Доступно только после подтверждения email организации
 //@Param json body OutletCreateInput true "Объект для добавления торговой точки."
 //@Accept json
 //@Produce json
 //@Success 200 {object} DefaultOutputModel "возвращает id созданной записи"
+//@Failure 403 {object} serviceError "email организации не подтвержден дольше разрешенного срока"
 //@Failure 500 {object} serviceError
 //@Router /outlets [post]
 func (s *OutletsService) Create(c *gin.Context) {
@@ -90,19 +92,21 @@ func (s *OutletsService) GetAllForOrg(c *gin.Context) {
 	output := make(OutletGetAllOutput, len(*outlets))
 	for i, outlet := range *outlets {
 		output[i] = outletOutputModel{
-			ID:   outlet.ID,
-			Name: outlet.Name,
+			ID:          outlet.ID,
+			Name:        outlet.Name,
+			StockPolicy: outlet.StockPolicy,
 		}
 	}
 	NewResponse(c, http.StatusOK, output)
 }
 
 type OutletUpdateFieldsInput struct {
-	Name string `json:"name"`
+	Name        string `json:"name"`
+	StockPolicy *int   `json:"stock_policy,omitempty" binding:"omitempty,min=0,max=3"` // 0 - как у организации, 1 - разрешить, 2 - предупредить, 3 - запретить
 }
 
 //@Summary Обновить точку (токен юзера)
-//@Param json body OutletCreateInput false "Обновляемые поля"
+//@Param json body OutletUpdateFieldsInput false "Обновляемые поля"
 //@Accept json
 //@Produce json
 //@Success 200 {object} object "возвращает пустой объект"
@@ -117,8 +121,13 @@ func (s *OutletsService) UpdateFields(c *gin.Context) {
 
 	claims := mustGetEmployeeClaims(c)
 
-	updatedFields := &repository.OutletModel{
-		Name: input.Name,
+	updatedFields := make(map[string]interface{})
+	if input.Name != "" {
+		updatedFields["name"] = input.Name
+	}
+
+	if input.StockPolicy != nil {
+		updatedFields["stock_policy"] = *input.StockPolicy
 	}
 
 	outletID, err := strconv.Atoi(c.Param("id"))
@@ -132,9 +141,11 @@ func (s *OutletsService) UpdateFields(c *gin.Context) {
 		return
 	}
 
-	if err := s.repo.Outlets.Updates(&repository.OutletModel{Model: gorm.Model{ID: uint(outletID)}, OrgID: claims.OrganizationID}, updatedFields); err != nil {
-		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
-		return
+	if len(updatedFields) != 0 {
+		if err := s.repo.Outlets.UpdatesFull(&repository.OutletModel{Model: gorm.Model{ID: uint(outletID)}, OrgID: claims.OrganizationID}, &updatedFields); err != nil {
+			NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+			return
+		}
 	}
 
 	NewResponse(c, http.StatusOK, nil)
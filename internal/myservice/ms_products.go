@@ -23,6 +23,7 @@ type ProductOutputModel struct {
 
 	Price         float64 `json:"price"`
 	SellerPercent float64 `json:"seller_percent"`
+	IsBundle      bool    `json:"is_bundle"` // комплект из других продуктов
 
 	CategoryID uint `json:"category_id"`
 	OutletID   uint `json:"outlet_id"`
@@ -48,10 +49,12 @@ type ProductCreateInput struct {
 	Price          float64 `json:"price" binding:"min=0"`
 	SellerPercent  float64 `json:"seller_percent" binding:"min=0,max=100"`
 	PhotoID        string  `json:"photo_id" binding:"max=500"`
+	IsBundle       bool    `json:"is_bundle"` // комплект (комбо), состав задается через /bundleComponents
 	CategoryID     uint    `json:"category_id"`
 }
 
 // @Summary Добавить новый продукт в точку
+// @Description Если `is_bundle`, то `price` - цена всего комплекта. У комплекта нет своего рецепта, признак не меняется после создания
 // @param type body ProductCreateInput false "Принимаемый объект"
 // @Success 201 {object} DefaultOutputModel "возвращает id созданной записи"
 // @Accept json
@@ -76,6 +79,7 @@ func (s *ProductsService) Create(c *gin.Context) {
 		Amount:         input.Amount,
 		Price:          input.Price,
 		SellerPercent:  input.SellerPercent / 100,
+		IsBundle:       input.IsBundle,
 
 		PhotoCloudID: input.PhotoID,
 
@@ -147,6 +151,7 @@ func (s *ProductsService) GetAll(c *gin.Context) {
 			Amount:        product.Amount,
 			Price:         product.Price,
 			SellerPercent: product.SellerPercent * 100,
+			IsBundle:      product.IsBundle,
 
 			Photo: s.s3cloud.GetURIFromFileID(product.PhotoCloudID),
 
@@ -158,6 +163,100 @@ func (s *ProductsService) GetAll(c *gin.Context) {
 	NewResponse(c, http.StatusOK, output)
 }
 
+type ProductCostOutputModel struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+
+	Price    float64 `json:"price"`
+	UnitCost float64 `json:"unit_cost"` // себестоимость по рецепту
+	Margin   float64 `json:"margin"`    // валовая маржа в процентах от цены
+
+	CategoryID uint `json:"category_id"`
+	OutletID   uint `json:"outlet_id"`
+}
+
+type ProductGetCostOutput []ProductCostOutputModel
+
+// @Summary Себестоимость продуктов точки
+// @Description Себестоимость единицы продукта считается по рецепту (кол-во ингредиента * закупочная цена ингредиента).
+// @Description Себестоимость комплекта - сумма себестоимостей его компонентов
+// @Success 200 {object} ProductGetCostOutput "возвращает себестоимость и маржу продуктов точки"
+// @Accept json
+// @Produce json
+// @Failure 400 {object} serviceError
+// @Failure 500 {object} serviceError
+// @Router /products.Cost [get]
+func (s *ProductsService) GetCost(c *gin.Context) {
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	where := &repository.ProductModel{
+		OrgID:    claims.OrganizationID,
+		OutletID: claims.OutletID,
+	}
+
+	if claims.HasRole(repository.R_OWNER) {
+		if stdQuery.OrgID != 0 && s.repo.Invitation.Exists(&repository.InvitationModel{OrgID: claims.OrganizationID, AffiliateOrgID: stdQuery.OrgID}) {
+			where.OrgID = stdQuery.OrgID
+		}
+	}
+
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		where.OutletID = stdQuery.OutletID
+	}
+
+	products, err := s.repo.Products.Find(where)
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	costs, err := s.repo.ProductsWithIngredients.UnitCosts(&repository.ProductWithIngredientModel{OutletID: where.OutletID, OrgID: where.OrgID})
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	costByProduct := make(map[uint]float64, len(costs))
+	for _, item := range costs {
+		costByProduct[item.ProductID] = item.Cost
+	}
+
+	components, err := s.repo.Bundles.Find(&repository.BundleComponentModel{OutletID: where.OutletID, OrgID: where.OrgID})
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	bundleCost := make(map[uint]float64)
+	for _, item := range *components {
+		bundleCost[item.BundleID] += costByProduct[item.ComponentID] * float64(item.Count)
+	}
+
+	output := make(ProductGetCostOutput, len(*products))
+	for i, product := range *products {
+		output[i] = ProductCostOutputModel{
+			ID:   product.ID,
+			Name: product.Name,
+
+			Price:    product.Price,
+			UnitCost: costByProduct[product.ID],
+
+			CategoryID: product.CategoryID,
+			OutletID:   product.OutletID,
+		}
+
+		if product.IsBundle {
+			output[i].UnitCost = bundleCost[product.ID]
+		}
+
+		if product.Price != 0 {
+			output[i].Margin = (product.Price - output[i].UnitCost) / product.Price * 100
+		}
+	}
+
+	NewResponse(c, http.StatusOK, output)
+}
+
 // @Summary Продукт точки
 // @Success 200 {object} ProductOutputModel "возвращает один продукт из точки"
 // @Accept json
@@ -203,6 +302,7 @@ func (s *ProductsService) GetOne(c *gin.Context) {
 		Amount:        product.Amount,
 		Price:         product.Price,
 		SellerPercent: product.SellerPercent * 100,
+		IsBundle:      product.IsBundle,
 
 		Photo: s.s3cloud.GetURIFromFileID(product.PhotoCloudID),
 
@@ -324,6 +424,12 @@ func (s *ProductsService) Delete(c *gin.Context) {
 
 	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
 
+	//продукт, входящий в комплект, нельзя удалить, пока он не убран из комплекта
+	if s.repo.Bundles.IsComponent(uint(productID)) {
+		NewResponse(c, http.StatusBadRequest, errForeignKey("the product is a component of a bundle"))
+		return
+	}
+
 	where1 := &repository.ProductWithIngredientModel{ProductID: uint(productID), OrgID: claims.OrganizationID, OutletID: claims.OutletID}
 	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
 		where1.OutletID = stdQuery.OutletID
@@ -339,6 +445,16 @@ func (s *ProductsService) Delete(c *gin.Context) {
 		}
 	}
 
+	where3 := &repository.BundleComponentModel{BundleID: uint(productID), OrgID: claims.OrganizationID, OutletID: claims.OutletID}
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		where3.OutletID = stdQuery.OutletID
+	}
+
+	if err := s.repo.Bundles.Delete(where3); err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
 	where2 := &repository.ProductModel{ID: uint(productID), OrgID: claims.OrganizationID, OutletID: claims.OutletID}
 	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
 		where1.OutletID = stdQuery.OutletID
@@ -28,6 +28,7 @@ func newProductsWithIngredientsService(repo *repository.Repository) *ProductsWit
 
 type PWICreateInput struct {
 	CountTakeForSell float64 `json:"count_take_for_sell"`
+	Unit             int     `json:"unit" binding:"min=0,max=6"` // единица `count_take_for_sell` (0 - единица хранения ингредиента)
 	ProductID        uint    `json:"product_id" binding:"min=1"`
 	IngredientID     uint    `json:"ingredient_id" binding:"min=1"`
 }
@@ -64,12 +65,26 @@ func (s *ProductsWithIngredientsService) Create(c *gin.Context) {
 		}
 	}
 
-	if !s.repo.Products.Exists(&repository.ProductModel{ID: pwiModel.ProductID, OutletID: pwiModel.OutletID}) ||
-		!s.repo.Ingredients.Exists(&repository.IngredientModel{ID: pwiModel.IngredientID, OutletID: pwiModel.OutletID}) {
+	ingredient, err := s.repo.Ingredients.FindFirts(&repository.IngredientModel{ID: pwiModel.IngredientID, OutletID: pwiModel.OutletID})
+	if err != nil || !s.repo.Products.Exists(&repository.ProductModel{ID: pwiModel.ProductID, OutletID: pwiModel.OutletID}) {
 		NewResponse(c, http.StatusBadRequest, errIncorrectInputData("not found product or ingredient with this `id` in outlet"))
 		return
 	}
 
+	//у комплекта нет своего рецепта, ингредиенты списываются по рецептам компонентов
+	if s.repo.Products.Exists(&repository.ProductModel{ID: pwiModel.ProductID, IsBundle: true}) {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData("bundle product can't have its own recipe"))
+		return
+	}
+
+	//рецепт хранится в единицах хранения ингредиента
+	count, serr := convertIngredientCount(ingredient, input.CountTakeForSell, input.Unit)
+	if serr != nil {
+		NewResponse(c, http.StatusBadRequest, serr)
+		return
+	}
+	pwiModel.CountTakeForSell = count
+
 	if err := s.repo.ProductsWithIngredients.Create(pwiModel); err != nil {
 		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
 		return
@@ -168,6 +183,7 @@ func (s *ProductsWithIngredientsService) Delete(c *gin.Context) {
 
 type PWIUpdateFields struct {
 	CountTakeForSell float64 `json:"count_take_for_sell"`
+	Unit             int     `json:"unit" binding:"min=0,max=6"` // единица `count_take_for_sell` (0 - единица хранения ингредиента)
 	ProductID        uint    `json:"product_id"`
 }
 
@@ -201,6 +217,28 @@ func (s *ProductsWithIngredientsService) UpdateFields(c *gin.Context) {
 		ProductID:        input.ProductID,
 	}
 
+	//рецепт хранится в единицах хранения ингредиента
+	if input.Unit != 0 && input.CountTakeForSell != 0 {
+		pwi, err := s.repo.ProductsWithIngredients.FindFirst(where)
+		if err != nil {
+			NewResponse(c, http.StatusBadRequest, errRecordNotFound("undefined pwi with this id"))
+			return
+		}
+
+		ingredient, err := s.repo.Ingredients.FindFirts(&repository.IngredientModel{ID: pwi.IngredientID})
+		if err != nil {
+			NewResponse(c, http.StatusBadRequest, errRecordNotFound("undefined ingredient of this pwi"))
+			return
+		}
+
+		count, serr := convertIngredientCount(ingredient, input.CountTakeForSell, input.Unit)
+		if serr != nil {
+			NewResponse(c, http.StatusBadRequest, serr)
+			return
+		}
+		updatedFields.CountTakeForSell = count
+	}
+
 	if err := s.repo.ProductsWithIngredients.Updates(where, updatedFields); err != nil {
 		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
 		return
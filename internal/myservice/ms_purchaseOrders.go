@@ -0,0 +1,530 @@
+package myservice
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iivkis/pos.7-era.backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+//errPurchaseOrderStatus - статус заказа поставщику не позволяет выполнить операцию
+var errPurchaseOrderStatus = errors.New("purchase order status does not allow this operation")
+
+type PurchaseOrderLineOutputModel struct {
+	ID            uint    `json:"id"`
+	Count         float64 `json:"count"`          // сколько заказано
+	Price         float64 `json:"price"`          // ожидаемая цена за единицу
+	ReceivedCount float64 `json:"received_count"` // сколько уже получено
+	IngredientID  uint    `json:"ingredient_id"`
+}
+
+type PurchaseOrderOutputModel struct {
+	ID         uint                           `json:"id"`
+	Status     int                            `json:"status"` // 1 - черновик, 2 - отправлен, 3 - получен частично, 4 - получен, 5 - отменен
+	Total      float64                        `json:"total"`  // ожидаемая сумма заказа
+	Comment    string                         `json:"comment"`
+	Date       int64                          `json:"date"` //unixmilli
+	SupplierID uint                           `json:"supplier_id"`
+	EmployeeID uint                           `json:"employee_id"`
+	OutletID   uint                           `json:"outlet_id"`
+	Lines      []PurchaseOrderLineOutputModel `json:"lines,omitempty"`
+}
+
+func newPurchaseOrderOutputModel(order *repository.PurchaseOrderModel) PurchaseOrderOutputModel {
+	return PurchaseOrderOutputModel{
+		ID:         order.ID,
+		Status:     order.Status,
+		Total:      order.Total,
+		Comment:    order.Comment,
+		Date:       order.Date,
+		SupplierID: order.SupplierID,
+		EmployeeID: order.EmployeeID,
+		OutletID:   order.OutletID,
+	}
+}
+
+type PurchaseOrdersService struct {
+	repo *repository.Repository
+}
+
+func newPurchaseOrdersService(repo *repository.Repository) *PurchaseOrdersService {
+	return &PurchaseOrdersService{
+		repo: repo,
+	}
+}
+
+type PurchaseOrderLineInput struct {
+	IngredientID uint    `json:"ingredient_id" binding:"min=1"`
+	Count        float64 `json:"count" binding:"gt=0"`
+	Price        float64 `json:"price" binding:"min=0"`
+}
+
+type PurchaseOrderCreateInput struct {
+	SupplierID uint                     `json:"supplier_id" binding:"min=1"`
+	Comment    string                   `json:"comment" binding:"max=500"`
+	Lines      []PurchaseOrderLineInput `json:"lines" binding:"required,min=1,max=100,dive"`
+}
+
+//@Summary Создать заказ поставщику (черновик)
+//@param type body PurchaseOrderCreateInput false "Принимаемый объект"
+//@Accept json
+//@Produce json
+//@Success 201 {object} DefaultOutputModel "возвращает id созданной записи"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /purchaseOrders [post]
+func (s *PurchaseOrdersService) Create(c *gin.Context) {
+	var input PurchaseOrderCreateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	order := repository.PurchaseOrderModel{
+		Status:     repository.PO_DRAFT,
+		Comment:    input.Comment,
+		Date:       time.Now().UTC().UnixMilli(),
+		SupplierID: input.SupplierID,
+		EmployeeID: claims.EmployeeID,
+		OutletID:   claims.OutletID,
+		OrgID:      claims.OrganizationID,
+	}
+
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		if stdQuery.OutletID != 0 && s.repo.Outlets.ExistsInOrg(stdQuery.OutletID, claims.OrganizationID) {
+			order.OutletID = stdQuery.OutletID
+		}
+	}
+
+	if serr := s.checkInput(&order, input.Lines); serr != nil {
+		NewResponse(c, http.StatusBadRequest, serr)
+		return
+	}
+	order.Total = purchaseOrderTotal(input.Lines)
+
+	err := s.repo.Transaction(func(tx *repository.Repository) error {
+		if err := tx.PurchaseOrders.Create(&order); err != nil {
+			return err
+		}
+		return createPurchaseOrderLines(tx, order.ID, input.Lines)
+	})
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	NewResponse(c, http.StatusCreated, DefaultOutputModel{ID: order.ID})
+}
+
+type PurchaseOrderGetAllQuery struct {
+	Status     int    `form:"status" binding:"min=0,max=5"`
+	SupplierID uint   `form:"supplier_id"`
+	Start      uint64 `form:"start"` //in unixmilli
+	End        uint64 `form:"end"`   //in unixmilli
+}
+
+type PurchaseOrderGetAllOutput []PurchaseOrderOutputModel
+
+//@Summary Список заказов поставщикам (без позиций)
+//@Description Поддерживает `offset`, `limit` и `sort` (id, date, total, status) из стандартного query.
+//@Description Общее кол-во записей возвращается в заголовке `X-Total-Count`
+//@Description Без `limit` возвращается 100 записей, если указаны `offset` или `sort`, иначе - до 1000 записей
+//@param type query PurchaseOrderGetAllQuery false "Принимаемый объект"
+//@Accept json
+//@Produce json
+//@Success 200 {object} PurchaseOrderGetAllOutput "возвращаемый объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /purchaseOrders [get]
+func (s *PurchaseOrdersService) GetAll(c *gin.Context) {
+	var query PurchaseOrderGetAllQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	where := &repository.PurchaseOrderModel{
+		Status:     query.Status,
+		SupplierID: query.SupplierID,
+		OutletID:   claims.OutletID,
+		OrgID:      claims.OrganizationID,
+	}
+
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		where.OutletID = stdQuery.OutletID
+	}
+
+	orders, total, err := s.repo.PurchaseOrders.FindPage(where, stdQuery.listOptions(query.Start, query.End))
+	if err != nil {
+		listError(c, err)
+		return
+	}
+	setTotalCount(c, total)
+
+	output := make(PurchaseOrderGetAllOutput, len(*orders))
+	for i := range *orders {
+		output[i] = newPurchaseOrderOutputModel(&(*orders)[i])
+	}
+	NewResponse(c, http.StatusOK, output)
+}
+
+//@Summary Заказ поставщику с позициями
+//@Accept json
+//@Produce json
+//@Success 200 {object} PurchaseOrderOutputModel "возвращаемый объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /purchaseOrders/:id [get]
+func (s *PurchaseOrdersService) GetOne(c *gin.Context) {
+	order, ok := s.findOrder(c)
+	if !ok {
+		return
+	}
+
+	lines, err := s.repo.PurchaseOrders.FindLines(&repository.PurchaseOrderLineModel{PurchaseOrderID: order.ID})
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	output := newPurchaseOrderOutputModel(order)
+	output.Lines = make([]PurchaseOrderLineOutputModel, len(*lines))
+	for i, line := range *lines {
+		output.Lines[i] = PurchaseOrderLineOutputModel{
+			ID:            line.ID,
+			Count:         line.Count,
+			Price:         line.Price,
+			ReceivedCount: line.ReceivedCount,
+			IngredientID:  line.IngredientID,
+		}
+	}
+	NewResponse(c, http.StatusOK, output)
+}
+
+type PurchaseOrderUpdateInput struct {
+	SupplierID *uint                     `json:"supplier_id,omitempty" binding:"omitempty,min=1"`
+	Comment    *string                   `json:"comment,omitempty" binding:"omitempty,max=500"`
+	Lines      *[]PurchaseOrderLineInput `json:"lines,omitempty" binding:"omitempty,min=1,max=100,dive"` // если указаны, то заменяют все позиции
+}
+
+//@Summary Обновить черновик заказа поставщику
+//@param type body PurchaseOrderUpdateInput false "Обновляемые поля"
+//@Accept json
+//@Produce json
+//@Success 200 {object} object "возвращает пустой объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /purchaseOrders/:id [put]
+func (s *PurchaseOrdersService) UpdateFields(c *gin.Context) {
+	var input PurchaseOrderUpdateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	order, ok := s.findOrder(c)
+	if !ok {
+		return
+	}
+
+	if order.Status != repository.PO_DRAFT {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData("only draft purchase order can be changed"))
+		return
+	}
+
+	updatedFields := make(map[string]interface{})
+	if input.SupplierID != nil {
+		order.SupplierID = *input.SupplierID
+		updatedFields["supplier_id"] = *input.SupplierID
+	}
+
+	if input.Comment != nil {
+		updatedFields["comment"] = *input.Comment
+	}
+
+	var lines []PurchaseOrderLineInput
+	if input.Lines != nil {
+		lines = *input.Lines
+		updatedFields["total"] = purchaseOrderTotal(lines)
+	}
+
+	if serr := s.checkInput(order, lines); serr != nil {
+		NewResponse(c, http.StatusBadRequest, serr)
+		return
+	}
+
+	err := s.repo.Transaction(func(tx *repository.Repository) error {
+		//заказ могли отправить после проверки статуса
+		if status, err := tx.PurchaseOrders.LockStatus(order.ID); err != nil {
+			return err
+		} else if status != repository.PO_DRAFT {
+			return errPurchaseOrderStatus
+		}
+
+		if len(updatedFields) != 0 {
+			if err := tx.PurchaseOrders.UpdatesFull(&repository.PurchaseOrderModel{ID: order.ID}, &updatedFields); err != nil {
+				return err
+			}
+		}
+
+		if input.Lines == nil {
+			return nil
+		}
+
+		if err := tx.PurchaseOrders.DeleteLines(&repository.PurchaseOrderLineModel{PurchaseOrderID: order.ID}); err != nil {
+			return err
+		}
+		return createPurchaseOrderLines(tx, order.ID, lines)
+	})
+	if err != nil {
+		if errors.Is(err, errPurchaseOrderStatus) {
+			NewResponse(c, http.StatusBadRequest, errIncorrectInputData("only draft purchase order can be changed"))
+			return
+		}
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	NewResponse(c, http.StatusOK, nil)
+}
+
+//@Summary Отметить заказ поставщику отправленным
+//@Description Доступно только для черновика. После отправки позиции менять нельзя
+//@Accept json
+//@Produce json
+//@Success 200 {object} object "возвращает пустой объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /purchaseOrders/:id/send [post]
+func (s *PurchaseOrdersService) Send(c *gin.Context) {
+	s.setStatus(c, repository.PO_SENT, repository.PO_DRAFT)
+}
+
+//@Summary Отменить заказ поставщику
+//@Description Уже полученные позиции остаются на складе
+//@Accept json
+//@Produce json
+//@Success 200 {object} object "возвращает пустой объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /purchaseOrders/:id/cancel [post]
+func (s *PurchaseOrdersService) Cancel(c *gin.Context) {
+	s.setStatus(c, repository.PO_CANCELLED, repository.PO_DRAFT, repository.PO_SENT, repository.PO_PARTIALLY_RECEIVED)
+}
+
+type PurchaseOrderReceiveLineInput struct {
+	LineID uint     `json:"line_id" binding:"min=1"`
+	Count  float64  `json:"count" binding:"gt=0"`
+	Price  *float64 `json:"price,omitempty" binding:"omitempty,min=0"` // фактическая цена за единицу (по умолчанию - из заказа)
+}
+
+type PurchaseOrderReceiveInput struct {
+	Date     int64                           `json:"date" binding:"min=1"` //unixmilli
+	WriteOff bool                            `json:"write_off"`            // оплачено из кассы
+	Lines    []PurchaseOrderReceiveLineInput `json:"lines" binding:"required,min=1,max=100,dive"`
+}
+
+type PurchaseOrderReceiveOutput struct {
+	Status int `json:"status"` // новый статус заказа (3 - получен частично, 4 - получен)
+}
+
+//@Summary Приемка товара по заказу поставщику
+//@Description Полученные позиции проводятся как поступление ингредиентов (/ingredients.Arrival):
+//@Description остатки, история поступлений и запись в кассе (если `write_off`).
+//@Description Когда все позиции получены, заказ становится полученным, иначе - полученным частично.
+//@param type body PurchaseOrderReceiveInput false "Принимаемый объект"
+//@Accept json
+//@Produce json
+//@Success 200 {object} PurchaseOrderReceiveOutput "возвращает новый статус заказа"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /purchaseOrders/:id/receive [post]
+func (s *PurchaseOrdersService) Receive(c *gin.Context) {
+	var input PurchaseOrderReceiveInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	order, ok := s.findOrder(c)
+	if !ok {
+		return
+	}
+
+	claims := mustGetEmployeeClaims(c)
+
+	var status int
+	err := s.repo.Transaction(func(tx *repository.Repository) error {
+		//статус блокируется до конца приемки: одновременные отмена и приемка ждут ее завершения
+		current, err := tx.PurchaseOrders.LockStatus(order.ID)
+		if err != nil {
+			return err
+		}
+
+		if current != repository.PO_SENT && current != repository.PO_PARTIALLY_RECEIVED {
+			return errPurchaseOrderStatus
+		}
+
+		lines, err := tx.PurchaseOrders.FindLines(&repository.PurchaseOrderLineModel{PurchaseOrderID: order.ID})
+		if err != nil {
+			return err
+		}
+
+		byID := make(map[uint]repository.PurchaseOrderLineModel, len(*lines))
+		for _, line := range *lines {
+			byID[line.ID] = line
+		}
+
+		arrivals := make([]IngredientArrivalInput, len(input.Lines))
+		for i, item := range input.Lines {
+			line, ok := byID[item.LineID]
+			if !ok {
+				return fmt.Errorf("%w: undefined `line_id` %d", gorm.ErrRecordNotFound, item.LineID)
+			}
+
+			price := line.Price
+			if item.Price != nil {
+				price = *item.Price
+			}
+
+			arrivals[i] = IngredientArrivalInput{
+				IngredientID: line.IngredientID,
+				Count:        item.Count,
+				WriteOff:     input.WriteOff,
+				Price:        price,
+				Date:         input.Date,
+			}
+
+			if err := tx.PurchaseOrders.AddReceived(line.ID, item.Count); err != nil {
+				return err
+			}
+		}
+
+		if err := receiveIngredients(tx, claims, order.OutletID, arrivals, fmt.Sprintf("receipt of goods (purchase order %d)", order.ID)); err != nil {
+			return err
+		}
+
+		full, err := tx.PurchaseOrders.FullyReceived(order.ID)
+		if err != nil {
+			return err
+		}
+
+		status = repository.PO_PARTIALLY_RECEIVED
+		if full {
+			status = repository.PO_RECEIVED
+		}
+
+		return tx.PurchaseOrders.UpdatesFull(&repository.PurchaseOrderModel{ID: order.ID}, &map[string]interface{}{"status": status})
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errPurchaseOrderStatus):
+			NewResponse(c, http.StatusBadRequest, errIncorrectInputData("only sent or partially received purchase order can be received"))
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			NewResponse(c, http.StatusBadRequest, errRecordNotFound(err.Error()))
+		default:
+			NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		}
+		return
+	}
+
+	NewResponse(c, http.StatusOK, PurchaseOrderReceiveOutput{Status: status})
+}
+
+//findOrder - находит заказ поставщику из параметра `id` в точке сотрудника.
+//Если заказ не найден, то отвечает ошибкой и возвращает false
+func (s *PurchaseOrdersService) findOrder(c *gin.Context) (*repository.PurchaseOrderModel, bool) {
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return nil, false
+	}
+
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	where := &repository.PurchaseOrderModel{
+		ID:       uint(orderID),
+		OutletID: claims.OutletID,
+		OrgID:    claims.OrganizationID,
+	}
+
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		where.OutletID = stdQuery.OutletID
+	}
+
+	order, err := s.repo.PurchaseOrders.FindFirst(where)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NewResponse(c, http.StatusBadRequest, errRecordNotFound("undefined purchase order with this id"))
+			return nil, false
+		}
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return nil, false
+	}
+	return order, true
+}
+
+//setStatus - меняет статус заказа из параметра `id`, если его текущий статус один из from
+func (s *PurchaseOrdersService) setStatus(c *gin.Context, status int, from ...int) {
+	order, ok := s.findOrder(c)
+	if !ok {
+		return
+	}
+
+	ok, err := s.repo.PurchaseOrders.SetStatus(order.ID, status, from...)
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	if !ok {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(errPurchaseOrderStatus.Error()))
+		return
+	}
+
+	NewResponse(c, http.StatusOK, nil)
+}
+
+//checkInput - проверяет, что поставщик есть в организации, а ингредиенты позиций - в точке заказа
+func (s *PurchaseOrdersService) checkInput(order *repository.PurchaseOrderModel, lines []PurchaseOrderLineInput) *serviceError {
+	if !s.repo.Suppliers.Exists(&repository.SupplierModel{ID: order.SupplierID, OrgID: order.OrgID}) {
+		return errRecordNotFound("undefined supplier with this id")
+	}
+
+	for _, line := range lines {
+		if !s.repo.Ingredients.Exists(&repository.IngredientModel{ID: line.IngredientID, OutletID: order.OutletID, OrgID: order.OrgID}) {
+			return errRecordNotFound(fmt.Sprintf("undefined ingredent with id `%d`", line.IngredientID))
+		}
+	}
+	return nil
+}
+
+func purchaseOrderTotal(lines []PurchaseOrderLineInput) (total float64) {
+	for _, line := range lines {
+		total += line.Count * line.Price
+	}
+	return
+}
+
+func createPurchaseOrderLines(tx *repository.Repository, orderID uint, lines []PurchaseOrderLineInput) error {
+	for _, line := range lines {
+		if err := tx.PurchaseOrders.CreateLine(&repository.PurchaseOrderLineModel{
+			Count:           line.Count,
+			Price:           line.Price,
+			PurchaseOrderID: orderID,
+			IngredientID:    line.IngredientID,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,326 @@
+package myservice
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iivkis/pos.7-era.backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+//кол-во продуктов в топе продаж отчета
+const sessionReportTopProducts = 10
+
+type SessionReportProductOutputModel struct {
+	ProductID   uint    `json:"product_id"`
+	ProductName string  `json:"product_name"`
+	Count       int     `json:"count"`
+	Total       float64 `json:"total"`
+}
+
+type SessionReportOutputModel struct {
+	ID        uint `json:"id"`
+	SessionID uint `json:"session_id"`
+
+	CashOpen         float64 `json:"cash_open"`
+	CashSales        float64 `json:"cash_sales"`
+	BankSales        float64 `json:"bank_sales"`
+	UnallocatedSales float64 `json:"unallocated_sales"` // смешанные заказы без записей об оплате (разбивка неизвестна, в `cash_expected` не входят)
+	CashDeposits     float64 `json:"cash_deposits"`
+	CashWithdrawals  float64 `json:"cash_withdrawals"`
+	CashExpected     float64 `json:"cash_expected"`
+	CashCounted      float64 `json:"cash_counted"`
+	CashDiscrepancy  float64 `json:"cash_discrepancy"`
+
+	TotalCash  float64 `json:"total_cash"`
+	TotalBank  float64 `json:"total_bank"`
+	TotalMixed float64 `json:"total_mixed"`
+
+	NumberOfReceipts int     `json:"number_of_receipts"`
+	DeletedReceipts  int     `json:"deleted_receipts"`
+	DeletedTotal     float64 `json:"deleted_total"`
+
+	TopProducts []SessionReportProductOutputModel `json:"top_products"`
+
+	DateOpen  int64 `json:"date_open"`  //unixmilli
+	DateClose int64 `json:"date_close"` //unixmilli
+
+	EmployeeID uint `json:"employee_id"`
+	OutletID   uint `json:"outlet_id"`
+}
+
+func newSessionReportOutputModel(report *repository.SessionReportModel) *SessionReportOutputModel {
+	output := &SessionReportOutputModel{
+		ID:        report.ID,
+		SessionID: report.SessionID,
+
+		CashOpen:         report.CashOpen,
+		CashSales:        report.CashSales,
+		BankSales:        report.BankSales,
+		UnallocatedSales: report.UnallocatedSales,
+		CashDeposits:     report.CashDeposits,
+		CashWithdrawals:  report.CashWithdrawals,
+		CashExpected:     report.CashExpected,
+		CashCounted:      report.CashCounted,
+		CashDiscrepancy:  report.CashDiscrepancy,
+
+		TotalCash:  report.TotalCash,
+		TotalBank:  report.TotalBank,
+		TotalMixed: report.TotalMixed,
+
+		NumberOfReceipts: report.NumberOfReceipts,
+		DeletedReceipts:  report.DeletedReceipts,
+		DeletedTotal:     report.DeletedTotal,
+
+		TopProducts: []SessionReportProductOutputModel{},
+
+		DateOpen:  report.DateOpen,
+		DateClose: report.DateClose,
+
+		EmployeeID: report.EmployeeID,
+		OutletID:   report.OutletID,
+	}
+
+	if report.TopProducts != "" {
+		json.Unmarshal([]byte(report.TopProducts), &output.TopProducts)
+	}
+	return output
+}
+
+//buildSessionReport - считает отчет по сессии на текущий момент.
+//cashCounted - посчитанная сумма в кассе (для расхождения с ожидаемой суммой)
+func buildSessionReport(repo *repository.Repository, sess *repository.SessionModel, cashCounted float64) (*repository.SessionReportModel, error) {
+	report := &repository.SessionReportModel{
+		CashOpen:    sess.CashSessionOpen,
+		CashCounted: cashCounted,
+		DateOpen:    sess.DateOpen,
+		DateClose:   sess.DateClose,
+		SessionID:   sess.ID,
+		EmployeeID:  sess.EmployeeID,
+		OutletID:    sess.OutletID,
+		OrgID:       sess.OrgID,
+	}
+
+	var err error
+
+	//выручка по оплатам. Смешанные заказы без записей об оплате не делятся на наличные и безналичные
+	//и не входят в ожидаемую сумму в кассе
+	if report.CashSales, report.BankSales, report.UnallocatedSales, err = repo.OrderPayments.SumForSession(sess.ID); err != nil {
+		return nil, err
+	}
+
+	//внесения и снятия
+	if report.CashDeposits, report.CashWithdrawals, err = repo.CashChanges.SumForSession(sess.ID); err != nil {
+		return nil, err
+	}
+
+	//суммы по типам оплаты
+	totals, err := repo.OrdersInfo.SumByPayType(sess.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range totals {
+		switch item.PayType {
+		case 0:
+			report.TotalCash += item.Total
+		case 1:
+			report.TotalBank += item.Total
+		default:
+			report.TotalMixed += item.Total
+		}
+		report.NumberOfReceipts += item.Count
+	}
+
+	//удаленные (возвращенные) чеки
+	if report.DeletedReceipts, report.DeletedTotal, err = repo.OrdersInfo.SumDeleted(sess.ID); err != nil {
+		return nil, err
+	}
+
+	//топ продуктов
+	products, err := repo.OrdersList.TopProducts(sess.ID, sessionReportTopProducts)
+	if err != nil {
+		return nil, err
+	}
+
+	topProducts := make([]SessionReportProductOutputModel, len(products))
+	for i, item := range products {
+		topProducts[i] = SessionReportProductOutputModel{
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			Count:       item.Count,
+			Total:       item.Total,
+		}
+	}
+
+	b, err := json.Marshal(topProducts)
+	if err != nil {
+		return nil, err
+	}
+	report.TopProducts = string(b)
+
+	report.CashExpected = report.CashOpen + report.CashSales + report.CashDeposits - report.CashWithdrawals
+	report.CashDiscrepancy = report.CashCounted - report.CashExpected
+
+	return report, nil
+}
+
+//@Summary Z-отчет по сессии
+//@Description Отчет формируется при закрытии сессии и не изменяется
+//@Accept json
+//@Produce json
+//@Success 200 {object} SessionReportOutputModel "Z-отчет сессии"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /sessions/:id/report [get]
+func (s *SessionsService) GetReport(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	where := &repository.SessionReportModel{
+		SessionID: uint(sessionID),
+		OutletID:  claims.OutletID,
+		OrgID:     claims.OrganizationID,
+	}
+
+	if claims.HasRole(repository.R_OWNER) {
+		if stdQuery.OrgID != 0 && s.repo.Invitation.Exists(&repository.InvitationModel{OrgID: claims.OrganizationID, AffiliateOrgID: stdQuery.OrgID}) {
+			where.OrgID = stdQuery.OrgID
+		}
+	}
+
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		where.OutletID = stdQuery.OutletID
+	}
+
+	report, err := s.repo.SessionReports.FindFirst(where)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NewResponse(c, http.StatusBadRequest, errRecordNotFound("undefined report for session with this `id`"))
+			return
+		}
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	NewResponse(c, http.StatusOK, newSessionReportOutputModel(report))
+}
+
+type SessionXReportInput struct {
+	EmployeeID uint `form:"employee_id"` //сессия сотрудника (owner, director, admin), по умолчанию - последняя открытая сессия точки
+}
+
+type SessionXReportOutputModel struct {
+	SessionID uint `json:"session_id"`
+
+	CashOpen         float64 `json:"cash_open"`
+	CashSales        float64 `json:"cash_sales"`
+	BankSales        float64 `json:"bank_sales"`
+	UnallocatedSales float64 `json:"unallocated_sales"` // смешанные заказы без записей об оплате (разбивка неизвестна, в `cash_expected` не входят)
+	CashDeposits     float64 `json:"cash_deposits"`
+	CashWithdrawals  float64 `json:"cash_withdrawals"`
+	CashExpected     float64 `json:"cash_expected"`
+
+	Total            float64 `json:"total"`
+	NumberOfReceipts int     `json:"number_of_receipts"`
+	AverageCheck     float64 `json:"average_check"`
+
+	DateOpen int64 `json:"date_open"` //unixmilli
+
+	EmployeeID uint `json:"employee_id"`
+	OutletID   uint `json:"outlet_id"`
+}
+
+//@Summary X-отчет по открытой сессии
+//@Description Промежуточный отчет по текущей открытой сессии, ничего не изменяет.
+//@Description Кассир получает отчет по своей сессии. Owner, director и admin - по последней открытой сессии точки
+//@Description или по сессии сотрудника `employee_id`
+//@Param type query SessionXReportInput false "принимаемые поля"
+//@Accept json
+//@Produce json
+//@Success 200 {object} SessionXReportOutputModel "X-отчет сессии"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /sessions.XReport [get]
+func (s *SessionsService) GetXReport(c *gin.Context) {
+	var query SessionXReportInput
+	if err := c.ShouldBindQuery(&query); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	outletID := claims.OutletID
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		if stdQuery.OutletID != 0 && s.repo.Outlets.ExistsInOrg(stdQuery.OutletID, claims.OrganizationID) {
+			outletID = stdQuery.OutletID
+		}
+	}
+
+	var (
+		sess repository.SessionModel
+		err  error
+	)
+
+	switch {
+	case claims.HasRole(repository.R_CASHIER):
+		sess, err = s.repo.Sessions.GetLastOpenByEmployeeID(claims.EmployeeID)
+	case query.EmployeeID != 0:
+		sess, err = s.repo.Sessions.GetLastOpenByEmployeeID(query.EmployeeID)
+		if err == nil && sess.OutletID != outletID {
+			err = gorm.ErrRecordNotFound
+		}
+	default:
+		sess, err = s.repo.Sessions.GetLastOpenForOutlet(outletID)
+	}
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NewResponse(c, http.StatusBadRequest, errRecordNotFound("undefined open session"))
+			return
+		}
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	report, err := buildSessionReport(s.repo, &sess, 0)
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	output := SessionXReportOutputModel{
+		SessionID: sess.ID,
+
+		CashOpen:         report.CashOpen,
+		CashSales:        report.CashSales,
+		BankSales:        report.BankSales,
+		UnallocatedSales: report.UnallocatedSales,
+		CashDeposits:     report.CashDeposits,
+		CashWithdrawals:  report.CashWithdrawals,
+		CashExpected:     report.CashExpected,
+
+		Total:            report.TotalCash + report.TotalBank + report.TotalMixed,
+		NumberOfReceipts: report.NumberOfReceipts,
+
+		DateOpen: sess.DateOpen,
+
+		EmployeeID: sess.EmployeeID,
+		OutletID:   sess.OutletID,
+	}
+
+	if output.NumberOfReceipts != 0 {
+		output.AverageCheck = output.Total / float64(output.NumberOfReceipts)
+	}
+
+	NewResponse(c, http.StatusOK, output)
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/iivkis/pos.7-era.backend/internal/repository"
+	"github.com/iivkis/pos.7-era.backend/pkg/authjwt"
 	"gorm.io/gorm"
 )
 
@@ -43,18 +44,21 @@ type SessionsOpenOrCloseInput struct {
 	Date int64   `json:"date" binding:"min=1"`
 	Cash float64 `json:"cash"`
 
-	CashEarned float64 `json:"cash_earned"`
-	BankEarned float64 `json:"bank_earned"`
+	CashEarned float64 `json:"cash_earned"` // не используется, считается по оплатам заказов
+	BankEarned float64 `json:"bank_earned"` // не используется, считается по оплатам заказов
 }
 
 type SessionOpenOrCloseOutput struct {
-	ID         uint `json:"id"`
-	EmployeeID uint `json:"employee_id"`
+	ID         uint                      `json:"id"`
+	EmployeeID uint                      `json:"employee_id"`
+	Report     *SessionReportOutputModel `json:"report,omitempty"` //Z-отчет (только при закрытии)
 }
 
 //@Summary Открыть или закрыть сессию в точке
 //@Description Открывает сессию с id указанным в jwt токен.
 //@Description - Поле `action` принимает два параметра `open` (для открытия сессии) и `close` (для закрытия сессии)
+//@Description - При закрытии `cash_earned` и `bank_earned` считаются на сервере по оплатам заказов сессии
+//@Description - При закрытии формируется Z-отчет (поле `report`), `cash` - посчитанная сумма в кассе
 //@param type body SessionsOpenOrCloseInput false "Принимаемый объект"
 //@Success 201 {object} SessionOpenOrCloseOutput "возвращает id созданной записи"
 //@Router /sessions [post]
@@ -67,74 +71,98 @@ func (s *SessionsService) OpenOrClose(c *gin.Context) {
 
 	claims := mustGetEmployeeClaims(c)
 
+	var (
+		output *SessionOpenOrCloseOutput
+		code   int
+		serr   *serviceError
+	)
+
 	switch input.Action {
 	case "open":
-		{
-			sess := repository.SessionModel{
-				CashSessionOpen: input.Cash,
-				DateOpen:        input.Date,
-				EmployeeID:      claims.EmployeeID,
-				OutletID:        claims.OutletID,
-				OrgID:           claims.OrganizationID,
-			}
-			if err := s.repo.Sessions.Open(&sess); err != nil {
-				if errors.Is(err, repository.ErrSessionAlreadyOpen) {
-					NewResponse(c, http.StatusBadRequest, errRecordAlreadyExists(err.Error()))
-					return
-				}
-				NewResponse(c, http.StatusBadRequest, errUnknown(err.Error()))
-				return
-			}
-
-			if err := s.repo.Employees.SetOnline(claims.EmployeeID); err != nil {
-				NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
-				return
-			}
-
-			NewResponse(c, http.StatusOK, SessionOpenOrCloseOutput{ID: sess.ID, EmployeeID: sess.EmployeeID})
-		}
-
+		output, code, serr = s.open(s.repo, claims, &input)
 	case "close":
-		{
-			lastOpenEmployeeSession, err := s.repo.Sessions.GetLastOpenByEmployeeID(claims.EmployeeID)
-			if err != nil {
-				if errors.Is(err, gorm.ErrRecordNotFound) {
-					NewResponse(c, http.StatusBadRequest, errRecordNotFound("undefined open session"))
-					return
-				}
-				NewResponse(c, http.StatusBadRequest, errUnknown(err.Error()))
-				return
-			}
-
-			NumberOfReceipts, err := s.repo.OrdersInfo.Count(&repository.OrderInfoModel{SessionID: lastOpenEmployeeSession.ID})
-			if err != nil {
-				NewResponse(c, http.StatusBadRequest, errUnknown(err.Error()))
-				return
-			}
-
-			sess := repository.SessionModel{
-				DateClose:        input.Date,
-				CashSessionClose: input.Cash,
-				BankEarned:       input.BankEarned,
-				CashEarned:       input.CashEarned,
-				NumberOfReceipts: int(NumberOfReceipts),
-			}
-
-			if err := s.repo.Sessions.Close(claims.EmployeeID, &sess); err != nil {
-				NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
-				return
-			}
-
-			if err := s.repo.Employees.SetOffline(claims.EmployeeID); err != nil {
-				NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
-				return
-			}
-			NewResponse(c, http.StatusOK, SessionOpenOrCloseOutput{ID: sess.ID, EmployeeID: sess.EmployeeID})
-		}
+		output, code, serr = s.close(s.repo, claims, &input)
 	default:
 		NewResponse(c, http.StatusBadRequest, errIncorrectInputData("action can be only `open` or `close` value"))
 		return
 	}
+
+	if serr != nil {
+		NewResponse(c, code, serr)
+		return
+	}
+	NewResponse(c, http.StatusOK, output)
+}
+
+//open - открывает новую сессию сотрудника (repo - репозиторий или транзакция)
+func (s *SessionsService) open(repo *repository.Repository, claims *authjwt.EmployeeClaims, input *SessionsOpenOrCloseInput) (output *SessionOpenOrCloseOutput, code int, serr *serviceError) {
+	sess := repository.SessionModel{
+		CashSessionOpen: input.Cash,
+		DateOpen:        input.Date,
+		EmployeeID:      claims.EmployeeID,
+		OutletID:        claims.OutletID,
+		OrgID:           claims.OrganizationID,
+	}
+	if err := repo.Sessions.Open(&sess); err != nil {
+		if errors.Is(err, repository.ErrSessionAlreadyOpen) {
+			return nil, http.StatusBadRequest, errRecordAlreadyExists(err.Error())
+		}
+		return nil, http.StatusBadRequest, errUnknown(err.Error())
+	}
+
+	if err := repo.Employees.SetOnline(claims.EmployeeID); err != nil {
+		return nil, http.StatusInternalServerError, errUnknown(err.Error())
+	}
+
+	return &SessionOpenOrCloseOutput{ID: sess.ID, EmployeeID: sess.EmployeeID}, http.StatusOK, nil
+}
+
+//close - закрывает текущую открытую сессию сотрудника (repo - репозиторий или транзакция)
+func (s *SessionsService) close(repo *repository.Repository, claims *authjwt.EmployeeClaims, input *SessionsOpenOrCloseInput) (output *SessionOpenOrCloseOutput, code int, serr *serviceError) {
+	lastOpenEmployeeSession, err := repo.Sessions.GetLastOpenByEmployeeID(claims.EmployeeID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, http.StatusBadRequest, errRecordNotFound("undefined open session")
+		}
+		return nil, http.StatusBadRequest, errUnknown(err.Error())
+	}
+
+	lastOpenEmployeeSession.DateClose = input.Date
+
+	var (
+		report *repository.SessionReportModel
+		sess   repository.SessionModel
+	)
+
+	//Z-отчет считается и сохраняется в одной транзакции с закрытием сессии
+	err = repo.Transaction(func(tx *repository.Repository) error {
+		var err error
+		if report, err = buildSessionReport(tx, &lastOpenEmployeeSession, input.Cash); err != nil {
+			return err
+		}
+
+		sess = repository.SessionModel{
+			DateClose:        input.Date,
+			CashSessionClose: input.Cash,
+			BankEarned:       report.BankSales,
+			CashEarned:       report.CashSales,
+			NumberOfReceipts: report.NumberOfReceipts,
+		}
+
+		if err := tx.Sessions.Close(claims.EmployeeID, &sess); err != nil {
+			return err
+		}
+		return tx.SessionReports.Create(report)
+	})
+	if err != nil {
+		return nil, http.StatusInternalServerError, errUnknown(err.Error())
+	}
+
+	if err := repo.Employees.SetOffline(claims.EmployeeID); err != nil {
+		return nil, http.StatusInternalServerError, errUnknown(err.Error())
+	}
+
+	return &SessionOpenOrCloseOutput{ID: sess.ID, EmployeeID: sess.EmployeeID, Report: newSessionReportOutputModel(report)}, http.StatusOK, nil
 }
 
 type SessionsGetAllInput struct {
@@ -146,6 +174,9 @@ type SessionsGetAllOutput []SessionOutputModel
 
 //@Summary Список всех сессий точки
 //@Description Метод позволяет получить список всех сессий точки
+//@Description Поддерживает `offset`, `limit` и `sort` (id, date_open, date_close) из стандартного query.
+//@Description Общее кол-во записей возвращается в заголовке `X-Total-Count`
+//@Description Без `limit` возвращается 100 записей, если указаны `offset` или `sort`, иначе - до 1000 записей
 //@Param type query SessionsGetAllInput false "принимаемые поля"
 //@Success 200 {object} SessionsGetAllOutput "Возвращает массив сессий точки"
 //@Accept json
@@ -176,11 +207,12 @@ func (s *SessionsService) GetAll(c *gin.Context) {
 		where.OutletID = stdQuery.OutletID
 	}
 
-	sessions, err := s.repo.Sessions.FindWithPeriod(query.Start, query.End, where)
+	sessions, total, err := s.repo.Sessions.FindPage(where, stdQuery.listOptions(query.Start, query.End))
 	if err != nil {
-		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		listError(c, err)
 		return
 	}
+	setTotalCount(c, total)
 
 	var output SessionsGetAllOutput = make(SessionsGetAllOutput, len(*sessions))
 	for i, sess := range *sessions {
@@ -0,0 +1,88 @@
+package myservice
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iivkis/pos.7-era.backend/internal/repository"
+)
+
+type SignInAttemptOutputModel struct {
+	ID         uint   `json:"id"`
+	Kind       int    `json:"kind"`   // 1 - вход организации, 2 - вход сотрудника
+	Login      string `json:"login"`  // email или id сотрудника
+	Reason     string `json:"reason"` // invalid credentials, locked
+	IP         string `json:"ip"`
+	UserAgent  string `json:"user_agent"`
+	Date       int64  `json:"date"` //unixmilli
+	EmployeeID uint   `json:"employee_id"`
+}
+
+type SignInAttemptsService struct {
+	repo *repository.Repository
+}
+
+func newSignInAttemptsService(repo *repository.Repository) *SignInAttemptsService {
+	return &SignInAttemptsService{
+		repo: repo,
+	}
+}
+
+type SignInAttemptsGetAllQuery struct {
+	Kind       int    `form:"kind" binding:"min=0,max=2"`
+	EmployeeID uint   `form:"employee_id"`
+	Start      uint64 `form:"start"` //in unixmilli
+	End        uint64 `form:"end"`   //in unixmilli
+}
+
+type SignInAttemptsGetAllOutput []SignInAttemptOutputModel
+
+//@Summary Журнал неудачных попыток входа в организацию
+//@Description Неверный пароль организации, неверный пин-код сотрудника и попытки во время блокировки.
+//@Description Поддерживает `offset`, `limit` и `sort` (id, date) из стандартного query.
+//@Description Общее кол-во записей возвращается в заголовке `X-Total-Count`
+//@Description Без `limit` возвращается 100 записей, если указаны `offset` или `sort`, иначе - до 1000 записей
+//@param type query SignInAttemptsGetAllQuery false "Принимаемый объект"
+//@Accept json
+//@Produce json
+//@Success 200 {object} SignInAttemptsGetAllOutput "возвращаемый объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /auth/signInAttempts [get]
+func (s *SignInAttemptsService) GetAll(c *gin.Context) {
+	var query SignInAttemptsGetAllQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	where := &repository.SignInAttemptModel{
+		Kind:       query.Kind,
+		EmployeeID: query.EmployeeID,
+		OrgID:      claims.OrganizationID,
+	}
+
+	attempts, total, err := s.repo.SignInAttempts.FindPage(where, stdQuery.listOptions(query.Start, query.End))
+	if err != nil {
+		listError(c, err)
+		return
+	}
+	setTotalCount(c, total)
+
+	output := make(SignInAttemptsGetAllOutput, len(*attempts))
+	for i, item := range *attempts {
+		output[i] = SignInAttemptOutputModel{
+			ID:         item.ID,
+			Kind:       item.Kind,
+			Login:      item.Login,
+			Reason:     item.Reason,
+			IP:         item.IP,
+			UserAgent:  item.UserAgent,
+			Date:       item.Date,
+			EmployeeID: item.EmployeeID,
+		}
+	}
+	NewResponse(c, http.StatusOK, output)
+}
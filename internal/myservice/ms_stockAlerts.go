@@ -0,0 +1,98 @@
+package myservice
+
+import (
+	"errors"
+	"time"
+
+	"github.com/iivkis/pos.7-era.backend/internal/config"
+	"github.com/iivkis/pos.7-era.backend/internal/repository"
+	"github.com/iivkis/pos.7-era.backend/pkg/mailagent"
+	"gorm.io/gorm"
+)
+
+const (
+	stockAlertsSendInterval = time.Minute // как часто отправляются уведомления о низких остатках
+	stockAlertsBatchSize    = 100         // сколько уведомлений отправляется за раз
+)
+
+//StockAlertsService - отправляет уведомления о низких остатках на почту организации
+type StockAlertsService struct {
+	repo      *repository.Repository
+	mailagent *mailagent.MailAgent
+}
+
+func newStockAlertsService(repo *repository.Repository, mailagent *mailagent.MailAgent) *StockAlertsService {
+	s := &StockAlertsService{
+		repo:      repo,
+		mailagent: mailagent,
+	}
+
+	if *config.Flags.Main {
+		go func() {
+			for {
+				if err := s.sendPending(); err != nil {
+					errUnknown(err.Error())
+				}
+				time.Sleep(stockAlertsSendInterval)
+			}
+		}()
+	}
+
+	return s
+}
+
+//sendPending - отправляет неотправленные уведомления, одно письмо на организацию.
+//Если письмо не отправилось, то следующая попытка для уведомлений организации откладывается,
+//чтобы они не занимали каждую выборку и не задерживали уведомления других организаций
+func (s *StockAlertsService) sendPending() error {
+	alerts, err := s.repo.StockAlerts.FindNotSent(stockAlertsBatchSize)
+	if err != nil {
+		return err
+	}
+
+	var orgs []uint
+	byOrg := make(map[uint][]repository.StockAlertModel)
+	for _, alert := range *alerts {
+		if _, ok := byOrg[alert.OrgID]; !ok {
+			orgs = append(orgs, alert.OrgID)
+		}
+		byOrg[alert.OrgID] = append(byOrg[alert.OrgID], alert)
+	}
+
+	for _, orgID := range orgs {
+		ids := make([]uint, len(byOrg[orgID]))
+		rows := make([]mailagent.Value, len(byOrg[orgID]))
+		for i, alert := range byOrg[orgID] {
+			ids[i] = alert.ID
+			rows[i] = mailagent.Value{
+				"outlet":     alert.OutletModel.Name,
+				"ingredient": alert.IngredientModel.Name,
+				"count":      alert.Count,
+				"min_count":  alert.MinCount,
+				"negative":   alert.Negative,
+			}
+		}
+
+		org, err := s.repo.Organizations.FindFirts(&repository.OrganizationModel{ID: orgID})
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				errUnknown(err.Error())
+				if err := s.repo.StockAlerts.SetFailed(ids); err != nil {
+					return err
+				}
+				continue
+			}
+		} else if err := s.mailagent.SendTemplate(org.Email, "low_stock.html", mailagent.Value{"alerts": rows}); err != nil {
+			errUnknown(err.Error())
+			if err := s.repo.StockAlerts.SetFailed(ids); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := s.repo.StockAlerts.SetSent(ids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
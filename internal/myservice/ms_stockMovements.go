@@ -0,0 +1,170 @@
+package myservice
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iivkis/pos.7-era.backend/internal/repository"
+)
+
+type StockMovementOutputModel struct {
+	ID           uint    `json:"id"`
+	Reason       int     `json:"reason"`    // 1 - продажа, 2 - возврат, 3 - поступление, 4 - списание, 5 - инвентаризация, 6 - ручное изменение, 7 - начальный остаток, 8 - смена единицы
+	SourceID     uint    `json:"source_id"` // id документа-основания (чек, поступление, инвентаризация, ингредиент)
+	Delta        float64 `json:"delta"`
+	Balance      float64 `json:"balance"` // остаток после изменения
+	Date         int64   `json:"date"`    //unixmilli
+	IngredientID uint    `json:"ingredient_id"`
+	EmployeeID   uint    `json:"employee_id"`
+	OutletID     uint    `json:"outlet_id"`
+}
+
+type StockMovementsService struct {
+	repo *repository.Repository
+}
+
+func newStockMovementsService(repo *repository.Repository) *StockMovementsService {
+	return &StockMovementsService{
+		repo: repo,
+	}
+}
+
+type StockMovementsGetAllQuery struct {
+	IngredientID uint   `form:"ingredient_id"`
+	Reason       int    `form:"reason" binding:"min=0,max=8"`
+	Start        uint64 `form:"start"` //in unixmilli
+	End          uint64 `form:"end"`   //in unixmilli
+}
+
+type StockMovementsGetAllOutput []StockMovementOutputModel
+
+//@Summary Журнал движения остатков ингредиентов
+//@Description Поддерживает `offset`, `limit` и `sort` (id, date, delta) из стандартного query.
+//@Description Общее кол-во записей возвращается в заголовке `X-Total-Count`
+//@Description Без `limit` возвращается 100 записей, если указаны `offset` или `sort`, иначе - до 1000 записей
+//@param type query StockMovementsGetAllQuery false "Принимаемый объект"
+//@Accept json
+//@Produce json
+//@Success 200 {object} StockMovementsGetAllOutput "возвращаемый объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /ingredients.Movements [get]
+func (s *StockMovementsService) GetAll(c *gin.Context) {
+	var query StockMovementsGetAllQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	where := &repository.StockMovementModel{
+		Reason:       query.Reason,
+		IngredientID: query.IngredientID,
+		OrgID:        claims.OrganizationID,
+		OutletID:     claims.OutletID,
+	}
+
+	if claims.HasRole(repository.R_OWNER) {
+		if stdQuery.OrgID != 0 && s.repo.Invitation.Exists(&repository.InvitationModel{OrgID: claims.OrganizationID, AffiliateOrgID: stdQuery.OrgID}) {
+			where.OrgID = stdQuery.OrgID
+		}
+	}
+
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		where.OutletID = stdQuery.OutletID
+	}
+
+	movements, total, err := s.repo.StockMovements.FindPage(where, stdQuery.listOptions(query.Start, query.End))
+	if err != nil {
+		listError(c, err)
+		return
+	}
+	setTotalCount(c, total)
+
+	output := make(StockMovementsGetAllOutput, len(*movements))
+	for i, item := range *movements {
+		output[i] = StockMovementOutputModel{
+			ID:           item.ID,
+			Reason:       item.Reason,
+			SourceID:     item.SourceID,
+			Delta:        item.Delta,
+			Balance:      item.Balance,
+			Date:         item.Date,
+			IngredientID: item.IngredientID,
+			EmployeeID:   item.EmployeeID,
+			OutletID:     item.OutletID,
+		}
+	}
+	NewResponse(c, http.StatusOK, output)
+}
+
+type StockMovementsBalanceQuery struct {
+	IngredientID uint  `form:"ingredient_id" binding:"min=1"`
+	Date         int64 `form:"date" binding:"min=0"` //in unixmilli, 0 - текущий момент
+}
+
+type StockMovementsBalanceOutput struct {
+	IngredientID uint    `json:"ingredient_id"`
+	Date         int64   `json:"date"`      //unixmilli
+	Balance      float64 `json:"balance"`   // остаток на момент date
+	Movements    int64   `json:"movements"` // кол-во учтенных записей журнала
+}
+
+//@Summary Остаток ингредиента на момент времени, восстановленный по журналу движения
+//@Description Остаток до смены единицы хранения возвращается в прежней единице
+//@param type query StockMovementsBalanceQuery false "Принимаемый объект"
+//@Accept json
+//@Produce json
+//@Success 200 {object} StockMovementsBalanceOutput "возвращаемый объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /ingredients.Balance [get]
+func (s *StockMovementsService) Balance(c *gin.Context) {
+	var query StockMovementsBalanceQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	claims, stdQuery := mustGetEmployeeClaims(c), mustGetStdQuery(c)
+
+	where := &repository.IngredientModel{
+		ID:       query.IngredientID,
+		OrgID:    claims.OrganizationID,
+		OutletID: claims.OutletID,
+	}
+
+	if claims.HasRole(repository.R_OWNER) {
+		if stdQuery.OrgID != 0 && s.repo.Invitation.Exists(&repository.InvitationModel{OrgID: claims.OrganizationID, AffiliateOrgID: stdQuery.OrgID}) {
+			where.OrgID = stdQuery.OrgID
+		}
+	}
+
+	if claims.HasRole(repository.R_OWNER, repository.R_DIRECTOR) {
+		where.OutletID = stdQuery.OutletID
+	}
+
+	if !s.repo.Ingredients.Exists(where) {
+		NewResponse(c, http.StatusBadRequest, errRecordNotFound("undefined ingredient with this id"))
+		return
+	}
+
+	if query.Date == 0 {
+		query.Date = time.Now().UTC().UnixMilli()
+	}
+
+	balance, count, err := s.repo.StockMovements.BalanceAt(query.IngredientID, query.Date)
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	NewResponse(c, http.StatusOK, StockMovementsBalanceOutput{
+		IngredientID: query.IngredientID,
+		Date:         query.Date,
+		Balance:      balance,
+		Movements:    count,
+	})
+}
@@ -0,0 +1,179 @@
+package myservice
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iivkis/pos.7-era.backend/internal/repository"
+)
+
+type SupplierOutputModel struct {
+	ID      uint   `json:"id"`
+	Name    string `json:"name"`
+	Phone   string `json:"phone"`
+	Email   string `json:"email"`
+	Comment string `json:"comment"`
+}
+
+type SuppliersService struct {
+	repo *repository.Repository
+}
+
+func newSuppliersService(repo *repository.Repository) *SuppliersService {
+	return &SuppliersService{
+		repo: repo,
+	}
+}
+
+type SupplierCreateInput struct {
+	Name    string `json:"name" binding:"required,max=150"`
+	Phone   string `json:"phone" binding:"max=50"`
+	Email   string `json:"email" binding:"max=150"`
+	Comment string `json:"comment" binding:"max=500"`
+}
+
+//@Summary Добавить поставщика в организацию
+//@param type body SupplierCreateInput false "Принимаемый объект"
+//@Accept json
+//@Produce json
+//@Success 201 {object} DefaultOutputModel "возвращает id созданной записи"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /suppliers [post]
+func (s *SuppliersService) Create(c *gin.Context) {
+	var input SupplierCreateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	claims := mustGetEmployeeClaims(c)
+
+	model := repository.SupplierModel{
+		Name:    input.Name,
+		Phone:   input.Phone,
+		Email:   input.Email,
+		Comment: input.Comment,
+		OrgID:   claims.OrganizationID,
+	}
+
+	if err := s.repo.Suppliers.Create(&model); err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	NewResponse(c, http.StatusCreated, DefaultOutputModel{ID: model.ID})
+}
+
+type SupplierGetAllOutput []SupplierOutputModel
+
+//@Summary Список поставщиков организации
+//@Produce json
+//@Success 200 {object} SupplierGetAllOutput "возвращает всех поставщиков"
+//@Failure 500 {object} serviceError
+//@Router /suppliers [get]
+func (s *SuppliersService) GetAll(c *gin.Context) {
+	claims := mustGetEmployeeClaims(c)
+
+	suppliers, err := s.repo.Suppliers.Find(&repository.SupplierModel{OrgID: claims.OrganizationID})
+	if err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	output := make(SupplierGetAllOutput, len(*suppliers))
+	for i, item := range *suppliers {
+		output[i] = SupplierOutputModel{
+			ID:      item.ID,
+			Name:    item.Name,
+			Phone:   item.Phone,
+			Email:   item.Email,
+			Comment: item.Comment,
+		}
+	}
+	NewResponse(c, http.StatusOK, output)
+}
+
+type SupplierUpdateInput struct {
+	Name    *string `json:"name,omitempty" binding:"omitempty,min=1,max=150"`
+	Phone   *string `json:"phone,omitempty" binding:"omitempty,max=50"`
+	Email   *string `json:"email,omitempty" binding:"omitempty,max=150"`
+	Comment *string `json:"comment,omitempty" binding:"omitempty,max=500"`
+}
+
+//@Summary Обновить поставщика
+//@param type body SupplierUpdateInput false "Обновляемые поля"
+//@Accept json
+//@Produce json
+//@Success 200 {object} object "возвращает пустой объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /suppliers/:id [put]
+func (s *SuppliersService) UpdateFields(c *gin.Context) {
+	var input SupplierUpdateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	supplierID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	claims := mustGetEmployeeClaims(c)
+
+	updatedFields := make(map[string]interface{})
+	{
+		if input.Name != nil {
+			updatedFields["name"] = *input.Name
+		}
+
+		if input.Phone != nil {
+			updatedFields["phone"] = *input.Phone
+		}
+
+		if input.Email != nil {
+			updatedFields["email"] = *input.Email
+		}
+
+		if input.Comment != nil {
+			updatedFields["comment"] = *input.Comment
+		}
+	}
+
+	if len(updatedFields) != 0 {
+		if err := s.repo.Suppliers.UpdatesFull(&repository.SupplierModel{ID: uint(supplierID), OrgID: claims.OrganizationID}, &updatedFields); err != nil {
+			NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+			return
+		}
+	}
+
+	NewResponse(c, http.StatusOK, nil)
+}
+
+//@Summary Удалить поставщика
+//@Accept json
+//@Produce json
+//@Success 200 {object} object "возвращает пустой объект"
+//@Failure 400 {object} serviceError
+//@Failure 500 {object} serviceError
+//@Router /suppliers/:id [delete]
+func (s *SuppliersService) Delete(c *gin.Context) {
+	supplierID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	claims := mustGetEmployeeClaims(c)
+
+	if err := s.repo.Suppliers.Delete(&repository.SupplierModel{ID: uint(supplierID), OrgID: claims.OrganizationID}); err != nil {
+		NewResponse(c, http.StatusInternalServerError, errUnknown(err.Error()))
+		return
+	}
+
+	NewResponse(c, http.StatusOK, nil)
+}
@@ -0,0 +1,269 @@
+package myservice
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/iivkis/pos.7-era.backend/internal/repository"
+	"github.com/iivkis/pos.7-era.backend/pkg/authjwt"
+	"gorm.io/gorm"
+)
+
+//результаты применения события
+const (
+	syncStatusApplied   = "applied"
+	syncStatusDuplicate = "duplicate"
+	syncStatusRejected  = "rejected"
+)
+
+type SyncEventResultModel struct {
+	UUID   string `json:"uuid"`
+	Status string `json:"status"`           // applied, duplicate или rejected
+	ID     uint   `json:"id,omitempty"`     // id созданной записи (сессия, orderInfo, cashChanges)
+	Reason string `json:"reason,omitempty"` // причина, если событие отклонено
+}
+
+type SyncService struct {
+	repo        *repository.Repository
+	sessions    *SessionsService
+	ordersInfo  *OrdersInfoService
+	cashChanges *CashChangesService
+}
+
+func newSyncService(repo *repository.Repository, sessions *SessionsService, ordersInfo *OrdersInfoService, cashChanges *CashChangesService) *SyncService {
+	return &SyncService{
+		repo:        repo,
+		sessions:    sessions,
+		ordersInfo:  ordersInfo,
+		cashChanges: cashChanges,
+	}
+}
+
+type SyncEventInput struct {
+	UUID string `json:"uuid" binding:"required,max=36"` // генерируется на кассе
+	Type string `json:"type" binding:"required"`        // session_open, session_close, order, cash_change
+	Date int64  `json:"date" binding:"min=1"`           // время создания события на кассе (unixmilli)
+
+	//uuid события `session_open`, если сессия была открыта в офлайне (для `order` и `cash_change`).
+	//Если указан, то `session_id` в data заменяется на id созданной сессии
+	SessionUUID string `json:"session_uuid" binding:"max=36"`
+
+	//SessionsOpenOrCloseInput для session_open/session_close (поле `action` не нужно),
+	//OrderInfoCheckoutInput для order, CashChangesCreateInput для cash_change
+	Data json.RawMessage `json:"data" binding:"required"`
+}
+
+type SyncInput struct {
+	Events []SyncEventInput `json:"events" binding:"required,min=1,max=500,dive"`
+}
+
+type SyncOutput []SyncEventResultModel
+
+//@Summary Синхронизация событий, созданных кассой в офлайне
+//@Description События применяются по порядку с той же проверкой, что и в обычных методах (sessions, orderInfo.Checkout, cashChanges).
+//@Description Для каждого события возвращается результат: `applied`, `duplicate` (событие с таким uuid уже применено) или `rejected` (с причиной).
+//@Description События должны передаваться в порядке их создания на кассе.
+//@param type body SyncInput false "Принимаемый объект"
+//@Accept json
+//@Produce json
+//@Success 200 {object} SyncOutput "результат по каждому событию (в порядке передачи)"
+//@Failure 400 {object} serviceError
+//@Router /sync [post]
+func (s *SyncService) Apply(c *gin.Context) {
+	var input SyncInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		NewResponse(c, http.StatusBadRequest, errIncorrectInputData(err.Error()))
+		return
+	}
+
+	claims := mustGetEmployeeClaims(c)
+
+	output := make(SyncOutput, len(input.Events))
+	for i := range input.Events {
+		output[i] = s.apply(claims, &input.Events[i])
+	}
+
+	NewResponse(c, http.StatusOK, output)
+}
+
+//errSyncRejected - событие отклонено, транзакция применения откатывается
+var errSyncRejected = errors.New("sync event is rejected")
+
+//apply - применяет одно событие, если событие с таким uuid еще не применялось.
+//UUID резервируется, событие применяется и id записи сохраняется в одной транзакции:
+//при любой ошибке резерв снимается и касса может передать событие повторно
+func (s *SyncService) apply(claims *authjwt.EmployeeClaims, event *SyncEventInput) SyncEventResultModel {
+	result := SyncEventResultModel{UUID: event.UUID}
+
+	reject := func(serr *serviceError) SyncEventResultModel {
+		result.Status = syncStatusRejected
+		result.Reason = serr.Error
+		return result
+	}
+
+	duplicate := func() SyncEventResultModel {
+		stored, err := s.repo.SyncEvents.FindFirts(&repository.SyncEventModel{UUID: event.UUID, OrgID: claims.OrganizationID})
+		if err != nil {
+			return reject(errUnknown(err.Error()))
+		}
+		result.Status = syncStatusDuplicate
+		result.ID = stored.EntityID
+		return result
+	}
+
+	//события, зарезервированные до того, как применение стало атомарным, могли остаться без id записи: их можно применить заново
+	if err := s.repo.SyncEvents.DeleteNotApplied(event.UUID, claims.OrganizationID); err != nil {
+		return reject(errUnknown(err.Error()))
+	}
+
+	var serr *serviceError
+	err := s.repo.Transaction(func(tx *repository.Repository) error {
+		record := &repository.SyncEventModel{
+			UUID:       event.UUID,
+			Type:       event.Type,
+			ClientDate: event.Date,
+			EmployeeID: claims.EmployeeID,
+			OutletID:   claims.OutletID,
+			OrgID:      claims.OrganizationID,
+		}
+
+		//параллельный запрос с тем же uuid ждет на уникальном индексе, пока эта транзакция не завершится
+		if err := tx.SyncEvents.Create(record); err != nil {
+			return err
+		}
+
+		if result.ID, serr = s.replay(tx, claims, event); serr != nil {
+			return errSyncRejected
+		}
+
+		return tx.SyncEvents.Updates(
+			&repository.SyncEventModel{ID: record.ID},
+			&repository.SyncEventModel{EntityID: result.ID, SyncDate: time.Now().UTC().UnixMilli()},
+		)
+	})
+	if err != nil {
+		if errors.Is(err, errSyncRejected) {
+			return reject(serr)
+		}
+		if dberr, ok := isDatabaseError(err); ok && dberr.Number == 1062 {
+			return duplicate()
+		}
+		return reject(errUnknown(err.Error()))
+	}
+
+	result.Status = syncStatusApplied
+	return result
+}
+
+//replay - проверяет данные события и применяет его через методы соответствующего сервиса в транзакции repo
+func (s *SyncService) replay(repo *repository.Repository, claims *authjwt.EmployeeClaims, event *SyncEventInput) (entityID uint, serr *serviceError) {
+	switch event.Type {
+	case repository.SYNC_SESSION_OPEN, repository.SYNC_SESSION_CLOSE:
+		var input SessionsOpenOrCloseInput
+		if err := json.Unmarshal(event.Data, &input); err != nil {
+			return 0, errIncorrectInputData(err.Error())
+		}
+
+		if input.Date == 0 {
+			input.Date = event.Date
+		}
+
+		var output *SessionOpenOrCloseOutput
+		if event.Type == repository.SYNC_SESSION_OPEN {
+			input.Action = "open"
+			if err := binding.Validator.ValidateStruct(&input); err != nil {
+				return 0, errIncorrectInputData(err.Error())
+			}
+			output, _, serr = s.sessions.open(repo, claims, &input)
+		} else {
+			input.Action = "close"
+			if err := binding.Validator.ValidateStruct(&input); err != nil {
+				return 0, errIncorrectInputData(err.Error())
+			}
+			output, _, serr = s.sessions.close(repo, claims, &input)
+		}
+
+		if serr != nil {
+			return 0, serr
+		}
+		return output.ID, nil
+
+	case repository.SYNC_ORDER:
+		var input OrderInfoCheckoutInput
+		if err := json.Unmarshal(event.Data, &input); err != nil {
+			return 0, errIncorrectInputData(err.Error())
+		}
+
+		if input.Date == 0 {
+			input.Date = event.Date
+		}
+
+		if event.SessionUUID != "" {
+			if input.SessionID, serr = s.resolveSession(repo, claims, event.SessionUUID); serr != nil {
+				return 0, serr
+			}
+		}
+
+		if err := binding.Validator.ValidateStruct(&input); err != nil {
+			return 0, errIncorrectInputData(err.Error())
+		}
+
+		output, _, serr := s.ordersInfo.checkout(repo, claims, &input)
+		if serr != nil {
+			return 0, serr
+		}
+		return output.ID, nil
+
+	case repository.SYNC_CASH_CHANGE:
+		var input CashChangesCreateInput
+		if err := json.Unmarshal(event.Data, &input); err != nil {
+			return 0, errIncorrectInputData(err.Error())
+		}
+
+		if input.Date == 0 {
+			input.Date = event.Date
+		}
+
+		if event.SessionUUID != "" {
+			if input.SessionID, serr = s.resolveSession(repo, claims, event.SessionUUID); serr != nil {
+				return 0, serr
+			}
+		}
+
+		if err := binding.Validator.ValidateStruct(&input); err != nil {
+			return 0, errIncorrectInputData(err.Error())
+		}
+
+		output, _, serr := s.cashChanges.create(repo, claims, &input)
+		if serr != nil {
+			return 0, serr
+		}
+		return output.ID, nil
+	}
+
+	return 0, errIncorrectInputData("undefined event `type`")
+}
+
+//resolveSession - возвращает id сессии, созданной событием `session_open` с переданным uuid
+func (s *SyncService) resolveSession(repo *repository.Repository, claims *authjwt.EmployeeClaims, sessionUUID string) (sessionID uint, serr *serviceError) {
+	event, err := repo.SyncEvents.FindFirts(&repository.SyncEventModel{
+		UUID:  sessionUUID,
+		Type:  repository.SYNC_SESSION_OPEN,
+		OrgID: claims.OrganizationID,
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, errRecordNotFound("undefined session with this `session_uuid`")
+		}
+		return 0, errUnknown(err.Error())
+	}
+
+	if event.EntityID == 0 {
+		return 0, errRecordNotFound("session with this `session_uuid` is not applied yet")
+	}
+	return event.EntityID, nil
+}
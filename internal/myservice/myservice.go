@@ -16,6 +16,7 @@ type MyService struct {
 	Mware                    *MiddlewareService
 	Authorization            *AuthorizationService
 	Employees                *EmployeesService
+	Organizations            *OrganizationsService
 	Outlets                  *OutletsService
 	Sessions                 *SessionsService
 	Categories               *CategoriesService
@@ -23,6 +24,7 @@ type MyService struct {
 	Ingredients              *IngredientsService
 	OrdersList               *OrdersListService
 	OrdersInfo               *OrdersInfoService
+	OrderPayments            *OrderPaymentsService
 	ProductsWithIngredients  *ProductsWithIngredientsService
 	CashChages               *CashChangesService
 	InventoryHistory         *InventoryHistoryService
@@ -30,13 +32,24 @@ type MyService struct {
 	IngredientsAddingHistory *IngredientsAddingHistoryService
 	Invitation               *InvitationService
 	Upload                   *UploadService
+	Sync                     *SyncService
+	Analytics                *AnalyticsService
+	StockMovements           *StockMovementsService
+	StockAlerts              *StockAlertsService
+	Suppliers                *SuppliersService
+	PurchaseOrders           *PurchaseOrdersService
+	IngredientPrices         *IngredientPricesService
+	Modifiers                *ModifiersService
+	Bundles                  *BundlesService
+	SignInAttempts           *SignInAttemptsService
 }
 
 func NewMyService(repo *repository.Repository, strcode *strcode.Strcode, mailagent *mailagent.MailAgent, authjwt *authjwt.AuthJWT, s3cloud *selectelS3Cloud.SelectelS3Cloud) MyService {
-	return MyService{
+	ms := MyService{
 		Mware:                    newMiddlewareService(repo, authjwt),
 		Authorization:            newAuthorizationService(repo, strcode, mailagent, authjwt),
 		Employees:                newEmployeesService(repo),
+		Organizations:            newOrganizationsService(repo),
 		Outlets:                  newOutletsService(repo),
 		Sessions:                 newSessionsService(repo),
 		Categories:               newCategoriesService(repo),
@@ -44,6 +57,7 @@ func NewMyService(repo *repository.Repository, strcode *strcode.Strcode, mailage
 		Ingredients:              newIngredientsService(repo),
 		OrdersList:               newOrderListService(repo),
 		OrdersInfo:               newOrdersInfoService(repo),
+		OrderPayments:            newOrderPaymentsService(repo),
 		ProductsWithIngredients:  newProductsWithIngredientsService(repo),
 		CashChages:               newCashChangesService(repo),
 		InventoryHistory:         newInventoryHistoryService(repo),
@@ -51,5 +65,17 @@ func NewMyService(repo *repository.Repository, strcode *strcode.Strcode, mailage
 		IngredientsAddingHistory: newIngredientsAddingHistoryService(repo),
 		Invitation:               newInvitationService(repo),
 		Upload:                   newUploadService(repo, s3cloud),
+		Analytics:                newAnalyticsService(repo),
+		StockMovements:           newStockMovementsService(repo),
+		StockAlerts:              newStockAlertsService(repo, mailagent),
+		Suppliers:                newSuppliersService(repo),
+		PurchaseOrders:           newPurchaseOrdersService(repo),
+		IngredientPrices:         newIngredientPricesService(repo),
+		Modifiers:                newModifiersService(repo),
+		Bundles:                  newBundlesService(repo),
+		SignInAttempts:           newSignInAttemptsService(repo),
 	}
+
+	ms.Sync = newSyncService(repo, ms.Sessions, ms.OrdersInfo, ms.CashChages)
+	return ms
 }
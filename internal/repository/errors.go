@@ -5,4 +5,8 @@ import "errors"
 var (
 	ErrOnlyNumCanBeInPassword = errors.New("only numbers can be used in an employee's password")
 	ErrSessionAlreadyOpen     = errors.New("this user already has a covered session")
+	ErrUnknownSortField       = errors.New("unknown sort field")
+	ErrStockVersionConflict   = errors.New("ingredient stock was changed by another operation")
+	ErrIncompatibleUnit       = errors.New("incompatible unit of measure")
+	ErrInventoryAlreadyOpen   = errors.New("outlet already has an open inventory")
 )
@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//MigrationModel - отметка о выполненной разовой миграции данных
+type MigrationModel struct {
+	ID uint
+
+	Name      string `gorm:"size:100;uniqueIndex"`
+	AppliedAt int64  // unixmilli
+}
+
+//runOnce - выполняет миграцию данных fn, если миграция name еще не выполнялась.
+//Если процесс прервется между fn и отметкой, то fn выполнится повторно, поэтому fn должна быть безопасной для повторного запуска
+func runOnce(db *gorm.DB, name string, fn func() error) error {
+	var m MigrationModel
+	if err := db.Where(&MigrationModel{Name: name}).Limit(1).Find(&m).Error; err != nil || m.ID != 0 {
+		return err
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+	return db.Create(&MigrationModel{Name: name, AppliedAt: time.Now().UTC().UnixMilli()}).Error
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//кол-во записей на одной странице списка
+const (
+	LIST_DEFAULT_LIMIT = 100  // если limit не указан, но указаны offset или sort
+	LIST_MAX_LIMIT     = 1000 // максимальный limit (и limit, если не указаны ни limit, ни offset, ни sort)
+)
+
+//ListOptions - пагинация, сортировка и фильтр по периоду для списков
+type ListOptions struct {
+	Offset int
+	Limit  int    //0 - LIST_DEFAULT_LIMIT при постраничном запросе (offset или sort), иначе LIST_MAX_LIMIT; не больше LIST_MAX_LIMIT
+	Sort   string //поле сортировки, "-" в начале - по убыванию (например, "-date"). По умолчанию - по id
+	Start  uint64 //unixmilli (0 - без ограничения)
+	End    uint64 //unixmilli (0 - без ограничения)
+}
+
+//listSpec - колонка для фильтра по периоду и поля, по которым разрешена сортировка
+type listSpec struct {
+	DateColumn string            //колонка с датой в unixmilli
+	TimeColumn string            //колонка с датой типа datetime (используется, если нет DateColumn)
+	Sortable   map[string]string //поле сортировки -> колонка
+}
+
+//findPage - находит страницу записей по условию where и опциям opts.
+//total - кол-во записей по условию и периоду без учета пагинации
+func findPage(db *gorm.DB, where interface{}, opts *ListOptions, spec *listSpec, result interface{}) (total int64, err error) {
+	tx := db.Model(where).Where(where)
+
+	switch {
+	case spec.DateColumn != "":
+		if opts.Start != 0 {
+			tx = tx.Where(clause.Gte{Column: spec.DateColumn, Value: opts.Start})
+		}
+		if opts.End != 0 {
+			tx = tx.Where(clause.Lte{Column: spec.DateColumn, Value: opts.End})
+		}
+	case spec.TimeColumn != "":
+		if opts.Start != 0 {
+			tx = tx.Where(clause.Gte{Column: spec.TimeColumn, Value: time.UnixMilli(int64(opts.Start))})
+		}
+		if opts.End != 0 {
+			tx = tx.Where(clause.Lte{Column: spec.TimeColumn, Value: time.UnixMilli(int64(opts.End))})
+		}
+	}
+
+	//сортировка
+	sortColumn, desc := "id", strings.HasPrefix(opts.Sort, "-")
+	if sort := strings.TrimPrefix(opts.Sort, "-"); sort != "" {
+		column, ok := spec.Sortable[sort]
+		if !ok {
+			return 0, ErrUnknownSortField
+		}
+		sortColumn = column
+	}
+
+	tx = tx.Session(&gorm.Session{})
+	if err = tx.Count(&total).Error; err != nil {
+		return
+	}
+
+	tx = tx.Order(clause.OrderByColumn{Column: clause.Column{Name: sortColumn}, Desc: desc})
+	if sortColumn != "id" {
+		tx = tx.Order(clause.OrderByColumn{Column: clause.Column{Name: "id"}, Desc: desc})
+	}
+
+	//клиенты, которые не передают параметры пагинации, получают список целиком (до LIST_MAX_LIMIT записей)
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = LIST_MAX_LIMIT
+		if opts.Offset > 0 || opts.Sort != "" {
+			limit = LIST_DEFAULT_LIMIT
+		}
+	}
+	if limit > LIST_MAX_LIMIT {
+		limit = LIST_MAX_LIMIT
+	}
+	tx = tx.Limit(limit)
+
+	if opts.Offset > 0 {
+		tx = tx.Offset(opts.Offset)
+	}
+
+	err = tx.Find(result).Error
+	return
+}
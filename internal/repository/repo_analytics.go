@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+//группировки аналитики продаж
+const (
+	SALES_GROUP_DAY      = "day"
+	SALES_GROUP_WEEK     = "week"
+	SALES_GROUP_MONTH    = "month"
+	SALES_GROUP_HOUR     = "hour"
+	SALES_GROUP_PRODUCT  = "product"
+	SALES_GROUP_CATEGORY = "category"
+	SALES_GROUP_EMPLOYEE = "employee"
+	SALES_GROUP_OUTLET   = "outlet"
+)
+
+//SalesFilter - условия выборки продаж для аналитики
+type SalesFilter struct {
+	Start    int64 //unixmilli, по дате заказа (0 - без ограничения)
+	End      int64 //unixmilli, по дате заказа (0 - без ограничения)
+	TZOffset int   //смещение часового пояса в минутах (для группировки по времени)
+
+	ProductID  uint
+	CategoryID uint
+	EmployeeID uint
+
+	Components bool //раскладывать проданные комплекты на компоненты (выручка делится по долям компонентов)
+
+	OutletID uint //0 - все точки организации
+	OrgID    uint
+}
+
+//SalesRow - агрегированные продажи одной группы
+type SalesRow struct {
+	GroupKey  string
+	GroupName string
+	Revenue   float64
+	Cost      float64 //себестоимость по снимку на момент продажи
+	Quantity  int
+	Receipts  int
+}
+
+//выручка, себестоимость, кол-во проданных позиций и кол-во чеков
+const salesMetrics = "COALESCE(SUM(`ol`.`product_price` * `ol`.`count`), 0) AS `revenue`, " +
+	"COALESCE(SUM(`ol`.`cost_price` * `ol`.`count`), 0) AS `cost`, " +
+	"COALESCE(SUM(`ol`.`count`), 0) AS `quantity`, " +
+	"COUNT(DISTINCT `oi`.`id`) AS `receipts`"
+
+type AnalyticsRepo struct {
+	db *gorm.DB
+}
+
+func newAnalyticsRepo(db *gorm.DB) *AnalyticsRepo {
+	return &AnalyticsRepo{
+		db: db,
+	}
+}
+
+//Sales - продажи, сгруппированные по groupBy (SALES_GROUP_*)
+func (r *AnalyticsRepo) Sales(groupBy string, filter *SalesFilter) (result []SalesRow, err error) {
+	//локальное время заказа. Считается от эпохи без FROM_UNIXTIME, чтобы не зависеть от часового пояса сессии mysql
+	ts := fmt.Sprintf("DATE_ADD('1970-01-01 00:00:00', INTERVAL (`oi`.`date` + %d) DIV 1000 SECOND)", filter.TZOffset*60*1000)
+
+	var key, name, order string
+	switch groupBy {
+	case SALES_GROUP_DAY:
+		key, name, order = "DATE_FORMAT("+ts+", '%Y-%m-%d')", "''", "`group_key`"
+	case SALES_GROUP_WEEK:
+		key, name, order = "DATE_FORMAT("+ts+", '%x-W%v')", "''", "`group_key`"
+	case SALES_GROUP_MONTH:
+		key, name, order = "DATE_FORMAT("+ts+", '%Y-%m')", "''", "`group_key`"
+	case SALES_GROUP_HOUR:
+		key, name, order = "LPAD(HOUR("+ts+"), 2, '0')", "''", "`group_key`"
+	case SALES_GROUP_PRODUCT:
+		key, name, order = "`ol`.`product_id`", "MAX(`ol`.`product_name`)", "`revenue` DESC"
+	case SALES_GROUP_CATEGORY:
+		key, name, order = "COALESCE(`p`.`category_id`, 0)", "COALESCE(MAX(`c`.`name`), '')", "`revenue` DESC"
+	case SALES_GROUP_EMPLOYEE:
+		key, name, order = "`s`.`employee_id`", "COALESCE(MAX(`e`.`name`), '')", "`revenue` DESC"
+	case SALES_GROUP_OUTLET:
+		key, name, order = "`oi`.`outlet_id`", "COALESCE(MAX(`o`.`name`), '')", "`revenue` DESC"
+	default:
+		return nil, fmt.Errorf("unknown sales group `%s`", groupBy)
+	}
+
+	err = r.sales(filter).
+		Select(key + " AS `group_key`, " + name + " AS `group_name`, " + salesMetrics).
+		Group("`group_key`").
+		Order(order).
+		Scan(&result).Error
+	return
+}
+
+//SalesTotal - итог продаж без группировки
+func (r *AnalyticsRepo) SalesTotal(filter *SalesFilter) (result SalesRow, err error) {
+	err = r.sales(filter).Select(salesMetrics).Scan(&result).Error
+	return
+}
+
+//salesComponentLines - позиции заказов, в которых комплекты заменены их компонентами.
+//Выручка компонента - доля выручки комплекта, кол-во - кол-во компонента во всех проданных комплектах
+const salesComponentLines = "(SELECT `l`.`id`, `l`.`order_info_id`, `l`.`deleted_at`, " +
+	"COALESCE(`lc`.`product_id`, `l`.`product_id`) AS `product_id`, " +
+	"COALESCE(`lc`.`product_name`, `l`.`product_name`) AS `product_name`, " +
+	"CASE WHEN `lc`.`id` IS NULL THEN `l`.`product_price` ELSE `l`.`product_price` * `lc`.`share` / `lc`.`count` END AS `product_price`, " +
+	"CASE WHEN `lc`.`id` IS NULL THEN `l`.`cost_price` ELSE `lc`.`cost_price` END AS `cost_price`, " +
+	"`l`.`count` * COALESCE(`lc`.`count`, 1) AS `count` " +
+	"FROM `order_list_models` AS `l` LEFT JOIN `order_list_component_models` AS `lc` ON `lc`.`order_list_id` = `l`.`id`) AS `ol`"
+
+//sales - позиции неудаленных заказов, подходящие под фильтр
+func (r *AnalyticsRepo) sales(filter *SalesFilter) *gorm.DB {
+	lines := "`order_list_models` AS `ol`"
+	if filter.Components {
+		lines = salesComponentLines
+	}
+
+	tx := r.db.Table(lines).
+		Joins("JOIN `order_info_models` AS `oi` ON `oi`.`id` = `ol`.`order_info_id`").
+		Joins("LEFT JOIN `product_models` AS `p` ON `p`.`id` = `ol`.`product_id`").
+		Joins("LEFT JOIN `category_models` AS `c` ON `c`.`id` = `p`.`category_id`").
+		Joins("LEFT JOIN `session_models` AS `s` ON `s`.`id` = `oi`.`session_id`").
+		Joins("LEFT JOIN `employee_models` AS `e` ON `e`.`id` = `s`.`employee_id`").
+		Joins("LEFT JOIN `outlet_models` AS `o` ON `o`.`id` = `oi`.`outlet_id`").
+		Where("`ol`.`deleted_at` IS NULL AND `oi`.`deleted_at` IS NULL").
+		Where("`oi`.`org_id` = ?", filter.OrgID)
+
+	if filter.OutletID != 0 {
+		tx = tx.Where("`oi`.`outlet_id` = ?", filter.OutletID)
+	}
+
+	if filter.Start != 0 {
+		tx = tx.Where("`oi`.`date` >= ?", filter.Start)
+	}
+
+	if filter.End != 0 {
+		tx = tx.Where("`oi`.`date` <= ?", filter.End)
+	}
+
+	if filter.ProductID != 0 {
+		tx = tx.Where("`ol`.`product_id` = ?", filter.ProductID)
+	}
+
+	if filter.CategoryID != 0 {
+		tx = tx.Where("`p`.`category_id` = ?", filter.CategoryID)
+	}
+
+	if filter.EmployeeID != 0 {
+		tx = tx.Where("`s`.`employee_id` = ?", filter.EmployeeID)
+	}
+	return tx
+}
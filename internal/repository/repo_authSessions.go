@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/iivkis/pos.7-era.backend/internal/config"
+	"gorm.io/gorm"
+)
+
+//виды сессий входа
+const (
+	AUTH_SESSION_ORG      = 1 // вход организации
+	AUTH_SESSION_EMPLOYEE = 2 // вход сотрудника
+)
+
+//сколько хранятся истекшие и отозванные сессии
+const AuthSessionRetention = time.Hour * 24 * 7
+
+//AuthSessionModel - сессия входа. Хранит хеш токена обновления, токены доступа ссылаются на нее по id.
+//Отозванная сессия не обновляется, а ее токены доступа отклоняются
+type AuthSessionModel struct {
+	ID uint
+
+	Kind      int    // вид сессии [1 - организация, 2 - сотрудник]
+	TokenHash string `gorm:"size:64;uniqueIndex"` // sha256 текущего токена обновления
+	ExpiresIn int64  // истекает в (unixmilli)
+	RevokedAt int64  `gorm:"default:0"` // отозвана в (unixmilli), 0 - активна
+	CreatedAt int64  // unixmilli
+	UserAgent string `gorm:"size:255"`
+	IP        string `gorm:"size:45"`
+
+	EmployeeID uint `gorm:"index;default:NULL"` // только для сессии сотрудника
+	OrgID      uint `gorm:"index"`
+
+	EmployeeModel     EmployeeModel     `gorm:"foreignKey:EmployeeID"`
+	OrganizationModel OrganizationModel `gorm:"foreignKey:OrgID"`
+}
+
+type AuthSessionsRepo struct {
+	db *gorm.DB
+}
+
+func newAuthSessionsRepo(db *gorm.DB) *AuthSessionsRepo {
+	r := &AuthSessionsRepo{
+		db: db,
+	}
+
+	if *config.Flags.Main {
+		go func() {
+			for {
+				r.DeleteExpired()
+				time.Sleep(time.Hour)
+			}
+		}()
+	}
+
+	return r
+}
+
+//Create - создает сессию со сроком жизни ttl
+func (r *AuthSessionsRepo) Create(m *AuthSessionModel, ttl time.Duration) error {
+	now := time.Now().UTC()
+	m.CreatedAt = now.UnixMilli()
+	m.ExpiresIn = now.Add(ttl).UnixMilli()
+	return r.db.Create(m).Error
+}
+
+//FindActive - активная (не отозванная и не истекшая) сессия
+func (r *AuthSessionsRepo) FindActive(where *AuthSessionModel) (result *AuthSessionModel, err error) {
+	err = r.db.Where(where).
+		Where("`revoked_at` = 0 AND `expires_in` > ?", time.Now().UTC().UnixMilli()).
+		First(&result).Error
+	return
+}
+
+//IsActive - активна ли сессия (проверяется при каждом запросе с токеном доступа)
+func (r *AuthSessionsRepo) IsActive(where *AuthSessionModel) bool {
+	var session AuthSessionModel
+	return r.db.Select("id").Where(where).
+		Where("`revoked_at` = 0 AND `expires_in` > ?", time.Now().UTC().UnixMilli()).
+		First(&session).Error == nil
+}
+
+//Rotate - заменяет токен обновления активной сессии и продлевает ее на ttl.
+//Возвращает false, если сессия уже отозвана, истекла или токен уже был заменен параллельным запросом
+func (r *AuthSessionsRepo) Rotate(id uint, oldHash, newHash string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	tx := r.db.Model(&AuthSessionModel{}).
+		Where("`id` = ? AND `token_hash` = ? AND `revoked_at` = 0 AND `expires_in` > ?", id, oldHash, now.UnixMilli()).
+		Updates(map[string]interface{}{
+			"token_hash": newHash,
+			"expires_in": now.Add(ttl).UnixMilli(),
+		})
+	return tx.RowsAffected == 1, tx.Error
+}
+
+//Revoke - отзывает активные сессии, подходящие под условие
+func (r *AuthSessionsRepo) Revoke(where *AuthSessionModel) error {
+	return r.db.Model(&AuthSessionModel{}).
+		Where(where).
+		Where("`revoked_at` = 0").
+		UpdateColumn("revoked_at", time.Now().UTC().UnixMilli()).Error
+}
+
+//RevokeEmployee - отзывает все сессии сотрудника
+func (r *AuthSessionsRepo) RevokeEmployee(employeeID uint) error {
+	return r.Revoke(&AuthSessionModel{Kind: AUTH_SESSION_EMPLOYEE, EmployeeID: employeeID})
+}
+
+//DeleteExpired - удаляет сессии, истекшие или отозванные раньше срока хранения
+func (r *AuthSessionsRepo) DeleteExpired() error {
+	before := time.Now().Add(-AuthSessionRetention).UTC().UnixMilli()
+	return r.db.Where("`expires_in` < ? OR (`revoked_at` != 0 AND `revoked_at` < ?)", before, before).Delete(&AuthSessionModel{}).Error
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+)
+
+//BundleComponentModel - продукт, входящий в комплект (комбо).
+//Комплект - продукт с признаком IsBundle, его цена - цена всего комплекта
+type BundleComponentModel struct {
+	ID uint
+
+	Count int // кол-во компонента в одном комплекте
+
+	BundleID    uint `gorm:"index"` // продукт-комплект
+	ComponentID uint // продукт, входящий в комплект
+	OutletID    uint
+	OrgID       uint
+
+	BundleModel       ProductModel      `gorm:"foreignKey:BundleID"`
+	ComponentModel    ProductModel      `gorm:"foreignKey:ComponentID"`
+	OutletModel       OutletModel       `gorm:"foreignKey:OutletID"`
+	OrganizationModel OrganizationModel `gorm:"foreignKey:OrgID"`
+}
+
+//OrderListComponentModel - компонент комплекта, проданного в позиции заказа. Фиксируется на момент продажи.
+//Share - доля выручки комплекта, приходящаяся на компонент (доли компонентов позиции в сумме дают 1)
+type OrderListComponentModel struct {
+	ID uint
+
+	ProductName string
+	Count       int     // кол-во компонента в одном комплекте
+	Share       float64 // доля выручки комплекта
+	CostPrice   float64 // себестоимость единицы компонента на момент продажи
+
+	ProductID   uint
+	OrderListID uint `gorm:"index"`
+	OutletID    uint
+	OrgID       uint
+
+	ProductModel      ProductModel      `gorm:"foreignKey:ProductID"`
+	OrderListModel    OrderListModel    `gorm:"foreignKey:OrderListID"`
+	OutletModel       OutletModel       `gorm:"foreignKey:OutletID"`
+	OrganizationModel OrganizationModel `gorm:"foreignKey:OrgID"`
+}
+
+type BundlesRepo struct {
+	db *gorm.DB
+}
+
+func newBundlesRepo(db *gorm.DB) *BundlesRepo {
+	return &BundlesRepo{
+		db: db,
+	}
+}
+
+func (r *BundlesRepo) Create(m *BundleComponentModel) error {
+	return r.db.Create(m).Error
+}
+
+func (r *BundlesRepo) Find(where *BundleComponentModel) (result *[]BundleComponentModel, err error) {
+	err = r.db.Where(where).Order("id").Find(&result).Error
+	return
+}
+
+//FindComponents - компоненты комплекта bundleID вместе с продуктами
+func (r *BundlesRepo) FindComponents(bundleID uint) (result *[]BundleComponentModel, err error) {
+	err = r.db.Preload("ComponentModel").Where(&BundleComponentModel{BundleID: bundleID}).Order("id").Find(&result).Error
+	return
+}
+
+func (r *BundlesRepo) FindFirst(where *BundleComponentModel) (result *BundleComponentModel, err error) {
+	err = r.db.Where(where).First(&result).Error
+	return
+}
+
+func (r *BundlesRepo) UpdatesFull(where *BundleComponentModel, updatedFields *map[string]interface{}) error {
+	return r.db.Model(where).Where(where).Updates(updatedFields).Error
+}
+
+func (r *BundlesRepo) Delete(where *BundleComponentModel) error {
+	return r.db.Where(where).Delete(&BundleComponentModel{}).Error
+}
+
+//IsComponent - входит ли продукт в какой-либо комплект
+func (r *BundlesRepo) IsComponent(productID uint) bool {
+	return r.db.Select("id").Where(&BundleComponentModel{ComponentID: productID}).First(&BundleComponentModel{}).Error == nil
+}
+
+//CreateLineComponents - сохраняет компоненты комплекта, проданного в позиции заказа
+func (r *BundlesRepo) CreateLineComponents(components []OrderListComponentModel) error {
+	if len(components) == 0 {
+		return nil
+	}
+	return r.db.Create(&components).Error
+}
+
+//FindLineComponents - компоненты комплектов, проданных в позициях заказа orderListIDs
+func (r *BundlesRepo) FindLineComponents(orderListIDs []uint) (result *[]OrderListComponentModel, err error) {
+	err = r.db.Where("`order_list_id` IN ?", orderListIDs).Order("id").Find(&result).Error
+	return
+}
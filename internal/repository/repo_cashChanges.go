@@ -43,11 +43,26 @@ func (r *CashChangesRepo) Find(where *CashChangesModel) (result *[]CashChangesMo
 	return
 }
 
-func (r CashChangesRepo) FindWithPeriod(dateStart uint64, dateEnd uint64, where *CashChangesModel) (result *[]CashChangesModel, err error) {
-	if dateEnd <= 0 {
-		err = r.db.Where("date >= ?", dateStart).Find(&result, where).Error
-		return
-	}
-	err = r.db.Where("date >= ? AND date <= ?", dateStart, dateEnd).Find(&result, where).Error
+func (r CashChangesRepo) FindPage(where *CashChangesModel, opts *ListOptions) (result *[]CashChangesModel, total int64, err error) {
+	total, err = findPage(r.db, where, opts, &listSpec{
+		DateColumn: "date",
+		Sortable:   map[string]string{"id": "id", "date": "date", "total": "total"},
+	}, &result)
 	return
 }
+
+//SumForSession - сумма внесений (total > 0) и снятий (total < 0) денежных средств в сессии.
+//Снятия возвращаются положительным числом
+func (r *CashChangesRepo) SumForSession(sessionID uint) (deposits float64, withdrawals float64, err error) {
+	var result struct {
+		Deposits    float64
+		Withdrawals float64
+	}
+
+	err = r.db.Model(&CashChangesModel{}).
+		Select("COALESCE(SUM(CASE WHEN `total` > 0 THEN `total` ELSE 0 END), 0) AS `deposits`, "+
+			"COALESCE(SUM(CASE WHEN `total` < 0 THEN -`total` ELSE 0 END), 0) AS `withdrawals`").
+		Where("`session_id` = ?", sessionID).
+		Scan(&result).Error
+	return result.Deposits, result.Withdrawals, err
+}
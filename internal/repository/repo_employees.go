@@ -3,6 +3,7 @@ package repository
 import (
 	"strconv"
 
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
@@ -10,7 +11,7 @@ type EmployeeModel struct {
 	gorm.Model
 
 	Name     string
-	Password string
+	Password string // bcrypt-хеш пин-кода
 	Role     string
 	Online   bool
 
@@ -33,6 +34,19 @@ func (m *EmployeeModel) passwordValidation() bool {
 	return true
 }
 
+//hashPassword - заменяет пин-код в модели на его хеш
+func (m *EmployeeModel) hashPassword() error {
+	pwd, err := bcrypt.GenerateFromPassword([]byte(m.Password), 7)
+	if err != nil {
+		return err
+	}
+	m.Password = string(pwd)
+	return nil
+}
+
+//хеш для сравнения, когда сотрудник не найден (чтобы время ответа не выдавало существование сотрудника)
+var employeeDummyHash, _ = bcrypt.GenerateFromPassword([]byte("000000"), 7)
+
 //проверка, имеет ли сотрудник какую-либо роль из массива roles
 func (m *EmployeeModel) HasRole(roles ...string) bool {
 	for _, role := range roles {
@@ -53,22 +67,47 @@ func newEmployeesRepo(db *gorm.DB) *EmployeesRepo {
 	}
 }
 
-//actual
+//SignIn - находит сотрудника организации по id и сравнивает пин-код с хешем.
+//Если сотрудник не найден - gorm.ErrRecordNotFound, если пин-код не подходит - bcrypt.ErrMismatchedHashAndPassword
 func (r *EmployeesRepo) SignIn(id uint, password string, orgID uint) (empl EmployeeModel, err error) {
-	err = r.db.Where("id = ? AND org_id = ? AND password = ?", id, orgID, password).First(&empl).Error
+	if err = r.db.Where("id = ? AND org_id = ?", id, orgID).First(&empl).Error; err != nil {
+		bcrypt.CompareHashAndPassword(employeeDummyHash, []byte(password))
+		return
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(empl.Password), []byte(password))
 	return
 }
 
+//CheckPassword - подходит ли пин-код сотруднику
+func (r *EmployeesRepo) CheckPassword(id uint, password string) bool {
+	var empl EmployeeModel
+	if err := r.db.Select("id", "password").First(&empl, id).Error; err != nil {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(empl.Password), []byte(password)) == nil
+}
+
 func (r *EmployeesRepo) Create(model *EmployeeModel) (err error) {
 	if !model.passwordValidation() {
 		return ErrOnlyNumCanBeInPassword
 	}
+
+	if err := model.hashPassword(); err != nil {
+		return err
+	}
 	return r.db.Create(model).Error
 }
 
 func (r *EmployeesRepo) Updates(updatedFields *EmployeeModel, where *EmployeeModel) error {
-	if updatedFields.Password != "" && !updatedFields.passwordValidation() {
-		return ErrOnlyNumCanBeInPassword
+	if updatedFields.Password != "" {
+		if !updatedFields.passwordValidation() {
+			return ErrOnlyNumCanBeInPassword
+		}
+
+		if err := updatedFields.hashPassword(); err != nil {
+			return err
+		}
 	}
 	return r.db.Where(where).Updates(updatedFields).Error
 }
@@ -104,3 +143,22 @@ func (r *EmployeesRepo) SetOnline(employeeID interface{}) error {
 func (r *EmployeesRepo) SetOffline(employeeID interface{}) error {
 	return r.db.Model(&EmployeeModel{}).Where("id = ?", employeeID).UpdateColumn("online", false).Error
 }
+
+//rehashPlainPasswords - хеширует пин-коды, которые еще хранятся открытым текстом (bcrypt-хеш начинается с "$2")
+func (r *EmployeesRepo) rehashPlainPasswords() error {
+	var employees []EmployeeModel
+	if err := r.db.Unscoped().Select("id", "password").Where("`password` NOT LIKE ?", "$2%").Find(&employees).Error; err != nil {
+		return err
+	}
+
+	for _, empl := range employees {
+		if err := empl.hashPassword(); err != nil {
+			return err
+		}
+
+		if err := r.db.Model(&EmployeeModel{}).Unscoped().Where("id = ?", empl.ID).UpdateColumn("password", empl.Password).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/iivkis/pos.7-era.backend/internal/config"
+	"gorm.io/gorm"
+)
+
+//сколько хранится ответ на запрос с ключом идемпотентности
+const IdempotencyKeyRetention = time.Hour * 24
+
+type IdempotencyKeyModel struct {
+	ID uint
+
+	Key      string `gorm:"size:100;uniqueIndex:idx_idempotency_org_key"` // ключ из заголовка `Idempotency-Key`
+	Method   string `gorm:"size:10"`
+	Path     string `gorm:"size:255"`
+	BodyHash string `gorm:"size:64"` // sha256 тела запроса
+
+	StatusCode int    `gorm:"default:0"` // http код сохраненного ответа (0 - запрос еще обрабатывается)
+	Response   string `gorm:"type:text"` // тело сохраненного ответа
+	ExpiresIn  int64  // истекает в (unixmilli)
+
+	OrgID uint `gorm:"uniqueIndex:idx_idempotency_org_key"`
+
+	OrganizationModel OrganizationModel `gorm:"foreignKey:OrgID"`
+}
+
+type IdempotencyKeysRepo struct {
+	db *gorm.DB
+}
+
+func newIdempotencyKeysRepo(db *gorm.DB) *IdempotencyKeysRepo {
+	r := &IdempotencyKeysRepo{
+		db: db,
+	}
+
+	if *config.Flags.Main {
+		go func() {
+			for {
+				r.DeleteExpired()
+				time.Sleep(time.Hour)
+			}
+		}()
+	}
+
+	return r
+}
+
+//Create - резервирует ключ (до сохранения ответа StatusCode = 0).
+//Если ключ уже есть в организации, то вернется ошибка БД о дубликате
+func (r *IdempotencyKeysRepo) Create(m *IdempotencyKeyModel) error {
+	m.ExpiresIn = time.Now().Add(IdempotencyKeyRetention).UTC().UnixMilli()
+	return r.db.Create(m).Error
+}
+
+func (r *IdempotencyKeysRepo) FindFirts(where *IdempotencyKeyModel) (result *IdempotencyKeyModel, err error) {
+	err = r.db.Where(where).First(&result).Error
+	return
+}
+
+//SaveResponse - сохраняет ответ, который будет возвращаться на повторные запросы с этим ключом
+func (r *IdempotencyKeysRepo) SaveResponse(id uint, statusCode int, response string) error {
+	return r.db.Model(&IdempotencyKeyModel{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status_code": statusCode,
+		"response":    response,
+	}).Error
+}
+
+func (r *IdempotencyKeysRepo) Delete(where *IdempotencyKeyModel) (err error) {
+	err = r.db.Where(where).Delete(&IdempotencyKeyModel{}).Error
+	return
+}
+
+func (r *IdempotencyKeysRepo) DeleteExpired() (err error) {
+	err = r.db.Where("expires_in <= ?", time.Now().UTC().UnixMilli()).Delete(&IdempotencyKeyModel{}).Error
+	return
+}
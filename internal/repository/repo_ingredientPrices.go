@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//причины изменения закупочной цены ингредиента
+const (
+	PRICE_CHANGE_ARRIVAL = 1 // поступление (пересчет средневзвешенной цены)
+	PRICE_CHANGE_MANUAL  = 2 // ручное изменение
+	PRICE_CHANGE_OPENING = 3 // начальная цена (создание ингредиента или появление истории)
+	PRICE_CHANGE_UNIT    = 4 // пересчет при смене единицы хранения
+)
+
+//IngredientPriceModel - запись истории закупочной цены ингредиента. Записи только добавляются
+type IngredientPriceModel struct {
+	ID uint
+
+	Reason      int     // причина [1 - поступление, 2 - ручное изменение, 3 - начальная цена, 4 - смена единицы хранения]
+	SourceID    uint    // id документа-основания (поступление, ингредиент)
+	Price       float64 // закупочная цена после изменения
+	PriceBefore float64 // закупочная цена до изменения
+
+	ArrivalCount float64 // кол-во поступившего ингредиента (только для поступления)
+	ArrivalPrice float64 // цена за единицу в поступлении (только для поступления)
+	CountBefore  float64 // остаток до поступления
+
+	Date int64 `gorm:"index"` //unixmilli
+
+	IngredientID uint `gorm:"index"`
+	EmployeeID   uint // 0 - изменение сделано системой
+	OutletID     uint
+	OrgID        uint
+
+	IngredientModel   IngredientModel   `gorm:"foreignKey:IngredientID"`
+	OutletModel       OutletModel       `gorm:"foreignKey:OutletID"`
+	OrganizationModel OrganizationModel `gorm:"foreignKey:OrgID"`
+}
+
+type IngredientPricesRepo struct {
+	db *gorm.DB
+}
+
+func newIngredientPricesRepo(db *gorm.DB) *IngredientPricesRepo {
+	return &IngredientPricesRepo{
+		db: db,
+	}
+}
+
+func (r *IngredientPricesRepo) Create(m *IngredientPriceModel) error {
+	return r.db.Create(m).Error
+}
+
+func (r *IngredientPricesRepo) FindPage(where *IngredientPriceModel, opts *ListOptions) (result *[]IngredientPriceModel, total int64, err error) {
+	total, err = findPage(r.db, where, opts, &listSpec{
+		DateColumn: "date",
+		Sortable:   map[string]string{"id": "id", "date": "date", "price": "price"},
+	}, &result)
+	return
+}
+
+//backfillOpening - записывает в историю текущие закупочные цены ингредиентов, у которых еще нет истории, как начальные.
+//Вызывается один раз, после создания истории (повторный запуск ничего не дублирует)
+func (r *IngredientPricesRepo) backfillOpening() error {
+	return r.db.Exec("INSERT INTO `ingredient_price_models` (`reason`, `source_id`, `price`, `price_before`, `arrival_count`, `arrival_price`, `count_before`, `date`, `ingredient_id`, `employee_id`, `outlet_id`, `org_id`) "+
+		"SELECT @reason, `id`, `purchase_price`, `purchase_price`, 0, 0, `count`, @date, `id`, 0, `outlet_id`, `org_id` FROM `ingredient_models` AS `i` WHERE `deleted_at` IS NULL "+
+		"AND NOT EXISTS (SELECT 1 FROM `ingredient_price_models` AS `p` WHERE `p`.`ingredient_id` = `i`.`id`)",
+		sql.Named("reason", PRICE_CHANGE_OPENING),
+		sql.Named("date", time.Now().UTC().UnixMilli()),
+	).Error
+}
+
+//weightedAveragePrice - средневзвешенная закупочная цена после поступления count единиц по цене price
+//к остатку stock с ценой stockPrice. Если остатка нет (или он отрицательный), то цена - цена поступления
+func weightedAveragePrice(stock, stockPrice, count, price float64) float64 {
+	if count <= 0 {
+		return stockPrice
+	}
+
+	if stock <= 0 {
+		return price
+	}
+	return (stock*stockPrice + count*price) / (stock + count)
+}
+
+//lockIngredient - читает остаток и закупочную цену ингредиента с блокировкой строки до конца транзакции
+func lockIngredient(db *gorm.DB, ingredientID uint) (*IngredientModel, error) {
+	var ingredient IngredientModel
+	err := db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "count", "purchase_price", "outlet_id", "org_id").
+		First(&ingredient, ingredientID).Error
+	return &ingredient, err
+}
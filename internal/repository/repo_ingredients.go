@@ -1,6 +1,12 @@
 package repository
 
-import "gorm.io/gorm"
+import (
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
 
 type IngredientModel struct {
 	ID        uint
@@ -9,7 +15,11 @@ type IngredientModel struct {
 	Name          string
 	Count         float64
 	PurchasePrice float64 //закупочная цена
-	MeasureUnit   int     // единица измерения [1 - кг, 2 - л, 3 - шт]
+	MeasureUnit   int     // единица хранения [1 - кг, 2 - л, 3 - шт, 4 - г, 5 - мл]
+	PackSize      float64 `gorm:"default:0"` // размер упаковки в единицах хранения (0 - не задан)
+	Version       uint    `gorm:"default:0"` // версия остатков, увеличивается при каждом изменении count (оптимистическая блокировка)
+	MinCount      float64 `gorm:"default:0"` // минимальный остаток: при падении ниже отправляется уведомление (0 - не отслеживается)
+	ReorderCount  float64 `gorm:"default:0"` // сколько заказывать при пополнении
 
 	OutletID uint
 	OrgID    uint
@@ -51,6 +61,12 @@ func (r *IngredientsRepo) UpdatesFull(where *IngredientModel, updatedFields *map
 	return r.db.Model(where).Where(where).Updates(updatedFields).Error
 }
 
+//FindLowStock - ингредиенты, остаток которых ниже минимального или отрицательный
+func (r IngredientsRepo) FindLowStock(where *IngredientModel) (result *[]IngredientModel, err error) {
+	err = r.db.Where(where).Where("(`min_count` > 0 AND `count` < `min_count`) OR `count` < 0").Find(&result).Error
+	return
+}
+
 func (r *IngredientsRepo) Delete(where *IngredientModel) (err error) {
 	err = r.db.Where(where).Delete(&IngredientModel{}).Error
 	return
@@ -59,3 +75,198 @@ func (r *IngredientsRepo) Delete(where *IngredientModel) (err error) {
 func (r *IngredientsRepo) Exists(where *IngredientModel) bool {
 	return r.db.Select("id").Where(where).First(&IngredientModel{}).Error == nil
 }
+
+//AddCount - атомарно изменяет остаток ингредиента на delta (delta < 0 - списание) и записывает движение в журнал
+func (r *IngredientsRepo) AddCount(ingredientID uint, delta float64, move StockMovementModel) error {
+	_, err := addIngredientCount(r.db, ingredientID, delta, move)
+	return err
+}
+
+//SetCount - устанавливает остаток ингредиента, прочитанного ранее, если его версия не изменилась с момента чтения,
+//и записывает движение в журнал. Если версия изменилась, то возвращает ErrStockVersionConflict
+func (r *IngredientsRepo) SetCount(ingredient *IngredientModel, count float64, move StockMovementModel) error {
+	res := r.db.Exec("UPDATE `ingredient_models` SET `count` = @count, `version` = `version` + 1 WHERE `id` = @id AND `version` = @version",
+		sql.Named("count", count),
+		sql.Named("id", ingredient.ID),
+		sql.Named("version", ingredient.Version),
+	)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return ErrStockVersionConflict
+	}
+
+	//версия не менялась, значит остаток до изменения - прочитанный
+	_, err := recordStockMovement(r.db, ingredient.ID, count-ingredient.Count, move)
+	return err
+}
+
+//Receive - поступление count единиц ингредиента по цене price: атомарно увеличивает остаток,
+//пересчитывает закупочную цену как средневзвешенную, записывает движение в журнал и цену в историю.
+//Должен вызываться в транзакции: строка ингредиента блокируется до ее конца
+func (r *IngredientsRepo) Receive(ingredientID uint, count float64, price float64, move StockMovementModel) error {
+	ingredient, err := lockIngredient(r.db, ingredientID)
+	if err != nil {
+		return err
+	}
+
+	newPrice := weightedAveragePrice(ingredient.Count, ingredient.PurchasePrice, count, price)
+
+	res := r.db.Exec("UPDATE `ingredient_models` SET `count` = `count` + @n, `purchase_price` = @price, `version` = `version` + 1 WHERE `id` = @id",
+		sql.Named("n", count),
+		sql.Named("price", newPrice),
+		sql.Named("id", ingredientID),
+	)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if _, err := recordStockMovement(r.db, ingredientID, count, move); err != nil {
+		return err
+	}
+
+	return r.db.Create(&IngredientPriceModel{
+		Reason:       PRICE_CHANGE_ARRIVAL,
+		SourceID:     move.SourceID,
+		Price:        newPrice,
+		PriceBefore:  ingredient.PurchasePrice,
+		ArrivalCount: count,
+		ArrivalPrice: price,
+		CountBefore:  ingredient.Count,
+		Date:         time.Now().UTC().UnixMilli(),
+		IngredientID: ingredientID,
+		EmployeeID:   move.EmployeeID,
+		OutletID:     ingredient.OutletID,
+		OrgID:        ingredient.OrgID,
+	}).Error
+}
+
+//SetPurchasePrice - вручную устанавливает закупочную цену ингредиента и записывает ее в историю.
+//Если цена не изменилась, то запись не создается. Должен вызываться в транзакции
+func (r *IngredientsRepo) SetPurchasePrice(ingredientID uint, price float64, employeeID uint) error {
+	ingredient, err := lockIngredient(r.db, ingredientID)
+	if err != nil {
+		return err
+	}
+
+	if ingredient.PurchasePrice == price {
+		return nil
+	}
+
+	if err := r.db.Model(&IngredientModel{}).Where("`id` = ?", ingredientID).Update("purchase_price", price).Error; err != nil {
+		return err
+	}
+
+	return r.db.Create(&IngredientPriceModel{
+		Reason:       PRICE_CHANGE_MANUAL,
+		SourceID:     ingredientID,
+		Price:        price,
+		PriceBefore:  ingredient.PurchasePrice,
+		CountBefore:  ingredient.Count,
+		Date:         time.Now().UTC().UnixMilli(),
+		IngredientID: ingredientID,
+		EmployeeID:   employeeID,
+		OutletID:     ingredient.OutletID,
+		OrgID:        ingredient.OrgID,
+	}).Error
+}
+
+//ChangeUnit - меняет единицу хранения ингредиента в пределах одной величины (кг <-> г, л <-> мл).
+//Остаток, минимальный остаток, кол-во для заказа, размер упаковки, закупочная цена, расход в рецептах и опциях
+//и незакрытые заказы поставщику пересчитываются в новую единицу. Изменение цены записывается в историю.
+//Если величины разные, то возвращает ErrIncompatibleUnit, если у точки открыта инвентаризация - ErrInventoryAlreadyOpen.
+//Должен вызываться в транзакции
+func (r *IngredientsRepo) ChangeUnit(ingredientID uint, unit int, employeeID uint) error {
+	var ingredient IngredientModel
+	if err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&ingredient, ingredientID).Error; err != nil {
+		return err
+	}
+
+	if ingredient.MeasureUnit == unit {
+		return nil
+	}
+
+	factor, err := UnitFactor(ingredient.MeasureUnit, unit)
+	if err != nil {
+		return err
+	}
+
+	//ожидаемые остатки открытой инвентаризации зафиксированы в старой единице
+	if r.db.Select("id").Where(&InventoryHistoryModel{Status: INVENTORY_DRAFT, OutletID: ingredient.OutletID}).First(&InventoryHistoryModel{}).Error == nil {
+		return ErrInventoryAlreadyOpen
+	}
+
+	//остаток физически не меняется, но версия увеличивается: прочитанные ранее остатки в старой единице не перезапишутся
+	err = r.db.Exec("UPDATE `ingredient_models` SET `measure_unit` = @unit, `count` = `count` * @f, `min_count` = `min_count` * @f, "+
+		"`reorder_count` = `reorder_count` * @f, `pack_size` = `pack_size` * @f, `purchase_price` = `purchase_price` / @f, `version` = `version` + 1 WHERE `id` = @id",
+		sql.Named("unit", unit),
+		sql.Named("f", factor),
+		sql.Named("id", ingredientID),
+	).Error
+	if err != nil {
+		return err
+	}
+
+	err = r.db.Exec("UPDATE `product_with_ingredient_models` SET `count_take_for_sell` = `count_take_for_sell` * ? WHERE `ingredient_id` = ?", factor, ingredientID).Error
+	if err != nil {
+		return err
+	}
+
+	err = r.db.Exec("UPDATE `modifier_option_ingredient_models` SET `count` = `count` * ? WHERE `ingredient_id` = ?", factor, ingredientID).Error
+	if err != nil {
+		return err
+	}
+
+	//полученные заказы уже учтены в остатке, пересчитываются только ожидаемые
+	err = r.db.Exec("UPDATE `purchase_order_line_models` AS `l` JOIN `purchase_order_models` AS `o` ON `o`.`id` = `l`.`purchase_order_id` "+
+		"SET `l`.`count` = `l`.`count` * @f, `l`.`received_count` = `l`.`received_count` * @f, `l`.`price` = `l`.`price` / @f "+
+		"WHERE `l`.`ingredient_id` = @id AND `o`.`status` IN @statuses",
+		sql.Named("f", factor),
+		sql.Named("id", ingredientID),
+		sql.Named("statuses", []int{PO_DRAFT, PO_SENT, PO_PARTIALLY_RECEIVED}),
+	).Error
+	if err != nil {
+		return err
+	}
+
+	//остаток в новой единице восстанавливается по журналу: пересчет записывается как движение
+	if _, err := recordStockMovement(r.db, ingredientID, ingredient.Count*factor-ingredient.Count, StockMovementModel{
+		Reason:     STOCK_MOVE_UNIT_CHANGE,
+		SourceID:   ingredientID,
+		EmployeeID: employeeID,
+	}); err != nil {
+		return err
+	}
+
+	return r.db.Create(&IngredientPriceModel{
+		Reason:       PRICE_CHANGE_UNIT,
+		SourceID:     ingredientID,
+		Price:        ingredient.PurchasePrice / factor,
+		PriceBefore:  ingredient.PurchasePrice,
+		CountBefore:  ingredient.Count,
+		Date:         time.Now().UTC().UnixMilli(),
+		IngredientID: ingredientID,
+		EmployeeID:   employeeID,
+		OutletID:     ingredient.OutletID,
+		OrgID:        ingredient.OrgID,
+	}).Error
+}
+
+//addIngredientCount - атомарно изменяет остаток ингредиента на delta, увеличивает версию остатков и записывает движение в журнал.
+//Возвращает ингредиент с остатком после изменения
+func addIngredientCount(db *gorm.DB, ingredientID uint, delta float64, move StockMovementModel) (*IngredientModel, error) {
+	res := db.Exec("UPDATE `ingredient_models` SET `count` = `count` + @n, `version` = `version` + 1 WHERE `id` = @id",
+		sql.Named("n", delta),
+		sql.Named("id", ingredientID),
+	)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return recordStockMovement(db, ingredientID, delta, move)
+}
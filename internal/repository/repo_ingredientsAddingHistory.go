@@ -41,12 +41,11 @@ func (r IngredientsAddingHistoryRepo) Find(where *IngredientsAddingHistoryModel)
 	return
 }
 
-func (r IngredientsAddingHistoryRepo) FindWithPeriod(where *IngredientsAddingHistoryModel, start uint64, end uint64) (result *[]IngredientsAddingHistoryModel, err error) {
-	if end == 0 {
-		err = r.db.Where("date >= ?", start).Find(&result, where).Error
-	} else {
-		err = r.db.Where("date >= ? AND date <= ?", start, end).Find(&result, where).Error
-	}
+func (r IngredientsAddingHistoryRepo) FindPage(where *IngredientsAddingHistoryModel, opts *ListOptions) (result *[]IngredientsAddingHistoryModel, total int64, err error) {
+	total, err = findPage(r.db, where, opts, &listSpec{
+		DateColumn: "date",
+		Sortable:   map[string]string{"id": "id", "date": "date", "count": "count", "total": "total"},
+	}, &result)
 	return
 }
 
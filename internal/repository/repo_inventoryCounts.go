@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//InventoryCountModel - пересчет ингредиента одним сотрудником в открытой инвентаризации.
+//Несколько сотрудников считают разные места хранения: фактический остаток - сумма их пересчетов.
+//Повторный пересчет сотрудника заменяет его предыдущий
+type InventoryCountModel struct {
+	ID uint
+
+	Count    float64 // фактическое кол-во
+	Position uint    // последняя запись журнала движения ингредиента на момент пересчета
+	Balance  float64 // остаток в системе на момент пересчета
+
+	Date int64 //unixmilli
+
+	InventoryHistoryID uint `gorm:"uniqueIndex:idx_inventory_count"`
+	IngredientID       uint `gorm:"uniqueIndex:idx_inventory_count"`
+	EmployeeID         uint `gorm:"uniqueIndex:idx_inventory_count"`
+	OutletID           uint
+	OrgID              uint
+
+	InventoryHistoryModel InventoryHistoryModel `gorm:"foreignKey:InventoryHistoryID"`
+	IngredientModel       IngredientModel       `gorm:"foreignKey:IngredientID"`
+	OutletModel           OutletModel           `gorm:"foreignKey:OutletID"`
+	OrganizationModel     OrganizationModel     `gorm:"foreignKey:OrgID"`
+}
+
+type InventoryCountsRepo struct {
+	db *gorm.DB
+}
+
+func newInventoryCountsRepo(db *gorm.DB) *InventoryCountsRepo {
+	return &InventoryCountsRepo{
+		db: db,
+	}
+}
+
+//Submit - сохраняет пересчет сотрудника вместе с остатком в системе на этот момент.
+//Должен вызываться в транзакции: строка ингредиента блокируется, чтобы остаток и позиция в журнале соответствовали друг другу
+func (r *InventoryCountsRepo) Submit(m *InventoryCountModel) error {
+	ingredient, err := lockIngredient(r.db, m.IngredientID)
+	if err != nil {
+		return err
+	}
+
+	var position uint
+	if err := r.db.Model(&StockMovementModel{}).
+		Select("COALESCE(MAX(`id`), 0)").
+		Where(&StockMovementModel{IngredientID: m.IngredientID}).
+		Scan(&position).Error; err != nil {
+		return err
+	}
+
+	m.Position = position
+	m.Balance = ingredient.Count
+
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "inventory_history_id"}, {Name: "ingredient_id"}, {Name: "employee_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"count", "position", "balance", "date"}),
+	}).Create(m).Error
+}
+
+func (r InventoryCountsRepo) Find(where *InventoryCountModel) (result *[]InventoryCountModel, err error) {
+	err = r.db.Where(where).Order("id").Find(&result).Error
+	return
+}
@@ -1,14 +1,30 @@
 package repository
 
-import "gorm.io/gorm"
+import (
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//статусы инвентаризации
+const (
+	INVENTORY_DRAFT     = 1 // открыта: остатки зафиксированы, идет пересчет
+	INVENTORY_COMMITTED = 2 // проведена: остатки изменены
+	INVENTORY_CANCELLED = 3 // отменена: остатки не менялись
+)
 
 type InventoryHistoryModel struct {
 	gorm.Model
 
-	Date       int64 //unixmilli
-	EmployeeID uint  //сотрудник, который делал инветаризацию
-	OutletID   uint
-	OrgID      uint
+	Status      int   `gorm:"default:2"` // статус [1 - открыта, 2 - проведена, 3 - отменена]
+	Date        int64 //unixmilli
+	CommittedAt int64 `gorm:"default:0"` //unixmilli
+	EmployeeID  uint  //сотрудник, который делал инветаризацию
+	CommittedBy uint  `gorm:"default:0"` //сотрудник, который провел инвентаризацию
+	OutletID    uint
+	OrgID       uint
 
 	EmployeeModel     EmployeeModel     `gorm:"foreignKey:EmployeeID"`
 	OutletModel       OutletModel       `gorm:"foreignKey:OutletID"`
@@ -29,17 +45,59 @@ func (r *InventoryHistoryRepo) Create(m *InventoryHistoryModel) error {
 	return r.db.Create(m).Error
 }
 
+//Open - создает открытую инвентаризацию и фиксирует ожидаемые остатки всех ингредиентов точки (позиции инвентаризации).
+//Строка точки блокируется до конца транзакции, поэтому параллельные вызовы не откроют две инвентаризации.
+//Если у точки уже есть открытая инвентаризация, возвращает ErrInventoryAlreadyOpen
+func (r *InventoryHistoryRepo) Open(m *InventoryHistoryModel) error {
+	if err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&OutletModel{}, m.OutletID).Error; err != nil {
+		return err
+	}
+
+	if r.Exists(&InventoryHistoryModel{Status: INVENTORY_DRAFT, OutletID: m.OutletID, OrgID: m.OrgID}) {
+		return ErrInventoryAlreadyOpen
+	}
+
+	m.Status = INVENTORY_DRAFT
+	if err := r.db.Create(m).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return r.db.Exec("INSERT INTO `inventory_list_models` (`created_at`, `updated_at`, `old_count`, `new_count`, `loss_price`, `ingredient_id`, `inventory_history_id`, `outlet_id`, `org_id`) "+
+		"SELECT @now, @now, `count`, 0, 0, `id`, @history, `outlet_id`, `org_id` FROM `ingredient_models` WHERE `outlet_id` = @outlet AND `org_id` = @org AND `deleted_at` IS NULL",
+		sql.Named("now", now),
+		sql.Named("history", m.ID),
+		sql.Named("outlet", m.OutletID),
+		sql.Named("org", m.OrgID),
+	).Error
+}
+
+func (r InventoryHistoryRepo) FindFirst(where *InventoryHistoryModel) (result *InventoryHistoryModel, err error) {
+	err = r.db.Where(where).First(&result).Error
+	return
+}
+
+//LockStatus - статус инвентаризации с блокировкой строки до конца транзакции (чтобы статус не изменился одновременно)
+func (r *InventoryHistoryRepo) LockStatus(id uint) (status int, err error) {
+	var history InventoryHistoryModel
+	err = r.db.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").First(&history, id).Error
+	return history.Status, err
+}
+
+func (r *InventoryHistoryRepo) UpdatesFull(where *InventoryHistoryModel, updatedFields *map[string]interface{}) error {
+	return r.db.Model(where).Where(where).Updates(updatedFields).Error
+}
+
 func (r InventoryHistoryRepo) Find(where *InventoryHistoryModel) (result *[]InventoryHistoryModel, err error) {
 	err = r.db.Where(where).Find(&result).Error
 	return
 }
 
-func (r InventoryHistoryRepo) FindWithPeriod(where *InventoryHistoryModel, start uint64, end uint64) (result *[]InventoryHistoryModel, err error) {
-	if end == 0 {
-		err = r.db.Where("date >= ?", start).Find(&result, where).Error
-	} else {
-		err = r.db.Where("date >= ? AND date <= ?", start, end).Find(&result, where).Error
-	}
+func (r InventoryHistoryRepo) FindPage(where *InventoryHistoryModel, opts *ListOptions) (result *[]InventoryHistoryModel, total int64, err error) {
+	total, err = findPage(r.db, where, opts, &listSpec{
+		DateColumn: "date",
+		Sortable:   map[string]string{"id": "id", "date": "date"},
+	}, &result)
 	return
 }
 
@@ -39,11 +39,23 @@ func (r InventoryListRepo) Find(where *InventoryListModel) (result *[]InventoryL
 	return
 }
 
+func (r InventoryListRepo) FindPage(where *InventoryListModel, opts *ListOptions) (result *[]InventoryListModel, total int64, err error) {
+	total, err = findPage(r.db, where, opts, &listSpec{
+		TimeColumn: "created_at",
+		Sortable:   map[string]string{"id": "id", "loss_price": "loss_price"},
+	}, &result)
+	return
+}
+
 func (r InventoryListRepo) FindFirts(where *InventoryListModel) (result *InventoryListModel, err error) {
 	err = r.db.Where(where).First(&result).Error
 	return
 }
 
+func (r *InventoryListRepo) UpdatesFull(where *InventoryListModel, updatedFields *map[string]interface{}) error {
+	return r.db.Model(where).Where(where).Updates(updatedFields).Error
+}
+
 func (r *InventoryListRepo) Updates(where *InventoryListModel, updatedFields *InventoryListModel) error {
 	return r.db.Where(where).Updates(updatedFields).Error
 }
@@ -0,0 +1,250 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+)
+
+//ModifierGroupModel - группа модификаторов продукта (размер, молоко, добавки).
+//Привязывается к продукту или ко всем продуктам категории
+type ModifierGroupModel struct {
+	ID        uint
+	DeletedAt gorm.DeletedAt
+
+	Name        string
+	MultiSelect bool // можно выбрать несколько опций
+	MinSelect   int  // сколько опций нужно выбрать минимум (0 - группа необязательная)
+	MaxSelect   int  // сколько опций можно выбрать максимум (0 - без ограничений)
+
+	ProductID  uint `gorm:"default:NULL"`
+	CategoryID uint `gorm:"default:NULL"`
+	OutletID   uint
+	OrgID      uint
+
+	ProductModel      ProductModel      `gorm:"foreignKey:ProductID"`
+	CategoryModel     CategoryModel     `gorm:"foreignKey:CategoryID"`
+	OutletModel       OutletModel       `gorm:"foreignKey:OutletID"`
+	OrganizationModel OrganizationModel `gorm:"foreignKey:OrgID"`
+}
+
+//ModifierOptionModel - опция группы модификаторов
+type ModifierOptionModel struct {
+	ID        uint
+	DeletedAt gorm.DeletedAt
+
+	Name       string
+	PriceDelta float64 // надбавка к цене продукта (может быть отрицательной)
+
+	ModifierGroupID uint
+	OutletID        uint
+	OrgID           uint
+
+	ModifierGroupModel ModifierGroupModel `gorm:"foreignKey:ModifierGroupID"`
+	OutletModel        OutletModel        `gorm:"foreignKey:OutletID"`
+	OrganizationModel  OrganizationModel  `gorm:"foreignKey:OrgID"`
+}
+
+//ModifierOptionIngredientModel - расход ингредиента опцией (на единицу продукта)
+type ModifierOptionIngredientModel struct {
+	ID uint
+
+	Count float64 // в единицах хранения ингредиента
+
+	ModifierOptionID uint `gorm:"index"`
+	IngredientID     uint
+	OutletID         uint
+	OrgID            uint
+
+	ModifierOptionModel ModifierOptionModel `gorm:"foreignKey:ModifierOptionID"`
+	IngredientModel     IngredientModel     `gorm:"foreignKey:IngredientID"`
+	OutletModel         OutletModel         `gorm:"foreignKey:OutletID"`
+	OrganizationModel   OrganizationModel   `gorm:"foreignKey:OrgID"`
+}
+
+//OrderListModifierModel - опция, выбранная в позиции заказа. Название и цена фиксируются на момент продажи
+type OrderListModifierModel struct {
+	ID uint
+
+	Name       string
+	PriceDelta float64
+	CostPrice  float64 // себестоимость опции на момент продажи
+
+	ModifierOptionID uint
+	OrderListID      uint `gorm:"index"`
+	OutletID         uint
+	OrgID            uint
+
+	ModifierOptionModel ModifierOptionModel `gorm:"foreignKey:ModifierOptionID"`
+	OrderListModel      OrderListModel      `gorm:"foreignKey:OrderListID"`
+	OutletModel         OutletModel         `gorm:"foreignKey:OutletID"`
+	OrganizationModel   OrganizationModel   `gorm:"foreignKey:OrgID"`
+}
+
+//ModifierOptionUnitCost - себестоимость опции по ее ингредиентам
+type ModifierOptionUnitCost struct {
+	ModifierOptionID uint
+	Cost             float64
+}
+
+type ModifiersRepo struct {
+	db *gorm.DB
+}
+
+func newModifiersRepo(db *gorm.DB) *ModifiersRepo {
+	return &ModifiersRepo{
+		db: db,
+	}
+}
+
+func (r *ModifiersRepo) CreateGroup(m *ModifierGroupModel) error {
+	return r.db.Create(m).Error
+}
+
+func (r *ModifiersRepo) FindGroups(where *ModifierGroupModel) (result *[]ModifierGroupModel, err error) {
+	err = r.db.Where(where).Order("id").Find(&result).Error
+	return
+}
+
+//FindProductGroups - группы модификаторов продукта: его собственные и группы его категории
+func (r *ModifiersRepo) FindProductGroups(product *ProductModel) (result *[]ModifierGroupModel, err error) {
+	db := r.db.Where(&ModifierGroupModel{OutletID: product.OutletID})
+	if product.CategoryID != 0 {
+		db = db.Where("`product_id` = ? OR `category_id` = ?", product.ID, product.CategoryID)
+	} else {
+		db = db.Where("`product_id` = ?", product.ID)
+	}
+
+	err = db.Order("id").Find(&result).Error
+	return
+}
+
+func (r *ModifiersRepo) FindFirstGroup(where *ModifierGroupModel) (result *ModifierGroupModel, err error) {
+	err = r.db.Where(where).First(&result).Error
+	return
+}
+
+func (r *ModifiersRepo) UpdatesGroup(where *ModifierGroupModel, updatedFields *map[string]interface{}) error {
+	return r.db.Model(where).Where(where).Updates(updatedFields).Error
+}
+
+//DeleteGroup - удаляет группу вместе с ее опциями
+func (r *ModifiersRepo) DeleteGroup(where *ModifierGroupModel) error {
+	var group ModifierGroupModel
+	if err := r.db.Select("id").Where(where).First(&group).Error; err != nil {
+		return err
+	}
+
+	if err := r.db.Where(&ModifierOptionModel{ModifierGroupID: group.ID}).Delete(&ModifierOptionModel{}).Error; err != nil {
+		return err
+	}
+	return r.db.Delete(&group).Error
+}
+
+func (r *ModifiersRepo) CreateOption(m *ModifierOptionModel) error {
+	return r.db.Create(m).Error
+}
+
+func (r *ModifiersRepo) FindOptions(where *ModifierOptionModel) (result *[]ModifierOptionModel, err error) {
+	err = r.db.Where(where).Order("id").Find(&result).Error
+	return
+}
+
+//FindOptionsByGroups - опции групп groupIDs
+func (r *ModifiersRepo) FindOptionsByGroups(groupIDs []uint) (result *[]ModifierOptionModel, err error) {
+	err = r.db.Where("`modifier_group_id` IN ?", groupIDs).Order("id").Find(&result).Error
+	return
+}
+
+func (r *ModifiersRepo) FindFirstOption(where *ModifierOptionModel) (result *ModifierOptionModel, err error) {
+	err = r.db.Where(where).First(&result).Error
+	return
+}
+
+func (r *ModifiersRepo) UpdatesOption(where *ModifierOptionModel, updatedFields *map[string]interface{}) error {
+	return r.db.Model(where).Where(where).Updates(updatedFields).Error
+}
+
+func (r *ModifiersRepo) DeleteOption(where *ModifierOptionModel) error {
+	return r.db.Where(where).Delete(&ModifierOptionModel{}).Error
+}
+
+func (r *ModifiersRepo) CreateOptionIngredient(m *ModifierOptionIngredientModel) error {
+	return r.db.Create(m).Error
+}
+
+//FindOptionIngredients - ингредиенты опций optionIDs
+func (r *ModifiersRepo) FindOptionIngredients(optionIDs []uint) (result *[]ModifierOptionIngredientModel, err error) {
+	err = r.db.Where("`modifier_option_id` IN ?", optionIDs).Order("id").Find(&result).Error
+	return
+}
+
+func (r *ModifiersRepo) DeleteOptionIngredients(where *ModifierOptionIngredientModel) error {
+	return r.db.Where(where).Delete(&ModifierOptionIngredientModel{}).Error
+}
+
+//OptionUnitCosts - себестоимость опций optionIDs по их ингредиентам (кол-во ингредиента * закупочная цена).
+//Опции без ингредиентов в результат не попадают
+func (r *ModifiersRepo) OptionUnitCosts(optionIDs []uint) (result []ModifierOptionUnitCost, err error) {
+	err = r.db.Model(&ModifierOptionIngredientModel{}).
+		Select("`modifier_option_ingredient_models`.`modifier_option_id`, SUM(`modifier_option_ingredient_models`.`count` * `i`.`purchase_price`) AS `cost`").
+		Joins("JOIN `ingredient_models` AS `i` ON `i`.`id` = `modifier_option_ingredient_models`.`ingredient_id`").
+		Where("`modifier_option_ingredient_models`.`modifier_option_id` IN ?", optionIDs).
+		Group("`modifier_option_ingredient_models`.`modifier_option_id`").
+		Scan(&result).Error
+	return
+}
+
+//CreateLineModifiers - сохраняет опции, выбранные в позиции заказа
+func (r *ModifiersRepo) CreateLineModifiers(modifiers []OrderListModifierModel) error {
+	if len(modifiers) == 0 {
+		return nil
+	}
+	return r.db.Create(&modifiers).Error
+}
+
+//FindLineModifiers - опции, выбранные в позициях заказа orderListIDs
+func (r *ModifiersRepo) FindLineModifiers(orderListIDs []uint) (result *[]OrderListModifierModel, err error) {
+	err = r.db.Where("`order_list_id` IN ?", orderListIDs).Order("id").Find(&result).Error
+	return
+}
+
+//SubtractOptionIngredients - списывает ингредиенты опции на count единиц продукта и записывает движения в журнал.
+//Возвращает списания с остатками после них (для проверки политики остатков)
+func (r *ModifiersRepo) SubtractOptionIngredients(optionID uint, count int, move StockMovementModel) (deductions []StockDeduction, err error) {
+	var items []ModifierOptionIngredientModel
+	if err = r.db.Where(&ModifierOptionIngredientModel{ModifierOptionID: optionID}).Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	deductions = make([]StockDeduction, 0, len(items))
+	for _, item := range items {
+		n := item.Count * float64(count)
+
+		ingredient, err := addIngredientCount(r.db, item.IngredientID, -n, move)
+		if err != nil {
+			return nil, err
+		}
+
+		deductions = append(deductions, StockDeduction{
+			IngredientID: ingredient.ID,
+			Name:         ingredient.Name,
+			Count:        n,
+			Balance:      ingredient.Count,
+		})
+	}
+	return
+}
+
+//AddOptionIngredients - возвращает ингредиенты опции на count единиц продукта и записывает движения в журнал
+func (r *ModifiersRepo) AddOptionIngredients(optionID uint, count int, move StockMovementModel) error {
+	var items []ModifierOptionIngredientModel
+	if err := r.db.Where(&ModifierOptionIngredientModel{ModifierOptionID: optionID}).Find(&items).Error; err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if _, err := addIngredientCount(r.db, item.IngredientID, item.Count*float64(count), move); err != nil {
+			return err
+		}
+	}
+	return nil
+}
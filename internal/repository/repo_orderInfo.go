@@ -1,6 +1,10 @@
 package repository
 
-import "gorm.io/gorm"
+import (
+	"database/sql"
+
+	"gorm.io/gorm"
+)
 
 type OrderInfoModel struct {
 	gorm.Model
@@ -10,6 +14,10 @@ type OrderInfoModel struct {
 	EmployeeName string
 	SessionID    uint
 
+	Subtotal  float64 `gorm:"default:0"` // сумма позиций по ценам каталога
+	Total     float64 `gorm:"default:0"` // сумма позиций по ценам продажи (с учетом изменения цены управляющим)
+	LineCount int     `gorm:"default:0"` // кол-во позиций (orderList) в заказе
+
 	OrgID    uint
 	OutletID uint
 
@@ -19,6 +27,13 @@ type OrderInfoModel struct {
 	OutletModel       OutletModel       `gorm:"foreignKey:OutletID"`
 }
 
+//OrderInfoPayTypeTotal - кол-во и сумма заказов с одним типом оплаты
+type OrderInfoPayTypeTotal struct {
+	PayType int
+	Count   int
+	Total   float64
+}
+
 type OrderInfoRepo struct {
 	db *gorm.DB
 }
@@ -44,6 +59,15 @@ func (r OrderInfoRepo) FindUnscoped(where *OrderInfoModel) (result *[]OrderInfoM
 	return
 }
 
+//FindPageUnscoped - страница заказов, включая удаленные
+func (r OrderInfoRepo) FindPageUnscoped(where *OrderInfoModel, opts *ListOptions) (result *[]OrderInfoModel, total int64, err error) {
+	total, err = findPage(r.db.Unscoped(), where, opts, &listSpec{
+		DateColumn: "date",
+		Sortable:   map[string]string{"id": "id", "date": "date", "total": "total"},
+	}, &result)
+	return
+}
+
 func (r OrderInfoRepo) FindFirst(where *OrderInfoModel) (result *OrderInfoModel, err error) {
 	err = r.db.Where(where).Find(&result).Error
 	return
@@ -58,11 +82,27 @@ func (r *OrderInfoRepo) Updates(where *OrderInfoModel, updatedFields *OrderInfoM
 	return r.db.Where(where).Updates(updatedFields).Error
 }
 
+func (r *OrderInfoRepo) UpdatesFull(where *OrderInfoModel, updatedFields *map[string]interface{}) error {
+	return r.db.Model(where).Where(where).Updates(updatedFields).Error
+}
+
 func (r *OrderInfoRepo) Delete(where *OrderInfoModel) (err error) {
 	err = r.db.Where(where).Delete(&OrderInfoModel{}).Error
 	return
 }
 
+//DeleteOnce - удаляет заказ, если он еще не удален. ok - заказ был удален этим вызовом
+func (r *OrderInfoRepo) DeleteOnce(where *OrderInfoModel) (ok bool, err error) {
+	res := r.db.Where(where).Delete(&OrderInfoModel{})
+	return res.RowsAffected != 0, res.Error
+}
+
+//RecoveryOnce - восстанавливает заказ, если он удален. ok - заказ был восстановлен этим вызовом
+func (r *OrderInfoRepo) RecoveryOnce(where *OrderInfoModel) (ok bool, err error) {
+	res := r.db.Model(&OrderInfoModel{}).Unscoped().Where(where).Where("`deleted_at` IS NOT NULL").UpdateColumn("deleted_at", nil)
+	return res.RowsAffected != 0, res.Error
+}
+
 func (r *OrderInfoRepo) Exists(where *OrderInfoModel) bool {
 	return r.db.Select("id").Where(where).First(&OrderInfoModel{}).Error == nil
 }
@@ -76,7 +116,49 @@ func (r *OrderInfoRepo) Recovery(where *OrderInfoModel) (err error) {
 	return
 }
 
+//AddToTotals - атомарно добавляет позицию к итогам заказа
+func (r *OrderInfoRepo) AddToTotals(orderInfoID uint, subtotal float64, total float64) error {
+	return r.db.Exec("UPDATE `order_info_models` SET `subtotal` = `subtotal` + @subtotal, `total` = `total` + @total, `line_count` = `line_count` + 1 WHERE `id` = @id",
+		sql.Named("subtotal", subtotal),
+		sql.Named("total", total),
+		sql.Named("id", orderInfoID),
+	).Error
+}
+
+//backfillTotals - считает итоги для заказов, созданных до появления полей subtotal, total и line_count
+func (r *OrderInfoRepo) backfillTotals() error {
+	return r.db.Exec("UPDATE `order_info_models` AS `oi` " +
+		"JOIN (SELECT `order_info_id`, SUM(`product_price` * `count`) AS `total`, COUNT(*) AS `line_count` FROM `order_list_models` WHERE `deleted_at` IS NULL GROUP BY `order_info_id`) AS `ol` ON `ol`.`order_info_id` = `oi`.`id` " +
+		"SET `oi`.`subtotal` = `ol`.`total`, `oi`.`total` = `ol`.`total`, `oi`.`line_count` = `ol`.`line_count` " +
+		"WHERE `oi`.`line_count` = 0",
+	).Error
+}
+
 func (r *OrderInfoRepo) Count(where *OrderInfoModel) (n int64, err error) {
 	err = r.db.Model(where).Where(where).Count(&n).Error
 	return
 }
+
+//SumByPayType - кол-во и сумма неудаленных заказов сессии по типам оплаты
+func (r *OrderInfoRepo) SumByPayType(sessionID uint) (result []OrderInfoPayTypeTotal, err error) {
+	err = r.db.Model(&OrderInfoModel{}).
+		Select("`pay_type`, COUNT(*) AS `count`, COALESCE(SUM(`total`), 0) AS `total`").
+		Where("`session_id` = ?", sessionID).
+		Group("`pay_type`").
+		Scan(&result).Error
+	return
+}
+
+//SumDeleted - кол-во и сумма удаленных (возвращенных) заказов сессии
+func (r *OrderInfoRepo) SumDeleted(sessionID uint) (count int, total float64, err error) {
+	var result struct {
+		Count int
+		Total float64
+	}
+
+	err = r.db.Unscoped().Model(&OrderInfoModel{}).
+		Select("COUNT(*) AS `count`, COALESCE(SUM(`total`), 0) AS `total`").
+		Where("`session_id` = ? AND `deleted_at` IS NOT NULL", sessionID).
+		Scan(&result).Error
+	return result.Count, result.Total, err
+}
@@ -6,7 +6,9 @@ type OrderListModel struct {
 	gorm.Model
 	ProductName string
 
-	ProductPrice float64
+	ProductPrice float64 // цена продажи
+	CatalogPrice float64 // цена продукта в каталоге на момент продажи
+	CostPrice    float64 `gorm:"default:0"` // себестоимость единицы продукта на момент продажи
 	Count        int
 
 	ProductID   uint
@@ -24,6 +26,14 @@ type OrderListModel struct {
 	OrganizationModel OrganizationModel `gorm:"foreignKey:OrgID"`
 }
 
+//OrderListProductTotal - кол-во и сумма продаж одного продукта
+type OrderListProductTotal struct {
+	ProductID   uint
+	ProductName string
+	Count       int
+	Total       float64
+}
+
 type OrderListRepo struct {
 	db *gorm.DB
 }
@@ -44,13 +54,23 @@ func (r *OrderListRepo) Find(where *OrderListModel) (result *[]OrderListModel, e
 	return
 }
 
+//FindPageUnscoped - страница позиций заказов, включая удаленные
+func (r *OrderListRepo) FindPageUnscoped(where *OrderListModel, opts *ListOptions) (result *[]OrderListModel, total int64, err error) {
+	total, err = findPage(r.db.Unscoped(), where, opts, &listSpec{
+		TimeColumn: "created_at",
+		Sortable:   map[string]string{"id": "id", "count": "count", "product_price": "product_price"},
+	}, &result)
+	return
+}
+
 func (r *OrderListRepo) FindUnscoped(where *OrderListModel) (result *[]OrderListModel, err error) {
 	err = r.db.Unscoped().Where(where).Find(&result).Error
 	return
 }
 
-func (r *OrderListRepo) FindForCalculation(where *OrderListModel) (result *[]OrderListModel, err error) {
-	err = r.db.Select("product_price, count").Where(where).Find(&result).Error
+//SumTotal - сумма продаж (product_price * count) по позициям
+func (r *OrderListRepo) SumTotal(where *OrderListModel) (total float64, err error) {
+	err = r.db.Model(&OrderListModel{}).Select("COALESCE(SUM(`product_price` * `count`), 0)").Where(where).Scan(&total).Error
 	return
 }
 
@@ -67,3 +87,27 @@ func (r *OrderListRepo) Recovery(where *OrderListModel) (err error) {
 	err = r.db.Model(&OrderListModel{}).Unscoped().Where(where).UpdateColumn("deleted_at", nil).Error
 	return
 }
+
+//TopProducts - самые продаваемые (по кол-ву) продукты сессии
+func (r *OrderListRepo) TopProducts(sessionID uint, limit int) (result []OrderListProductTotal, err error) {
+	err = r.db.Model(&OrderListModel{}).
+		Select("`product_id`, MAX(`product_name`) AS `product_name`, SUM(`count`) AS `count`, SUM(`product_price` * `count`) AS `total`").
+		Where("`session_id` = ?", sessionID).
+		Group("`product_id`").
+		Order("`count` DESC, `total` DESC").
+		Limit(limit).
+		Scan(&result).Error
+	return
+}
+
+//backfillCost - себестоимость для позиций, проданных до появления поля cost_price (по текущим рецептам).
+//Себестоимость, сохраненная при продаже, не перезаписывается, поэтому повторный запуск безопасен
+func (r *OrderListRepo) backfillCost() error {
+	return r.db.Exec("UPDATE `order_list_models` AS `ol` " +
+		"JOIN (SELECT `pwi`.`product_id`, SUM(`pwi`.`count_take_for_sell` * `i`.`purchase_price`) AS `cost` " +
+		"FROM `product_with_ingredient_models` AS `pwi` JOIN `ingredient_models` AS `i` ON `i`.`id` = `pwi`.`ingredient_id` " +
+		"WHERE `pwi`.`deleted_at` IS NULL GROUP BY `pwi`.`product_id`) AS `pc` ON `pc`.`product_id` = `ol`.`product_id` " +
+		"SET `ol`.`cost_price` = `pc`.`cost` " +
+		"WHERE `ol`.`cost_price` = 0",
+	).Error
+}
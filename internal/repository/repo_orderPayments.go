@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"database/sql"
+
+	"gorm.io/gorm"
+)
+
+//способы оплаты
+const (
+	PAYMENT_CASH      = 0 // наличные
+	PAYMENT_CARD      = 1 // банковская карта
+	PAYMENT_TRANSFER  = 2 // перевод
+	PAYMENT_GIFT_CARD = 3 // подарочная карта
+)
+
+//OrderPaymentModel - часть оплаты заказа (для смешанной оплаты у заказа несколько записей)
+type OrderPaymentModel struct {
+	ID uint
+
+	Type        int     // способ оплаты [0 - наличные, 1 - карта, 2 - перевод, 3 - подарочная карта]
+	Amount      float64 // сколько внесено
+	ChangeGiven float64 `gorm:"default:0"` // сдача (только для наличных)
+
+	OrderInfoID uint `gorm:"index"`
+	SessionID   uint
+	OutletID    uint
+	OrgID       uint
+
+	OrderInfoModel    OrderInfoModel    `gorm:"foreignKey:OrderInfoID"`
+	SessionModel      SessionModel      `gorm:"foreignKey:SessionID"`
+	OutletModel       OutletModel       `gorm:"foreignKey:OutletID"`
+	OrganizationModel OrganizationModel `gorm:"foreignKey:OrgID"`
+}
+
+type OrderPaymentsRepo struct {
+	db *gorm.DB
+}
+
+func newOrderPaymentsRepo(db *gorm.DB) *OrderPaymentsRepo {
+	return &OrderPaymentsRepo{
+		db: db,
+	}
+}
+
+func (r *OrderPaymentsRepo) Create(m *OrderPaymentModel) error {
+	return r.db.Create(m).Error
+}
+
+func (r *OrderPaymentsRepo) Find(where *OrderPaymentModel) (result *[]OrderPaymentModel, err error) {
+	err = r.db.Where(where).Find(&result).Error
+	return
+}
+
+func (r *OrderPaymentsRepo) Delete(where *OrderPaymentModel) (err error) {
+	err = r.db.Where(where).Delete(&OrderPaymentModel{}).Error
+	return
+}
+
+//SumForSession - выручка сессии наличными и безналичными по неудаленным заказам.
+//Для заказов без записей об оплате сумма берется из pay_type заказа (0 - наличные, 1 - безналичные).
+//Разбивка смешанных заказов без записей об оплате неизвестна, их сумма возвращается отдельно (unallocated)
+func (r *OrderPaymentsRepo) SumForSession(sessionID uint) (cash float64, bank float64, unallocated float64, err error) {
+	var paid struct {
+		Cash float64
+		Bank float64
+	}
+
+	if err = r.db.Raw("SELECT "+
+		"COALESCE(SUM(CASE WHEN `p`.`type` = @cash THEN `p`.`amount` - `p`.`change_given` ELSE 0 END), 0) AS `cash`, "+
+		"COALESCE(SUM(CASE WHEN `p`.`type` <> @cash THEN `p`.`amount` ELSE 0 END), 0) AS `bank` "+
+		"FROM `order_payment_models` AS `p` JOIN `order_info_models` AS `oi` ON `oi`.`id` = `p`.`order_info_id` "+
+		"WHERE `oi`.`session_id` = @session AND `oi`.`deleted_at` IS NULL",
+		sql.Named("cash", PAYMENT_CASH),
+		sql.Named("session", sessionID),
+	).Scan(&paid).Error; err != nil {
+		return
+	}
+
+	var unpaid struct {
+		Cash  float64
+		Bank  float64
+		Mixed float64
+	}
+
+	if err = r.db.Raw("SELECT "+
+		"COALESCE(SUM(CASE WHEN `oi`.`pay_type` = 0 THEN `oi`.`total` ELSE 0 END), 0) AS `cash`, "+
+		"COALESCE(SUM(CASE WHEN `oi`.`pay_type` = 1 THEN `oi`.`total` ELSE 0 END), 0) AS `bank`, "+
+		"COALESCE(SUM(CASE WHEN `oi`.`pay_type` = 2 THEN `oi`.`total` ELSE 0 END), 0) AS `mixed` "+
+		"FROM `order_info_models` AS `oi` "+
+		"WHERE `oi`.`session_id` = @session AND `oi`.`deleted_at` IS NULL "+
+		"AND NOT EXISTS (SELECT 1 FROM `order_payment_models` AS `p` WHERE `p`.`order_info_id` = `oi`.`id`)",
+		sql.Named("session", sessionID),
+	).Scan(&unpaid).Error; err != nil {
+		return
+	}
+
+	return paid.Cash + unpaid.Cash, paid.Bank + unpaid.Bank, unpaid.Mixed, nil
+}
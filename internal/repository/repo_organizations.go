@@ -3,10 +3,14 @@ package repository
 import (
 	"time"
 
+	"github.com/iivkis/pos.7-era.backend/internal/config"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+//минимальный интервал между письмами с кодом подтверждения email
+const EmailConfirmResendInterval = time.Minute
+
 type OrganizationsRepo struct {
 	db *gorm.DB
 }
@@ -19,7 +23,16 @@ type OrganizationModel struct {
 	Email    string `gorm:"index:,unique"`
 	Password string
 
-	EmailConfirmed bool
+	EmailConfirmed       bool
+	EmailConfirmDeadline int64  `gorm:"default:0"` // до какого момента можно входить без подтверждения email (unixmilli)
+	PendingEmail         string `gorm:"size:100"`  // новый email, ожидающий подтверждения
+	ConfirmCodeSentAt    int64  `gorm:"default:0"` // когда отправлено последнее письмо с кодом подтверждения (unixmilli)
+	StockPolicy          int    `gorm:"default:0"` // политика отрицательных остатков для точек [0, 1 - разрешить, 2 - предупредить, 3 - запретить]
+}
+
+//EmailConfirmOverdue - истек ли срок, в течение которого организация может входить без подтверждения email
+func (m *OrganizationModel) EmailConfirmOverdue() bool {
+	return !m.EmailConfirmed && m.EmailConfirmDeadline < time.Now().UTC().UnixMilli()
 }
 
 func (r *OrganizationsRepo) generatePasswordHash(pwd string) ([]byte, error) {
@@ -38,6 +51,7 @@ func (r *OrganizationsRepo) Create(m *OrganizationModel) error {
 		return err
 	}
 	m.Password = string(pwd)
+	m.EmailConfirmDeadline = time.Now().Add(config.Settings.EmailConfirmGrace).UTC().UnixMilli()
 
 	return r.db.Create(m).Error
 }
@@ -47,6 +61,10 @@ func (r *OrganizationsRepo) FindFirts(where *OrganizationModel) (result *Organiz
 	return
 }
 
+func (r *OrganizationsRepo) UpdatesFull(where *OrganizationModel, updatedFields *map[string]interface{}) error {
+	return r.db.Model(where).Where(where).Updates(updatedFields).Error
+}
+
 func (r *OrganizationsRepo) SetPassword(orgID interface{}, password string) error {
 	pwd, err := r.generatePasswordHash(password)
 	if err != nil {
@@ -59,6 +77,54 @@ func (r *OrganizationsRepo) SetConfirmEmail(email string, val bool) error {
 	return r.db.Model(&OrganizationModel{}).Where("email = ?", email).Update("email_confirmed", val).Error
 }
 
+//ConfirmEmail - подтверждает email организации. Если подтвержден ожидающий email, то он становится основным
+func (r *OrganizationsRepo) ConfirmEmail(org *OrganizationModel, email string) error {
+	if email == org.PendingEmail {
+		return r.db.Model(&OrganizationModel{}).Where("id = ? AND pending_email = ?", org.ID, email).Updates(map[string]interface{}{
+			"email":           email,
+			"pending_email":   "",
+			"email_confirmed": true,
+		}).Error
+	}
+	return r.db.Model(&OrganizationModel{}).Where("id = ? AND email = ?", org.ID, email).Update("email_confirmed", true).Error
+}
+
+//SetPendingEmail - сохраняет новый email, который заменит текущий после подтверждения
+func (r *OrganizationsRepo) SetPendingEmail(orgID uint, email string) error {
+	return r.db.Model(&OrganizationModel{}).Where("id = ?", orgID).Update("pending_email", email).Error
+}
+
+//TouchConfirmCodeSent - отмечает отправку письма с кодом подтверждения.
+//Если предыдущее письмо отправлено меньше EmailConfirmResendInterval назад, то возвращает, сколько нужно подождать
+func (r *OrganizationsRepo) TouchConfirmCodeSent(orgID uint) (time.Duration, error) {
+	now := time.Now().UTC().UnixMilli()
+	since := now - EmailConfirmResendInterval.Milliseconds()
+
+	tx := r.db.Model(&OrganizationModel{}).
+		Where("id = ? AND confirm_code_sent_at <= ?", orgID, since).
+		UpdateColumn("confirm_code_sent_at", now)
+	if tx.Error != nil || tx.RowsAffected == 1 {
+		return 0, tx.Error
+	}
+
+	var org OrganizationModel
+	if err := r.db.Select("confirm_code_sent_at").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return 0, err
+	}
+
+	if wait := org.ConfirmCodeSentAt - since; wait > 0 {
+		return time.Duration(wait) * time.Millisecond, nil
+	}
+	return time.Millisecond, nil
+}
+
+//backfillConfirmDeadline - организациям, зарегистрированным до появления проверки email, срок на подтверждение дается с момента обновления
+func (r *OrganizationsRepo) backfillConfirmDeadline() error {
+	return r.db.Model(&OrganizationModel{}).
+		Where("email_confirmed = ? AND email_confirm_deadline = 0", false).
+		UpdateColumn("email_confirm_deadline", time.Now().Add(config.Settings.EmailConfirmGrace).UTC().UnixMilli()).Error
+}
+
 func (r *OrganizationsRepo) EmailExists(email string) bool {
 	return r.db.Select("id").Where(&OrganizationModel{Email: email}).First(&OrganizationModel{}).Error == nil
 }
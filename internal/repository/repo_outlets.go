@@ -5,8 +5,9 @@ import "gorm.io/gorm"
 type OutletModel struct {
 	gorm.Model
 
-	Name  string
-	OrgID uint
+	Name        string
+	StockPolicy int `gorm:"default:0"` // политика отрицательных остатков [0 - как у организации, 1 - разрешить, 2 - предупредить, 3 - запретить]
+	OrgID       uint
 
 	OrganizationModel OrganizationModel `gorm:"foreignKey:OrgID"`
 }
@@ -30,6 +31,10 @@ func (r *OutletsRepo) Updates(where *OutletModel, updatedFields *OutletModel) er
 	return r.db.Where(where).Updates(updatedFields).Error
 }
 
+func (r *OutletsRepo) UpdatesFull(where *OutletModel, updatedFields *map[string]interface{}) error {
+	return r.db.Model(where).Where(where).Updates(updatedFields).Error
+}
+
 func (r *OutletsRepo) Delete(where *OutletModel) error {
 	return r.db.Where(where).Delete(&OutletModel{}).Error
 }
@@ -46,3 +51,17 @@ func (r *OutletsRepo) Exists(where *OutletModel) bool {
 func (r *OutletsRepo) ExistsInOrg(outletID uint, orgID uint) bool {
 	return r.db.Select("id").Where("id = ? AND org_id = ?", outletID, orgID).First(&OutletModel{}).Error == nil
 }
+
+//StockPolicy - политика отрицательных остатков точки (если у точки не задана, то берется у организации)
+func (r *OutletsRepo) StockPolicy(outletID uint) (policy int, err error) {
+	err = r.db.Model(&OutletModel{}).
+		Select("COALESCE(NULLIF(`outlet_models`.`stock_policy`, 0), `o`.`stock_policy`, 0)").
+		Joins("JOIN `organization_models` AS `o` ON `o`.`id` = `outlet_models`.`org_id`").
+		Where("`outlet_models`.`id` = ?", outletID).
+		Scan(&policy).Error
+
+	if policy == STOCK_POLICY_DEFAULT {
+		policy = STOCK_POLICY_ALLOW
+	}
+	return
+}
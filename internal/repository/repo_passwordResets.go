@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/iivkis/pos.7-era.backend/internal/config"
+	"gorm.io/gorm"
+)
+
+//ограничения сброса пароля организации
+const (
+	PasswordResetTTL       = time.Hour   // срок действия токена сброса
+	PasswordResetInterval  = time.Minute // минимальный интервал между письмами на один email
+	PasswordResetRetention = time.Hour * 24 * 7
+)
+
+//PasswordResetModel - запрос на сброс пароля организации. Токен из письма подписан strcode,
+//а на сервере хранится только хеш его случайной части. Использованный токен повторно не принимается
+type PasswordResetModel struct {
+	ID uint
+
+	TokenHash string `gorm:"size:64;uniqueIndex"` // sha256 случайной части токена
+	ExpiresIn int64  // истекает в (unixmilli)
+	UsedAt    int64  `gorm:"default:0"` // использован в (unixmilli), 0 - не использован
+	CreatedAt int64  `gorm:"index"`     // unixmilli
+	IP        string `gorm:"size:45"`
+
+	OrgID uint `gorm:"index"`
+
+	OrganizationModel OrganizationModel `gorm:"foreignKey:OrgID"`
+}
+
+type PasswordResetsRepo struct {
+	db *gorm.DB
+}
+
+func newPasswordResetsRepo(db *gorm.DB) *PasswordResetsRepo {
+	r := &PasswordResetsRepo{
+		db: db,
+	}
+
+	if *config.Flags.Main {
+		go func() {
+			for {
+				r.DeleteExpired()
+				time.Sleep(time.Hour)
+			}
+		}()
+	}
+
+	return r
+}
+
+//Create - создает запрос на сброс со сроком действия PasswordResetTTL
+func (r *PasswordResetsRepo) Create(m *PasswordResetModel) error {
+	now := time.Now().UTC()
+	m.CreatedAt = now.UnixMilli()
+	m.ExpiresIn = now.Add(PasswordResetTTL).UnixMilli()
+	return r.db.Create(m).Error
+}
+
+//RequestedRecently - отправлялось ли письмо для сброса пароля организации за последние PasswordResetInterval
+func (r *PasswordResetsRepo) RequestedRecently(orgID uint) bool {
+	return r.db.Select("id").
+		Where(&PasswordResetModel{OrgID: orgID}).
+		Where("`created_at` > ?", time.Now().Add(-PasswordResetInterval).UTC().UnixMilli()).
+		First(&PasswordResetModel{}).Error == nil
+}
+
+//Use - помечает токен использованным и возвращает запрос на сброс.
+//Возвращает gorm.ErrRecordNotFound, если токен неизвестен, истек или уже использован (в т.ч. параллельным запросом)
+func (r *PasswordResetsRepo) Use(tokenHash string) (result *PasswordResetModel, err error) {
+	now := time.Now().UTC().UnixMilli()
+
+	err = r.db.Where(&PasswordResetModel{TokenHash: tokenHash}).
+		Where("`used_at` = 0 AND `expires_in` > ?", now).
+		First(&result).Error
+	if err != nil {
+		return nil, err
+	}
+
+	tx := r.db.Model(&PasswordResetModel{}).
+		Where("`id` = ? AND `used_at` = 0", result.ID).
+		UpdateColumn("used_at", now)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	if tx.RowsAffected != 1 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return result, nil
+}
+
+//Invalidate - делает недействительными все неиспользованные токены организации (после смены пароля)
+func (r *PasswordResetsRepo) Invalidate(orgID uint) error {
+	return r.db.Model(&PasswordResetModel{}).
+		Where(&PasswordResetModel{OrgID: orgID}).
+		Where("`used_at` = 0").
+		UpdateColumn("used_at", time.Now().UTC().UnixMilli()).Error
+}
+
+//DeleteExpired - удаляет запросы на сброс, истекшие раньше срока хранения
+func (r *PasswordResetsRepo) DeleteExpired() error {
+	return r.db.Where("`expires_in` < ?", time.Now().Add(-PasswordResetRetention).UTC().UnixMilli()).Delete(&PasswordResetModel{}).Error
+}
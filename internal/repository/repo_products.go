@@ -14,7 +14,8 @@ type ProductModel struct {
 	Price        float64
 	PhotoCloudID string //key in selectel
 
-	SellerPercent float64 `gorm:"default:0"` //процент продавца с продажи товара
+	SellerPercent float64 `gorm:"default:0"`     //процент продавца с продажи товара
+	IsBundle      bool    `gorm:"default:false"` //комплект (комбо) из других продуктов, см. BundleComponentModel
 
 	CategoryID uint `gorm:"default:NULL"`
 	OutletID   uint
@@ -1,8 +1,6 @@
 package repository
 
 import (
-	"database/sql"
-
 	"gorm.io/gorm"
 )
 
@@ -24,6 +22,12 @@ type ProductWithIngredientModel struct {
 	OrganizationModel OrganizationModel `gorm:"foreignKey:OrgID"`
 }
 
+//ProductUnitCost - себестоимость единицы продукта по рецепту
+type ProductUnitCost struct {
+	ProductID uint
+	Cost      float64
+}
+
 type ProductsWithIngredientsRepo struct {
 	db *gorm.DB
 }
@@ -44,6 +48,11 @@ func (r *ProductsWithIngredientsRepo) Find(where *ProductWithIngredientModel) (r
 	return
 }
 
+func (r *ProductsWithIngredientsRepo) FindFirst(where *ProductWithIngredientModel) (result *ProductWithIngredientModel, err error) {
+	err = r.db.Where(where).First(&result).Error
+	return
+}
+
 func (r *ProductsWithIngredientsRepo) Updates(where *ProductWithIngredientModel, updatedFields *ProductWithIngredientModel) error {
 	return r.db.Where(where).Updates(updatedFields).Error
 }
@@ -53,26 +62,38 @@ func (r *ProductsWithIngredientsRepo) Delete(where *ProductWithIngredientModel)
 	return
 }
 
-func (r *ProductsWithIngredientsRepo) SubractionIngredients(productID uint, count int) (err error) {
+//SubractionIngredients - списывает остатки ингредиентов по рецепту продукта и записывает движения в журнал.
+//move - причина, документ и сотрудник. Возвращает списания с остатками после них (для проверки политики остатков)
+func (r *ProductsWithIngredientsRepo) SubractionIngredients(productID uint, count int, move StockMovementModel) (deductions []StockDeduction, err error) {
 	//находим связи с ингредиентами, для продукта
 	var pwiList []ProductWithIngredientModel
 	if err = r.db.Where(&ProductWithIngredientModel{ProductID: productID}).Find(&pwiList).Error; err != nil {
-		return err
+		return nil, err
 	}
 
 	//для каждой связи ищем ингредиент. Отнимаем нужное кол-во ингредиента
+	deductions = make([]StockDeduction, 0, len(pwiList))
 	for _, pwi := range pwiList {
-		if err := r.db.Exec("UPDATE `ingredient_models` SET `count` = `count` - @n WHERE `id` = @id",
-			sql.Named("n", pwi.CountTakeForSell*float64(count)),
-			sql.Named("id", pwi.IngredientID),
-		).Error; err != nil {
-			return err
+		n := pwi.CountTakeForSell * float64(count)
+
+		ingredient, err := addIngredientCount(r.db, pwi.IngredientID, -n, move)
+		if err != nil {
+			return nil, err
 		}
+
+		deductions = append(deductions, StockDeduction{
+			IngredientID: ingredient.ID,
+			Name:         ingredient.Name,
+			Count:        n,
+			Balance:      ingredient.Count,
+		})
 	}
 	return
 }
 
-func (r *ProductsWithIngredientsRepo) AdditionIngredients(productID uint, count int) (err error) {
+//AdditionIngredients - возвращает остатки ингредиентов по рецепту продукта и записывает движения в журнал.
+//move - причина, документ и сотрудник
+func (r *ProductsWithIngredientsRepo) AdditionIngredients(productID uint, count int, move StockMovementModel) (err error) {
 	//находим связи с ингредиентами, для продукта
 	var pwiList []ProductWithIngredientModel
 	if err = r.db.Where(&ProductWithIngredientModel{ProductID: productID}).Find(&pwiList).Error; err != nil {
@@ -81,12 +102,30 @@ func (r *ProductsWithIngredientsRepo) AdditionIngredients(productID uint, count
 
 	//для каждой связи ищем ингредиент. Прибавляем нужное кол-во ингредиента
 	for _, pwi := range pwiList {
-		if err := r.db.Exec("UPDATE `ingredient_models` SET `count` = `count` + @n WHERE `id` = @id",
-			sql.Named("n", pwi.CountTakeForSell*float64(count)),
-			sql.Named("id", pwi.IngredientID),
-		).Error; err != nil {
+		if _, err := addIngredientCount(r.db, pwi.IngredientID, pwi.CountTakeForSell*float64(count), move); err != nil {
 			return err
 		}
 	}
 	return
 }
+
+//UnitCosts - себестоимость единицы продуктов по рецептам (кол-во ингредиента * закупочная цена).
+//Продукты без рецепта в результат не попадают
+func (r *ProductsWithIngredientsRepo) UnitCosts(where *ProductWithIngredientModel) (result []ProductUnitCost, err error) {
+	err = r.db.Model(&ProductWithIngredientModel{}).
+		Select("`product_with_ingredient_models`.`product_id`, SUM(`product_with_ingredient_models`.`count_take_for_sell` * `i`.`purchase_price`) AS `cost`").
+		Joins("JOIN `ingredient_models` AS `i` ON `i`.`id` = `product_with_ingredient_models`.`ingredient_id`").
+		Where(where).
+		Group("`product_with_ingredient_models`.`product_id`").
+		Scan(&result).Error
+	return
+}
+
+//UnitCost - себестоимость единицы продукта по рецепту
+func (r *ProductsWithIngredientsRepo) UnitCost(productID uint) (cost float64, err error) {
+	costs, err := r.UnitCosts(&ProductWithIngredientModel{ProductID: productID})
+	if err != nil || len(costs) == 0 {
+		return 0, err
+	}
+	return costs[0].Cost, nil
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"database/sql"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//статусы заказа поставщику
+const (
+	PO_DRAFT              = 1 // черновик, позиции можно менять
+	PO_SENT               = 2 // отправлен поставщику
+	PO_PARTIALLY_RECEIVED = 3 // получена часть позиций
+	PO_RECEIVED           = 4 // получен полностью
+	PO_CANCELLED          = 5 // отменен
+)
+
+//PurchaseOrderModel - заказ ингредиентов у поставщика
+type PurchaseOrderModel struct {
+	ID uint
+
+	Status  int     // статус [1 - черновик, 2 - отправлен, 3 - получен частично, 4 - получен, 5 - отменен]
+	Total   float64 // ожидаемая сумма заказа
+	Comment string
+
+	Date int64 //unixmilli, дата создания
+
+	SupplierID uint
+	EmployeeID uint // сотрудник, создавший заказ
+	OutletID   uint
+	OrgID      uint
+
+	SupplierModel     SupplierModel     `gorm:"foreignKey:SupplierID"`
+	EmployeeModel     EmployeeModel     `gorm:"foreignKey:EmployeeID"`
+	OutletModel       OutletModel       `gorm:"foreignKey:OutletID"`
+	OrganizationModel OrganizationModel `gorm:"foreignKey:OrgID"`
+}
+
+//PurchaseOrderLineModel - ожидаемая позиция заказа поставщику
+type PurchaseOrderLineModel struct {
+	ID uint
+
+	Count         float64 // сколько заказано
+	Price         float64 // ожидаемая цена за единицу
+	ReceivedCount float64 `gorm:"default:0"` // сколько уже получено
+
+	PurchaseOrderID uint `gorm:"index"`
+	IngredientID    uint
+
+	PurchaseOrderModel PurchaseOrderModel `gorm:"foreignKey:PurchaseOrderID"`
+	IngredientModel    IngredientModel    `gorm:"foreignKey:IngredientID"`
+}
+
+type PurchaseOrdersRepo struct {
+	db *gorm.DB
+}
+
+func newPurchaseOrdersRepo(db *gorm.DB) *PurchaseOrdersRepo {
+	return &PurchaseOrdersRepo{
+		db: db,
+	}
+}
+
+func (r *PurchaseOrdersRepo) Create(m *PurchaseOrderModel) error {
+	return r.db.Create(m).Error
+}
+
+func (r *PurchaseOrdersRepo) FindFirst(where *PurchaseOrderModel) (result *PurchaseOrderModel, err error) {
+	err = r.db.Where(where).First(&result).Error
+	return
+}
+
+func (r *PurchaseOrdersRepo) FindPage(where *PurchaseOrderModel, opts *ListOptions) (result *[]PurchaseOrderModel, total int64, err error) {
+	total, err = findPage(r.db, where, opts, &listSpec{
+		DateColumn: "date",
+		Sortable:   map[string]string{"id": "id", "date": "date", "total": "total", "status": "status"},
+	}, &result)
+	return
+}
+
+func (r *PurchaseOrdersRepo) UpdatesFull(where *PurchaseOrderModel, updatedFields *map[string]interface{}) error {
+	return r.db.Model(where).Where(where).Updates(updatedFields).Error
+}
+
+//SetStatus - меняет статус заказа, если его текущий статус один из from.
+//Возвращает false, если заказ не найден или его статус уже другой
+func (r *PurchaseOrdersRepo) SetStatus(id uint, status int, from ...int) (ok bool, err error) {
+	res := r.db.Model(&PurchaseOrderModel{}).Where("`id` = ? AND `status` IN ?", id, from).Update("status", status)
+	return res.RowsAffected != 0, res.Error
+}
+
+//LockStatus - статус заказа с блокировкой строки до конца транзакции (чтобы статус не изменился одновременно)
+func (r *PurchaseOrdersRepo) LockStatus(id uint) (status int, err error) {
+	var order PurchaseOrderModel
+	err = r.db.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").First(&order, id).Error
+	return order.Status, err
+}
+
+func (r *PurchaseOrdersRepo) CreateLine(m *PurchaseOrderLineModel) error {
+	return r.db.Create(m).Error
+}
+
+func (r *PurchaseOrdersRepo) FindLines(where *PurchaseOrderLineModel) (result *[]PurchaseOrderLineModel, err error) {
+	err = r.db.Where(where).Order("id").Find(&result).Error
+	return
+}
+
+func (r *PurchaseOrdersRepo) DeleteLines(where *PurchaseOrderLineModel) error {
+	return r.db.Where(where).Delete(&PurchaseOrderLineModel{}).Error
+}
+
+//AddReceived - атомарно увеличивает полученное кол-во позиции
+func (r *PurchaseOrdersRepo) AddReceived(lineID uint, count float64) error {
+	return r.db.Exec("UPDATE `purchase_order_line_models` SET `received_count` = `received_count` + @n WHERE `id` = @id",
+		sql.Named("n", count),
+		sql.Named("id", lineID),
+	).Error
+}
+
+//FullyReceived - получены ли все позиции заказа полностью
+func (r *PurchaseOrdersRepo) FullyReceived(orderID uint) (bool, error) {
+	var pending int64
+	err := r.db.Model(&PurchaseOrderLineModel{}).
+		Where("`purchase_order_id` = ? AND `received_count` < `count`", orderID).
+		Count(&pending).Error
+	return pending == 0, err
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+)
+
+//SessionReportModel - Z-отчет, формируется при закрытии сессии и после этого не изменяется
+type SessionReportModel struct {
+	ID uint
+
+	CashOpen         float64 //наличные в кассе при открытии сессии
+	CashSales        float64 //выручка наличными (за вычетом сдачи)
+	BankSales        float64 //выручка безналичными
+	UnallocatedSales float64 `gorm:"default:0"` //смешанные заказы без записей об оплате: разбивка неизвестна, в CashExpected не входят
+	CashDeposits     float64 //внесения денежных средств (cashChanges)
+	CashWithdrawals  float64 //снятия денежных средств (cashChanges)
+	CashExpected     float64 //ожидаемая сумма в кассе: CashOpen + CashSales + CashDeposits - CashWithdrawals
+	CashCounted      float64 //посчитанная сумма в кассе при закрытии
+	CashDiscrepancy  float64 //расхождение: CashCounted - CashExpected
+
+	TotalCash  float64 //сумма заказов с pay_type 0 (наличные)
+	TotalBank  float64 //сумма заказов с pay_type 1 (безналичные)
+	TotalMixed float64 //сумма заказов с pay_type 2 (смешанный)
+
+	NumberOfReceipts int     //кол-во чеков
+	DeletedReceipts  int     //кол-во удаленных (возвращенных) чеков
+	DeletedTotal     float64 //сумма удаленных (возвращенных) чеков
+
+	TopProducts string `gorm:"type:text"` //самые продаваемые продукты (json)
+
+	DateOpen  int64 //unixmilli
+	DateClose int64 //unixmilli
+
+	SessionID  uint `gorm:"uniqueIndex"`
+	EmployeeID uint
+	OutletID   uint `gorm:"index"`
+	OrgID      uint
+
+	SessionModel      SessionModel      `gorm:"foreignKey:SessionID"`
+	EmployeeModel     EmployeeModel     `gorm:"foreignKey:EmployeeID"`
+	OutletModel       OutletModel       `gorm:"foreignKey:OutletID"`
+	OrganizationModel OrganizationModel `gorm:"foreignKey:OrgID"`
+}
+
+type SessionReportsRepo struct {
+	db *gorm.DB
+}
+
+func newSessionReportsRepo(db *gorm.DB) *SessionReportsRepo {
+	return &SessionReportsRepo{
+		db: db,
+	}
+}
+
+func (r *SessionReportsRepo) Create(m *SessionReportModel) error {
+	return r.db.Create(m).Error
+}
+
+func (r *SessionReportsRepo) FindFirst(where *SessionReportModel) (result *SessionReportModel, err error) {
+	err = r.db.Where(where).First(&result).Error
+	return
+}
@@ -76,6 +76,12 @@ func (r *SessionsRepo) GetLastOpenByEmployeeID(employeeID interface{}) (model Se
 	return
 }
 
+//Возвращает последнюю открытую сессию для точки продаж
+func (r *SessionsRepo) GetLastOpenForOutlet(outletID uint) (model SessionModel, err error) {
+	err = r.db.Where("outlet_id = ? AND date_close = 0", outletID).Last(&model).Error
+	return
+}
+
 //Возвращает последнюю закрытую сессию для точки продаж
 func (r *SessionsRepo) GetLastClosedForOutlet(outletID uint) (model SessionModel, err error) {
 	err = r.db.Where("outlet_id = ? AND date_close <> 0", outletID).Last(&model).Error
@@ -123,12 +129,11 @@ func (r *SessionsRepo) FindFirts(where *SessionModel) (result SessionModel, err
 	return
 }
 
-func (r *SessionsRepo) FindWithPeriod(dateStart uint64, dateEnd uint64, where *SessionModel) (result *[]SessionModel, err error) {
-	if dateEnd <= 0 {
-		err = r.db.Where("date_open >= ?", dateStart).Find(&result, where).Error
-		return
-	}
-	err = r.db.Where("date_open >= ? AND date_open <= ?", dateStart, dateEnd).Find(&result, where).Error
+func (r *SessionsRepo) FindPage(where *SessionModel, opts *ListOptions) (result *[]SessionModel, total int64, err error) {
+	total, err = findPage(r.db, where, opts, &listSpec{
+		DateColumn: "date_open",
+		Sortable:   map[string]string{"id": "id", "date_open": "date_open", "date_close": "date_close"},
+	}, &result)
 	return
 }
 
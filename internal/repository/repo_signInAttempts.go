@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/iivkis/pos.7-era.backend/internal/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//виды входа для учета неудачных попыток
+const (
+	SIGN_IN_ORG      = 1 // вход организации (email и пароль)
+	SIGN_IN_EMPLOYEE = 2 // вход сотрудника (id и пин-код)
+)
+
+//SignInLimit - ограничение неудачных попыток входа по одному ключу (сотрудник, организация, email, ip).
+//Первые Free попыток без задержки, дальше перед каждой попыткой нужно ждать 1, 2, 4... секунд (не больше MaxDelay).
+//После Max неудачных попыток ключ блокируется на Lockout. Счетчик сбрасывается, если попыток не было дольше Window
+type SignInLimit struct {
+	Free     int
+	Max      int
+	MaxDelay time.Duration
+	Window   time.Duration
+	Lockout  time.Duration
+}
+
+//ограничения входа
+var (
+	SignInLimitEmployee = &SignInLimit{Free: 3, Max: 10, MaxDelay: time.Minute, Window: time.Minute * 15, Lockout: time.Minute * 15}  // пин-код сотрудника
+	SignInLimitOrgPins  = &SignInLimit{Free: 10, Max: 50, MaxDelay: time.Minute, Window: time.Minute * 15, Lockout: time.Minute * 15} // все пин-коды организации
+	SignInLimitEmail    = &SignInLimit{Free: 5, Max: 10, MaxDelay: time.Minute, Window: time.Minute * 15, Lockout: time.Minute * 30}  // пароль организации по email
+	SignInLimitIP       = &SignInLimit{Free: 20, Max: 50, MaxDelay: time.Minute, Window: time.Minute * 15, Lockout: time.Minute * 30} // вход организации с одного ip
+)
+
+//сколько хранится журнал неудачных попыток
+const SignInAttemptRetention = time.Hour * 24 * 90
+
+//SignInAttemptModel - неудачная попытка входа (журнал)
+type SignInAttemptModel struct {
+	ID uint
+
+	Kind      int    // вид входа [1 - организация, 2 - сотрудник]
+	Login     string `gorm:"size:100"` // email или id сотрудника
+	Reason    string `gorm:"size:50"`  // причина отказа (неверные данные, блокировка)
+	IP        string `gorm:"size:45"`
+	UserAgent string `gorm:"size:255"`
+	Date      int64  `gorm:"index"` // unixmilli
+
+	EmployeeID uint `gorm:"default:NULL"`
+	OrgID      uint `gorm:"index;default:NULL"`
+
+	EmployeeModel     EmployeeModel     `gorm:"foreignKey:EmployeeID"`
+	OrganizationModel OrganizationModel `gorm:"foreignKey:OrgID"`
+}
+
+//SignInLockModel - счетчик неудачных попыток входа по ключу
+type SignInLockModel struct {
+	ID uint
+
+	Key           string `gorm:"size:150;uniqueIndex"`
+	Failures      int
+	LastFailureAt int64 // unixmilli
+	LockedUntil   int64 `gorm:"default:0"` // unixmilli, 0 - нет блокировки
+}
+
+type SignInAttemptsRepo struct {
+	db *gorm.DB
+}
+
+func newSignInAttemptsRepo(db *gorm.DB) *SignInAttemptsRepo {
+	r := &SignInAttemptsRepo{
+		db: db,
+	}
+
+	if *config.Flags.Main {
+		go func() {
+			for {
+				r.DeleteExpired()
+				time.Sleep(time.Hour)
+			}
+		}()
+	}
+
+	return r
+}
+
+//Reserve - атомарно проверяет ограничение по ключу key и, если попытка сейчас разрешена, заранее учитывает ее как неудачную:
+//параллельные попытки видят ее еще до проверки пароля. Возвращает, сколько нужно ждать до следующей попытки
+//(0 - попытка учтена). После успешного входа попытка возвращается через Reset или Release
+func (r *SignInAttemptsRepo) Reserve(key string, limit *SignInLimit) (wait time.Duration, err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		//строка счетчика создается заранее, чтобы ее можно было заблокировать
+		if err := tx.Clauses(clause.Insert{Modifier: "IGNORE"}).Create(&SignInLockModel{Key: key}).Error; err != nil {
+			return err
+		}
+
+		var lock SignInLockModel
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(&SignInLockModel{Key: key}).First(&lock).Error; err != nil {
+			return err
+		}
+
+		now := time.Now().UTC().UnixMilli()
+		if wait = signInWait(&lock, limit, now); wait > 0 {
+			return nil
+		}
+
+		//mysql выполняет присваивания слева направо, поэтому `locked_until` считается по новому `failures`
+		return tx.Exec("UPDATE `sign_in_lock_models` SET "+
+			"`failures` = IF(`last_failure_at` < @window_start AND `locked_until` < @now, 1, `failures` + 1), "+
+			"`last_failure_at` = @now, "+
+			"`locked_until` = IF(`failures` >= @max, @locked_until, `locked_until`) "+
+			"WHERE `id` = @id",
+			sql.Named("id", lock.ID),
+			sql.Named("now", now),
+			sql.Named("window_start", now-limit.Window.Milliseconds()),
+			sql.Named("max", limit.Max),
+			sql.Named("locked_until", now+limit.Lockout.Milliseconds()),
+		).Error
+	})
+	return
+}
+
+//Release - возвращает попытку, учтенную Reserve, если она оказалась успешной (для ключей, которые не сбрасываются при входе).
+//Блокировка, которую вызвала только эта попытка, снимается
+func (r *SignInAttemptsRepo) Release(key string, limit *SignInLimit) error {
+	return r.db.Exec("UPDATE `sign_in_lock_models` SET "+
+		"`failures` = GREATEST(`failures` - 1, 0), "+
+		"`locked_until` = IF(`failures` < @max, 0, `locked_until`) "+
+		"WHERE `key` = @key",
+		sql.Named("key", key),
+		sql.Named("max", limit.Max),
+	).Error
+}
+
+//signInWait - сколько нужно ждать до следующей попытки входа по счетчику lock (0 - можно пробовать сейчас)
+func signInWait(lock *SignInLockModel, limit *SignInLimit, now int64) time.Duration {
+	if lock.LockedUntil > now {
+		return time.Duration(lock.LockedUntil-now) * time.Millisecond
+	}
+
+	//счетчик устарел
+	if lock.LastFailureAt < now-limit.Window.Milliseconds() || lock.Failures < limit.Free {
+		return 0
+	}
+
+	//прогрессивная задержка: 1, 2, 4... секунд
+	delay := limit.MaxDelay
+	if n := lock.Failures - limit.Free; n < 16 {
+		if d := time.Second << n; d < delay {
+			delay = d
+		}
+	}
+
+	if wait := lock.LastFailureAt + delay.Milliseconds() - now; wait > 0 {
+		return time.Duration(wait) * time.Millisecond
+	}
+	return 0
+}
+
+//Reset - сбрасывает счетчик неудачных попыток по ключу key (после успешного входа)
+func (r *SignInAttemptsRepo) Reset(key string) error {
+	return r.db.Where(&SignInLockModel{Key: key}).Delete(&SignInLockModel{}).Error
+}
+
+//Audit - записывает неудачную попытку в журнал
+func (r *SignInAttemptsRepo) Audit(m *SignInAttemptModel) error {
+	m.Date = time.Now().UTC().UnixMilli()
+	return r.db.Create(m).Error
+}
+
+func (r *SignInAttemptsRepo) FindPage(where *SignInAttemptModel, opts *ListOptions) (result *[]SignInAttemptModel, total int64, err error) {
+	total, err = findPage(r.db, where, opts, &listSpec{
+		DateColumn: "date",
+		Sortable:   map[string]string{"id": "id", "date": "date"},
+	}, &result)
+	return
+}
+
+//DeleteExpired - удаляет старые записи журнала и устаревшие счетчики
+func (r *SignInAttemptsRepo) DeleteExpired() error {
+	now := time.Now().UTC()
+	if err := r.db.Where("`date` < ?", now.Add(-SignInAttemptRetention).UnixMilli()).Delete(&SignInAttemptModel{}).Error; err != nil {
+		return err
+	}
+	return r.db.Where("`locked_until` < ? AND `last_failure_at` < ?", now.UnixMilli(), now.Add(-time.Hour*24).UnixMilli()).Delete(&SignInLockModel{}).Error
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//StockAlertModel - уведомление о том, что остаток ингредиента упал ниже минимального или стал отрицательным.
+//Создается в транзакции изменения остатка и отправляется фоновой задачей
+type StockAlertModel struct {
+	ID uint
+
+	Count    float64 // остаток после изменения
+	MinCount float64 // минимальный остаток ингредиента на момент изменения
+	Negative bool    // остаток стал отрицательным
+
+	Date   int64 //unixmilli
+	SentAt int64 `gorm:"default:0;index"` //unixmilli (0 - еще не отправлено)
+
+	Attempts      int   `gorm:"default:0"` // кол-во неудачных попыток отправки
+	NextAttemptAt int64 `gorm:"default:0"` // следующая попытка не раньше (unixmilli)
+
+	IngredientID uint
+	OutletID     uint
+	OrgID        uint
+
+	IngredientModel   IngredientModel   `gorm:"foreignKey:IngredientID"`
+	OutletModel       OutletModel       `gorm:"foreignKey:OutletID"`
+	OrganizationModel OrganizationModel `gorm:"foreignKey:OrgID"`
+}
+
+//повторная отправка уведомлений, если письмо не отправилось: через 1, 2, 4... минут, не больше суток.
+//После StockAlertMaxAttempts неудачных попыток уведомление больше не отправляется
+const (
+	StockAlertMaxAttempts = 12
+	StockAlertMaxBackoff  = time.Hour * 24
+)
+
+type StockAlertsRepo struct {
+	db *gorm.DB
+}
+
+func newStockAlertsRepo(db *gorm.DB) *StockAlertsRepo {
+	return &StockAlertsRepo{
+		db: db,
+	}
+}
+
+func (r *StockAlertsRepo) Create(m *StockAlertModel) error {
+	return r.db.Create(m).Error
+}
+
+//FindNotSent - неотправленные уведомления (с ингредиентом и точкой), время повторной попытки которых наступило, не больше limit
+func (r *StockAlertsRepo) FindNotSent(limit int) (result *[]StockAlertModel, err error) {
+	unscoped := func(db *gorm.DB) *gorm.DB { return db.Unscoped() }
+
+	err = r.db.Preload("IngredientModel", unscoped).Preload("OutletModel", unscoped).
+		Where("`sent_at` = 0 AND `attempts` < ? AND `next_attempt_at` <= ?", StockAlertMaxAttempts, time.Now().UTC().UnixMilli()).
+		Order("id").
+		Limit(limit).
+		Find(&result).Error
+	return
+}
+
+//SetSent - отмечает уведомления отправленными
+func (r *StockAlertsRepo) SetSent(ids []uint) error {
+	return r.db.Model(&StockAlertModel{}).Where("`id` IN ?", ids).Update("sent_at", time.Now().UTC().UnixMilli()).Error
+}
+
+//SetFailed - учитывает неудачную попытку отправки и откладывает следующую (1, 2, 4... минут, не больше StockAlertMaxBackoff)
+func (r *StockAlertsRepo) SetFailed(ids []uint) error {
+	return r.db.Exec("UPDATE `stock_alert_models` SET "+
+		"`next_attempt_at` = @now + LEAST(@step * POW(2, `attempts`), @max_backoff), "+
+		"`attempts` = `attempts` + 1 "+
+		"WHERE `id` IN @ids",
+		sql.Named("now", time.Now().UTC().UnixMilli()),
+		sql.Named("step", time.Minute.Milliseconds()),
+		sql.Named("max_backoff", StockAlertMaxBackoff.Milliseconds()),
+		sql.Named("ids", ids),
+	).Error
+}
+
+//checkStockAlert - создает уведомление, если изменение остатка на delta опустило его ниже минимального или в минус.
+//Повторно, пока остаток не поднимется обратно, уведомление не создается
+func checkStockAlert(db *gorm.DB, ingredient *IngredientModel, delta float64, date int64) error {
+	if delta >= 0 {
+		return nil
+	}
+
+	before := ingredient.Count - delta
+	belowMin := ingredient.MinCount > 0 && ingredient.Count < ingredient.MinCount && before >= ingredient.MinCount
+	negative := ingredient.Count < 0 && before >= 0
+
+	if !belowMin && !negative {
+		return nil
+	}
+
+	return db.Create(&StockAlertModel{
+		Count:        ingredient.Count,
+		MinCount:     ingredient.MinCount,
+		Negative:     ingredient.Count < 0,
+		Date:         date,
+		IngredientID: ingredient.ID,
+		OutletID:     ingredient.OutletID,
+		OrgID:        ingredient.OrgID,
+	}).Error
+}
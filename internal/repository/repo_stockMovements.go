@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//причины движения остатков ингредиентов
+const (
+	STOCK_MOVE_SALE        = 1 // продажа
+	STOCK_MOVE_REFUND      = 2 // возврат (удаление чека)
+	STOCK_MOVE_ARRIVAL     = 3 // поступление
+	STOCK_MOVE_WRITE_OFF   = 4 // списание (порча, бой)
+	STOCK_MOVE_STOCKTAKE   = 5 // инвентаризация
+	STOCK_MOVE_MANUAL      = 6 // ручное изменение остатка
+	STOCK_MOVE_OPENING     = 7 // начальный остаток (создание ингредиента или появление журнала)
+	STOCK_MOVE_UNIT_CHANGE = 8 // пересчет остатка при смене единицы хранения
+)
+
+//StockMovementModel - запись журнала движения остатков ингредиента. Записи только добавляются
+type StockMovementModel struct {
+	ID uint
+
+	Reason   int     // причина [1 - продажа, 2 - возврат, 3 - поступление, 4 - списание, 5 - инвентаризация, 6 - ручное изменение, 7 - начальный остаток, 8 - смена единицы]
+	SourceID uint    // id документа-основания (чек, поступление, инвентаризация, ингредиент)
+	Delta    float64 // изменение остатка
+	Balance  float64 // остаток после изменения
+
+	Date int64 `gorm:"index"` //unixmilli
+
+	IngredientID uint `gorm:"index"`
+	EmployeeID   uint // 0 - изменение сделано системой
+	OutletID     uint
+	OrgID        uint
+
+	IngredientModel   IngredientModel   `gorm:"foreignKey:IngredientID"`
+	OutletModel       OutletModel       `gorm:"foreignKey:OutletID"`
+	OrganizationModel OrganizationModel `gorm:"foreignKey:OrgID"`
+}
+
+type StockMovementsRepo struct {
+	db *gorm.DB
+}
+
+func newStockMovementsRepo(db *gorm.DB) *StockMovementsRepo {
+	return &StockMovementsRepo{
+		db: db,
+	}
+}
+
+func (r *StockMovementsRepo) Create(m *StockMovementModel) error {
+	return r.db.Create(m).Error
+}
+
+func (r *StockMovementsRepo) FindPage(where *StockMovementModel, opts *ListOptions) (result *[]StockMovementModel, total int64, err error) {
+	total, err = findPage(r.db, where, opts, &listSpec{
+		DateColumn: "date",
+		Sortable:   map[string]string{"id": "id", "date": "date", "delta": "delta"},
+	}, &result)
+	return
+}
+
+//BalanceAt - остаток ингредиента на момент date (unixmilli), восстановленный по журналу.
+//count - кол-во учтенных записей журнала
+func (r *StockMovementsRepo) BalanceAt(ingredientID uint, date int64) (balance float64, count int64, err error) {
+	var result struct {
+		Balance float64
+		Count   int64
+	}
+
+	err = r.db.Model(&StockMovementModel{}).
+		Select("COALESCE(SUM(`delta`), 0) AS `balance`, COUNT(*) AS `count`").
+		Where(&StockMovementModel{IngredientID: ingredientID}).
+		Where(clause.Lte{Column: "date", Value: date}).
+		Scan(&result).Error
+	return result.Balance, result.Count, err
+}
+
+//backfillOpening - записывает в журнал текущие остатки ингредиентов, у которых еще нет движений, как начальные.
+//Вызывается один раз, после создания журнала (повторный запуск ничего не дублирует)
+func (r *StockMovementsRepo) backfillOpening() error {
+	return r.db.Exec("INSERT INTO `stock_movement_models` (`reason`, `source_id`, `delta`, `balance`, `date`, `ingredient_id`, `employee_id`, `outlet_id`, `org_id`) "+
+		"SELECT @reason, `id`, `count`, `count`, @date, `id`, 0, `outlet_id`, `org_id` FROM `ingredient_models` AS `i` WHERE `deleted_at` IS NULL "+
+		"AND NOT EXISTS (SELECT 1 FROM `stock_movement_models` AS `m` WHERE `m`.`ingredient_id` = `i`.`id`)",
+		sql.Named("reason", STOCK_MOVE_OPENING),
+		sql.Named("date", time.Now().UTC().UnixMilli()),
+	).Error
+}
+
+//recordStockMovement - записывает в журнал изменение остатка ингредиента на delta.
+//Вызывается сразу после изменения остатка в той же транзакции: строка ингредиента заблокирована, поэтому прочитанный остаток - результат именно этого изменения.
+//Если остаток упал ниже минимального, то создается уведомление.
+//move - причина, документ и сотрудник; остальные поля заполняются здесь.
+//Возвращает ингредиент с остатком после изменения
+func recordStockMovement(db *gorm.DB, ingredientID uint, delta float64, move StockMovementModel) (*IngredientModel, error) {
+	var ingredient IngredientModel
+	if err := db.Unscoped().Select("id", "name", "count", "min_count", "outlet_id", "org_id").First(&ingredient, ingredientID).Error; err != nil {
+		return nil, err
+	}
+
+	move.ID = 0
+	move.Delta = delta
+	move.Balance = ingredient.Count
+	move.IngredientID = ingredient.ID
+	move.OutletID = ingredient.OutletID
+	move.OrgID = ingredient.OrgID
+
+	if move.Date == 0 {
+		move.Date = time.Now().UTC().UnixMilli()
+	}
+
+	if err := db.Create(&move).Error; err != nil {
+		return nil, err
+	}
+	return &ingredient, checkStockAlert(db, &ingredient, delta, move.Date)
+}
@@ -0,0 +1,50 @@
+package repository
+
+import "gorm.io/gorm"
+
+//SupplierModel - поставщик ингредиентов (общий для всех точек организации)
+type SupplierModel struct {
+	ID        uint
+	DeletedAt gorm.DeletedAt
+
+	Name    string
+	Phone   string
+	Email   string
+	Comment string
+
+	OrgID uint
+
+	OrganizationModel OrganizationModel `gorm:"foreignKey:OrgID"`
+}
+
+type SuppliersRepo struct {
+	db *gorm.DB
+}
+
+func newSuppliersRepo(db *gorm.DB) *SuppliersRepo {
+	return &SuppliersRepo{
+		db: db,
+	}
+}
+
+func (r *SuppliersRepo) Create(m *SupplierModel) error {
+	return r.db.Create(m).Error
+}
+
+func (r *SuppliersRepo) Find(where *SupplierModel) (result *[]SupplierModel, err error) {
+	err = r.db.Where(where).Find(&result).Error
+	return
+}
+
+func (r *SuppliersRepo) UpdatesFull(where *SupplierModel, updatedFields *map[string]interface{}) error {
+	return r.db.Model(where).Where(where).Updates(updatedFields).Error
+}
+
+func (r *SuppliersRepo) Delete(where *SupplierModel) (err error) {
+	err = r.db.Where(where).Delete(&SupplierModel{}).Error
+	return
+}
+
+func (r *SuppliersRepo) Exists(where *SupplierModel) bool {
+	return r.db.Select("id").Where(where).First(&SupplierModel{}).Error == nil
+}
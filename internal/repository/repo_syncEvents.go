@@ -0,0 +1,66 @@
+package repository
+
+import "gorm.io/gorm"
+
+//типы событий, которые касса может передать при синхронизации
+const (
+	SYNC_SESSION_OPEN  = "session_open"
+	SYNC_SESSION_CLOSE = "session_close"
+	SYNC_ORDER         = "order"
+	SYNC_CASH_CHANGE   = "cash_change"
+)
+
+//SyncEventModel - событие, созданное кассой в офлайне и примененное на сервере.
+//По UUID повторно переданные события определяются как дубликаты
+type SyncEventModel struct {
+	ID uint
+
+	UUID string `gorm:"size:36;uniqueIndex:idx_sync_org_uuid"` // генерируется на кассе
+	Type string `gorm:"size:20"`
+
+	ClientDate int64 // когда событие было создано на кассе (unixmilli)
+	SyncDate   int64 // когда событие было применено на сервере (unixmilli)
+	EntityID   uint  // id созданной записи (сессия, orderInfo, cashChanges), 0 - событие не применено (только у старых записей)
+
+	EmployeeID uint
+	OutletID   uint
+	OrgID      uint `gorm:"uniqueIndex:idx_sync_org_uuid"`
+
+	EmployeeModel     EmployeeModel     `gorm:"foreignKey:EmployeeID"`
+	OutletModel       OutletModel       `gorm:"foreignKey:OutletID"`
+	OrganizationModel OrganizationModel `gorm:"foreignKey:OrgID"`
+}
+
+type SyncEventsRepo struct {
+	db *gorm.DB
+}
+
+func newSyncEventsRepo(db *gorm.DB) *SyncEventsRepo {
+	return &SyncEventsRepo{
+		db: db,
+	}
+}
+
+//Create - резервирует UUID события (в транзакции применения). Если событие с таким UUID уже есть в организации, то вернется ошибка БД о дубликате
+func (r *SyncEventsRepo) Create(m *SyncEventModel) error {
+	return r.db.Create(m).Error
+}
+
+func (r *SyncEventsRepo) FindFirts(where *SyncEventModel) (result *SyncEventModel, err error) {
+	err = r.db.Where(where).First(&result).Error
+	return
+}
+
+func (r *SyncEventsRepo) Updates(where *SyncEventModel, updatedFields *SyncEventModel) error {
+	return r.db.Where(where).Updates(updatedFields).Error
+}
+
+func (r *SyncEventsRepo) Delete(where *SyncEventModel) (err error) {
+	err = r.db.Where(where).Delete(&SyncEventModel{}).Error
+	return
+}
+
+//DeleteNotApplied - удаляет резерв UUID, оставшийся без id созданной записи
+func (r *SyncEventsRepo) DeleteNotApplied(uuid string, orgID uint) error {
+	return r.db.Where("`uuid` = ? AND `org_id` = ? AND `entity_id` = 0", uuid, orgID).Delete(&SyncEventModel{}).Error
+}
@@ -11,6 +11,8 @@ import (
 )
 
 type Repository struct {
+	db *gorm.DB
+
 	Organizations            *OrganizationsRepo
 	Employees                *EmployeesRepo
 	Outlets                  *OutletsRepo
@@ -26,6 +28,22 @@ type Repository struct {
 	InventoryList            *InventoryListRepo
 	IngredientsAddingHistory *IngredientsAddingHistoryRepo
 	Invitation               *InvitationRepo
+	IdempotencyKeys          *IdempotencyKeysRepo
+	SyncEvents               *SyncEventsRepo
+	OrderPayments            *OrderPaymentsRepo
+	SessionReports           *SessionReportsRepo
+	Analytics                *AnalyticsRepo
+	StockMovements           *StockMovementsRepo
+	StockAlerts              *StockAlertsRepo
+	Suppliers                *SuppliersRepo
+	PurchaseOrders           *PurchaseOrdersRepo
+	IngredientPrices         *IngredientPricesRepo
+	InventoryCounts          *InventoryCountsRepo
+	Modifiers                *ModifiersRepo
+	Bundles                  *BundlesRepo
+	AuthSessions             *AuthSessionsRepo
+	SignInAttempts           *SignInAttemptsRepo
+	PasswordResets           *PasswordResetsRepo
 }
 
 func NewRepository(authjwt *authjwt.AuthJWT) *Repository {
@@ -53,13 +71,37 @@ func NewRepository(authjwt *authjwt.AuthJWT) *Repository {
 			&InventoryListModel{},
 			&IngredientsAddingHistoryModel{},
 			&InvitationModel{},
+			&IdempotencyKeyModel{},
+			&SyncEventModel{},
+			&OrderPaymentModel{},
+			&SessionReportModel{},
+			&StockMovementModel{},
+			&StockAlertModel{},
+			&SupplierModel{},
+			&PurchaseOrderModel{},
+			&PurchaseOrderLineModel{},
+			&IngredientPriceModel{},
+			&InventoryCountModel{},
+			&ModifierGroupModel{},
+			&ModifierOptionModel{},
+			&ModifierOptionIngredientModel{},
+			&OrderListModifierModel{},
+			&BundleComponentModel{},
+			&OrderListComponentModel{},
+			&AuthSessionModel{},
+			&SignInAttemptModel{},
+			&SignInLockModel{},
+			&PasswordResetModel{},
+			&MigrationModel{},
 		); err != nil {
 			panic(err)
 		}
 		log.Println("migration done")
 	}
 
-	return &Repository{
+	repo := &Repository{
+		db: db,
+
 		Organizations:            newOrganizationsRepo(db),
 		Employees:                newEmployeesRepo(db),
 		Outlets:                  newOutletsRepo(db),
@@ -75,5 +117,92 @@ func NewRepository(authjwt *authjwt.AuthJWT) *Repository {
 		InventoryList:            newInventoryListRepo(db),
 		IngredientsAddingHistory: newIngredientsAddingHistoryRepo(db),
 		Invitation:               newInvitationRepo(db),
+		IdempotencyKeys:          newIdempotencyKeysRepo(db),
+		SyncEvents:               newSyncEventsRepo(db),
+		OrderPayments:            newOrderPaymentsRepo(db),
+		SessionReports:           newSessionReportsRepo(db),
+		Analytics:                newAnalyticsRepo(db),
+		StockMovements:           newStockMovementsRepo(db),
+		StockAlerts:              newStockAlertsRepo(db),
+		Suppliers:                newSuppliersRepo(db),
+		PurchaseOrders:           newPurchaseOrdersRepo(db),
+		IngredientPrices:         newIngredientPricesRepo(db),
+		InventoryCounts:          newInventoryCountsRepo(db),
+		Modifiers:                newModifiersRepo(db),
+		Bundles:                  newBundlesRepo(db),
+		AuthSessions:             newAuthSessionsRepo(db),
+		SignInAttempts:           newSignInAttemptsRepo(db),
+		PasswordResets:           newPasswordResetsRepo(db),
+	}
+
+	if *config.Flags.Main {
+		//разовые миграции данных: отметка ставится только после успешного выполнения,
+		//поэтому прерванная миграция повторяется при следующем запуске
+		migrations := []struct {
+			Name string
+			Fn   func() error
+		}{
+			{"backfill_order_totals", repo.OrdersInfo.backfillTotals},                       //итоги старых заказов
+			{"backfill_order_list_cost", repo.OrdersList.backfillCost},                      //себестоимость старых позиций
+			{"backfill_stock_opening", repo.StockMovements.backfillOpening},                 //текущие остатки в журнал движения
+			{"backfill_ingredient_prices_opening", repo.IngredientPrices.backfillOpening},   //текущие закупочные цены в историю
+			{"backfill_email_confirm_deadline", repo.Organizations.backfillConfirmDeadline}, //срок на подтверждение email существующим организациям
+			{"rehash_employee_passwords", repo.Employees.rehashPlainPasswords},              //пин-коды сотрудников, сохраненные до хеширования
+		}
+
+		for _, m := range migrations {
+			if err := runOnce(db, m.Name, m.Fn); err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	return repo
+}
+
+//Transaction - выполняет fn внутри одной транзакции.
+//Все репозитории из tx работают в рамках этой транзакции: если fn вернула ошибку, изменения откатываются
+func (r *Repository) Transaction(fn func(tx *Repository) error) error {
+	return r.db.Transaction(func(db *gorm.DB) error {
+		return fn(r.withDB(db))
+	})
+}
+
+//withDB - копия репозитория, привязанная к переданному соединению (например, к транзакции)
+func (r *Repository) withDB(db *gorm.DB) *Repository {
+	return &Repository{
+		db: db,
+
+		Organizations:            &OrganizationsRepo{db: db},
+		Employees:                &EmployeesRepo{db: db},
+		Outlets:                  &OutletsRepo{db: db},
+		Sessions:                 &SessionsRepo{db: db},
+		Categories:               &CategoriesRepo{db: db},
+		Products:                 &ProductsRepo{db: db},
+		Ingredients:              &IngredientsRepo{db: db},
+		OrdersList:               &OrderListRepo{db: db},
+		OrdersInfo:               &OrderInfoRepo{db: db},
+		ProductsWithIngredients:  &ProductsWithIngredientsRepo{db: db},
+		CashChanges:              &CashChangesRepo{db: db},
+		InventoryHistory:         &InventoryHistoryRepo{db: db},
+		InventoryList:            &InventoryListRepo{db: db},
+		IngredientsAddingHistory: &IngredientsAddingHistoryRepo{db: db},
+		Invitation:               &InvitationRepo{db: db, rand: r.Invitation.rand, alphabet: r.Invitation.alphabet},
+		IdempotencyKeys:          &IdempotencyKeysRepo{db: db},
+		SyncEvents:               &SyncEventsRepo{db: db},
+		OrderPayments:            &OrderPaymentsRepo{db: db},
+		SessionReports:           &SessionReportsRepo{db: db},
+		Analytics:                &AnalyticsRepo{db: db},
+		StockMovements:           &StockMovementsRepo{db: db},
+		StockAlerts:              &StockAlertsRepo{db: db},
+		Suppliers:                &SuppliersRepo{db: db},
+		PurchaseOrders:           &PurchaseOrdersRepo{db: db},
+		IngredientPrices:         &IngredientPricesRepo{db: db},
+		InventoryCounts:          &InventoryCountsRepo{db: db},
+		Modifiers:                &ModifiersRepo{db: db},
+		Bundles:                  &BundlesRepo{db: db},
+		AuthSessions:             &AuthSessionsRepo{db: db},
+		SignInAttempts:           &SignInAttemptsRepo{db: db},
+		PasswordResets:           &PasswordResetsRepo{db: db},
 	}
 }
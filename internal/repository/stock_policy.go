@@ -0,0 +1,64 @@
+package repository
+
+import "fmt"
+
+//политика отрицательных остатков при продаже
+const (
+	STOCK_POLICY_DEFAULT = 0 // у точки - как у организации, у организации - разрешить
+	STOCK_POLICY_ALLOW   = 1 // продажа проходит, даже если остаток уходит в минус
+	STOCK_POLICY_WARN    = 2 // продажа проходит, в ответе - ингредиенты, ушедшие в минус
+	STOCK_POLICY_BLOCK   = 3 // продажа отклоняется, если ингредиентов не хватает
+)
+
+//StockDeduction - списание ингредиента при продаже
+type StockDeduction struct {
+	IngredientID uint
+	Name         string
+	Count        float64 // сколько списано
+	Balance      float64 // остаток после списания
+}
+
+//StockShortfall - нехватка ингредиента при продаже
+type StockShortfall struct {
+	IngredientID uint
+	Name         string
+	Required     float64 // сколько нужно списать
+	Available    float64 // остаток до списания
+}
+
+//StockShortfallError - продажа отклонена политикой остатков, потому что ингредиентов не хватает
+type StockShortfallError struct {
+	Shortfalls []StockShortfall
+}
+
+func (e *StockShortfallError) Error() string {
+	return fmt.Sprintf("not enough stock for %d ingredient(s)", len(e.Shortfalls))
+}
+
+//StockShortfalls - ингредиенты, остаток которых после всех списаний отрицательный.
+//Списания одного ингредиента суммируются: Available - остаток до первого списания
+func StockShortfalls(deductions []StockDeduction) (result []StockShortfall) {
+	index := make(map[uint]int)
+	balances := make(map[uint]float64)
+
+	for _, d := range deductions {
+		i, ok := index[d.IngredientID]
+		if !ok {
+			i = len(result)
+			index[d.IngredientID] = i
+			result = append(result, StockShortfall{IngredientID: d.IngredientID, Name: d.Name})
+		}
+		result[i].Required += d.Count
+		balances[d.IngredientID] = d.Balance
+	}
+
+	n := 0
+	for _, s := range result {
+		if balance := balances[s.IngredientID]; balance < 0 {
+			s.Available = balance + s.Required
+			result[n] = s
+			n++
+		}
+	}
+	return result[:n]
+}
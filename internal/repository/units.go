@@ -0,0 +1,101 @@
+package repository
+
+import "fmt"
+
+//единицы измерения
+const (
+	UNIT_KG   = 1 // килограмм
+	UNIT_L    = 2 // литр
+	UNIT_PCS  = 3 // штука
+	UNIT_G    = 4 // грамм
+	UNIT_ML   = 5 // миллилитр
+	UNIT_PACK = 6 // упаковка (размер задается у ингредиента в его единицах)
+)
+
+//величины единиц измерения
+const (
+	DIMENSION_MASS   = 1 // масса, базовая единица - кг
+	DIMENSION_VOLUME = 2 // объем, базовая единица - л
+	DIMENSION_COUNT  = 3 // количество, базовая единица - шт
+)
+
+//Unit - единица измерения
+type Unit struct {
+	ID        int
+	Name      string
+	Dimension int     // величина (0 - зависит от ингредиента, для упаковки)
+	Factor    float64 // сколько базовых единиц величины в одной единице (0 - зависит от ингредиента)
+}
+
+//Units - все единицы измерения. Единица хранения ингредиента - любая, кроме упаковки
+var Units = []Unit{
+	{ID: UNIT_KG, Name: "кг", Dimension: DIMENSION_MASS, Factor: 1},
+	{ID: UNIT_L, Name: "л", Dimension: DIMENSION_VOLUME, Factor: 1},
+	{ID: UNIT_PCS, Name: "шт", Dimension: DIMENSION_COUNT, Factor: 1},
+	{ID: UNIT_G, Name: "г", Dimension: DIMENSION_MASS, Factor: 0.001},
+	{ID: UNIT_ML, Name: "мл", Dimension: DIMENSION_VOLUME, Factor: 0.001},
+	{ID: UNIT_PACK, Name: "упак"},
+}
+
+//FindUnit - единица измерения по id
+func FindUnit(id int) (Unit, bool) {
+	for _, unit := range Units {
+		if unit.ID == id {
+			return unit, true
+		}
+	}
+	return Unit{}, false
+}
+
+//IsStockUnit - можно ли хранить остаток ингредиента в этой единице
+func IsStockUnit(id int) bool {
+	unit, ok := FindUnit(id)
+	return ok && unit.Factor != 0
+}
+
+//ConvertCount - переводит count единиц unit в единицы хранения ингредиента.
+//unit == 0 - кол-во уже в единицах ингредиента.
+//Если единицы разных величин (или у ингредиента не задан размер упаковки), то возвращает ErrIncompatibleUnit
+func ConvertCount(count float64, unit int, ingredient *IngredientModel) (float64, error) {
+	if unit == 0 || unit == ingredient.MeasureUnit {
+		return count, nil
+	}
+
+	if unit == UNIT_PACK {
+		if ingredient.PackSize <= 0 {
+			return 0, fmt.Errorf("%w: pack size of ingredient `%d` is not set", ErrIncompatibleUnit, ingredient.ID)
+		}
+		return count * ingredient.PackSize, nil
+	}
+
+	from, ok := FindUnit(unit)
+	if !ok {
+		return 0, fmt.Errorf("%w: unknown unit `%d`", ErrIncompatibleUnit, unit)
+	}
+
+	to, ok := FindUnit(ingredient.MeasureUnit)
+	if !ok || to.Factor == 0 || from.Dimension != to.Dimension {
+		return 0, fmt.Errorf("%w: unit `%d` can't be converted to unit of ingredient `%d`", ErrIncompatibleUnit, unit, ingredient.ID)
+	}
+	return count * from.Factor / to.Factor, nil
+}
+
+//UnitFactor - во сколько раз кол-во в единицах to больше, чем в единицах from.
+//Если единицы разных величин (или одна из них - упаковка), то возвращает ErrIncompatibleUnit
+func UnitFactor(from int, to int) (float64, error) {
+	fromUnit, ok1 := FindUnit(from)
+	toUnit, ok2 := FindUnit(to)
+	if !ok1 || !ok2 || fromUnit.Factor == 0 || toUnit.Factor == 0 || fromUnit.Dimension != toUnit.Dimension {
+		return 0, fmt.Errorf("%w: unit `%d` can't be converted to unit `%d`", ErrIncompatibleUnit, from, to)
+	}
+	return fromUnit.Factor / toUnit.Factor, nil
+}
+
+//ConvertPrice - переводит цену за единицу unit в цену за единицу хранения ингредиента
+func ConvertPrice(price float64, unit int, ingredient *IngredientModel) (float64, error) {
+	factor, err := ConvertCount(1, unit, ingredient)
+	if err != nil {
+		return 0, err
+	}
+	return price / factor, nil
+}
@@ -1,6 +1,9 @@
 package authjwt
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"time"
 
@@ -9,6 +12,13 @@ import (
 
 var errInvalidToken = errors.New("invalid token")
 
+//время жизни токенов
+const (
+	AccessTokenTTL          = time.Minute * 15    //токен доступа (jwt)
+	OrgRefreshTokenTTL      = time.Hour * 24 * 30 //токен обновления организации
+	EmployeeRefreshTokenTTL = time.Hour * 24 * 7  //токен обновления сотрудника
+)
+
 type AuthJWT struct {
 	secretOrg      []byte
 	secretEmployee []byte
@@ -16,6 +26,7 @@ type AuthJWT struct {
 
 type OrganizationClaims struct {
 	OrganizationID uint  `json:"organization_id"`
+	SessionID      uint  `json:"session_id"` //id сессии входа на сервере (по нему проверяется отзыв токена)
 	CreatedAt      int64 `json:"created_at"`
 	jwt.StandardClaims
 }
@@ -25,6 +36,7 @@ type EmployeeClaims struct {
 	EmployeeID     uint   `json:"employee_id"`
 	OutletID       uint   `json:"outlet_id"`
 	Role           string `json:"role"`
+	SessionID      uint   `json:"session_id"` //id сессии входа на сервере (по нему проверяется отзыв токена)
 	CreatedAt      int64  `json:"created_at"`
 	jwt.StandardClaims
 }
@@ -57,13 +69,14 @@ func reverse(arr []byte) (rev []byte) {
 func (j *AuthJWT) SignInOrganization(claims *OrganizationClaims) (token string, err error) {
 	claims.Issuer = "pos-ninja.ru"
 	claims.CreatedAt = time.Now().UTC().Unix()
+	claims.ExpiresAt = time.Now().Add(AccessTokenTTL).Unix()
 	return jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString(j.secretOrg)
 }
 
 func (j *AuthJWT) SignInEmployee(claims *EmployeeClaims) (token string, err error) {
 	claims.Issuer = "pos-ninja.ru"
 	claims.CreatedAt = time.Now().UTC().Unix()
-	claims.ExpiresAt = time.Now().Unix() + 60*60*24 //токен живет 24 часа
+	claims.ExpiresAt = time.Now().Add(AccessTokenTTL).Unix()
 	return jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString(j.secretEmployee)
 }
 
@@ -96,3 +109,20 @@ func (j *AuthJWT) ParseEmployeeToken(token string) (*EmployeeClaims, error) {
 
 	return nil, errInvalidToken
 }
+
+//NewRefreshToken - случайный токен обновления и его хеш (на сервере хранится только хеш)
+func NewRefreshToken() (token string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token = hex.EncodeToString(b)
+	return token, HashRefreshToken(token), nil
+}
+
+//HashRefreshToken - хеш токена обновления для поиска на сервере
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"testing"
+	"time"
 )
 
 const baseURI = "http://localhost:80/api/v1/"
@@ -84,6 +85,7 @@ func unmarshal(res *http.Response) *BaseAPIResponse {
 
 //tests
 func TestSignIn(t *testing.T) {
+	var refreshToken string
 	t.Run("org auth", func(t *testing.T) {
 		req, err := http.NewRequest("POST", baseURI+"auth/signIn.Org", marshal(map[string]interface{}{
 			"email":    testcfg.Email,
@@ -121,9 +123,218 @@ func TestSignIn(t *testing.T) {
 		data := decode.Data.(map[string]interface{})
 		{
 			tokens.Empl = data["token"].(string)
+			refreshToken = data["refresh_token"].(string)
 			fmt.Println(tokens.Empl)
 		}
 	})
+
+	t.Run("employee refresh", func(t *testing.T) {
+		req, err := http.NewRequest("POST", baseURI+"auth/refresh", marshal(map[string]interface{}{
+			"refresh_token": refreshToken,
+		}))
+		checkErr(err)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		data := decode.Data.(map[string]interface{})
+		{
+			tokens.Empl = data["token"].(string)
+		}
+	})
+}
+
+func TestSignInAttempts(t *testing.T) {
+	fmt.Println("Sign in attempts testing...")
+
+	t.Run("sign in attempts get", func(t *testing.T) {
+		req, err := http.NewRequest("GET", baseURI+"auth/signInAttempts", nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+	})
+}
+
+func TestEmployeePin(t *testing.T) {
+	fmt.Println("Employee pin testing...")
+
+	wrongPin := "999999"
+	if testcfg.Pin == wrongPin {
+		wrongPin = "999998"
+	}
+
+	updatePin := func(body map[string]interface{}) *BaseAPIResponse {
+		req, err := http.NewRequest("PUT", baseURI+"employees/1", marshal(body))
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		return unmarshal(res)
+	}
+
+	t.Run("change own pin without current pin", func(t *testing.T) {
+		decode := updatePin(map[string]interface{}{
+			"password": testcfg.Pin,
+		})
+		if decode.Status {
+			t.Fatal("expected error without `current_password`")
+		}
+	})
+
+	failedAttempts := func() int {
+		req, err := http.NewRequest("GET", baseURI+"auth/signInAttempts?kind=2&employee_id=1", nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		return len(decode.Data.([]interface{}))
+	}
+
+	//неверный текущий пин-код учитывается теми же счетчиками, что и вход сотрудника
+	t.Run("change own pin with wrong current pin", func(t *testing.T) {
+		before := failedAttempts()
+
+		decode := updatePin(map[string]interface{}{
+			"password":         testcfg.Pin,
+			"current_password": wrongPin,
+		})
+		if decode.Status {
+			t.Fatal("expected error on wrong `current_password`")
+		}
+
+		if after := failedAttempts(); after != before+1 {
+			t.Fatalf("expected failed attempt to be recorded, got %d -> %d", before, after)
+		}
+	})
+
+	t.Run("change own pin with current pin", func(t *testing.T) {
+		decode := updatePin(map[string]interface{}{
+			"password":         testcfg.Pin,
+			"current_password": testcfg.Pin,
+		})
+		checkStatus(decode)
+	})
+
+	t.Run("employee auth with hashed pin", func(t *testing.T) {
+		req, err := http.NewRequest("POST", baseURI+"auth/signIn.Employee", marshal(map[string]interface{}{
+			"id":       1,
+			"password": testcfg.Pin,
+		}))
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Org)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		data := decode.Data.(map[string]interface{})
+		{
+			tokens.Empl = data["token"].(string)
+		}
+	})
+
+	t.Run("employee auth with wrong pin", func(t *testing.T) {
+		req, err := http.NewRequest("POST", baseURI+"auth/signIn.Employee", marshal(map[string]interface{}{
+			"id":       1,
+			"password": wrongPin,
+		}))
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Org)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		if decode.Status {
+			t.Fatal("expected error on wrong pin")
+		}
+	})
+}
+
+func TestResetPassword(t *testing.T) {
+	fmt.Println("Reset password testing...")
+
+	t.Run("reset password request unknown email", func(t *testing.T) {
+		req, err := http.NewRequest("POST", baseURI+"auth/resetPassword.Request", marshal(map[string]interface{}{
+			"email": "unknown." + testcfg.Email,
+		}))
+		checkErr(err)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+	})
+
+	//ответ для зарегистрированного email не отличается, даже если письмо не отправилось
+	t.Run("reset password request", func(t *testing.T) {
+		req, err := http.NewRequest("POST", baseURI+"auth/resetPassword.Request", marshal(map[string]interface{}{
+			"email": testcfg.Email,
+		}))
+		checkErr(err)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+	})
+
+	t.Run("reset password confirm incorrect code", func(t *testing.T) {
+		req, err := http.NewRequest("POST", baseURI+"auth/resetPassword.Confirm", marshal(map[string]interface{}{
+			"code":     "incorrect:1:1",
+			"password": testcfg.Password,
+		}))
+		checkErr(err)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		if decode.Status {
+			t.Fatal("expected error on incorrect code")
+		}
+	})
+}
+
+func TestConfirmCode(t *testing.T) {
+	fmt.Println("Confirm code testing...")
+
+	t.Run("confirm code incorrect", func(t *testing.T) {
+		req, err := http.NewRequest("GET", baseURI+"auth/confirmCode?code=incorrect:1:1", nil)
+		checkErr(err)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+		readAll(res)
+
+		if res.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d", http.StatusBadRequest, res.StatusCode)
+		}
+	})
 }
 
 func TestSessionOpen(t *testing.T) {
@@ -201,6 +412,19 @@ func TestProduct(t *testing.T) {
 		checkStatus(decode)
 	})
 
+	t.Run("product cost", func(t *testing.T) {
+		req, err := http.NewRequest("GET", baseURI+"products.Cost", nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+	})
+
 	t.Run("product put", func(t *testing.T) {
 		req, err := http.NewRequest("PUT", baseURI+fmt.Sprintf("%s/%d", "products", idx), marshal(map[string]interface{}{
 			"amount":           2,
@@ -309,16 +533,12 @@ func TestCategories(t *testing.T) {
 	fmt.Println("")
 }
 
-func TestIngredients(t *testing.T) {
-	fmt.Println("Ingredients testing...")
+func TestOrganizationSettings(t *testing.T) {
+	fmt.Println("Organization settings testing...")
 
-	var idx uint
-	t.Run("ingredient create", func(t *testing.T) {
-		req, err := http.NewRequest("POST", baseURI+"ingredients", marshal(map[string]interface{}{
-			"count":          10,
-			"measure_unit":   2,
-			"name":           "string",
-			"purchase_price": 10,
+	t.Run("organization put", func(t *testing.T) {
+		req, err := http.NewRequest("PUT", baseURI+"organization", marshal(map[string]interface{}{
+			"stock_policy": 1,
 		}))
 		checkErr(err)
 
@@ -329,15 +549,37 @@ func TestIngredients(t *testing.T) {
 
 		decode := unmarshal(res)
 		checkStatus(decode)
+	})
 
-		data := decode.Data.(map[string]interface{})
-		{
-			idx = uint(data["id"].(float64))
+	t.Run("organization get", func(t *testing.T) {
+		req, err := http.NewRequest("GET", baseURI+"organization", nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		if policy := decode.Data.(map[string]interface{})["stock_policy"].(float64); policy != 1 {
+			t.Fatalf("expected stock_policy 1, got %v", policy)
 		}
 	})
 
-	t.Run("ingredient get", func(t *testing.T) {
-		req, err := http.NewRequest("GET", baseURI+"ingredients", nil)
+	fmt.Println("")
+}
+
+func TestSuppliers(t *testing.T) {
+	fmt.Println("Suppliers testing...")
+
+	var idx uint
+	t.Run("supplier create", func(t *testing.T) {
+		req, err := http.NewRequest("POST", baseURI+"suppliers", marshal(map[string]interface{}{
+			"name":  "string",
+			"phone": "89999999999",
+		}))
 		checkErr(err)
 
 		req.Header.Set("Authorization", tokens.Empl)
@@ -347,15 +589,15 @@ func TestIngredients(t *testing.T) {
 
 		decode := unmarshal(res)
 		checkStatus(decode)
+
+		data := decode.Data.(map[string]interface{})
+		{
+			idx = uint(data["id"].(float64))
+		}
 	})
 
-	t.Run("ingredient put", func(t *testing.T) {
-		req, err := http.NewRequest("PUT", baseURI+fmt.Sprintf("%s/%d", "ingredients", idx), marshal(map[string]interface{}{
-			"count":          5,
-			"measure_unit":   1,
-			"name":           "string1",
-			"purchase_price": 11,
-		}))
+	t.Run("supplier get", func(t *testing.T) {
+		req, err := http.NewRequest("GET", baseURI+"suppliers", nil)
 		checkErr(err)
 
 		req.Header.Set("Authorization", tokens.Empl)
@@ -367,8 +609,8 @@ func TestIngredients(t *testing.T) {
 		checkStatus(decode)
 	})
 
-	t.Run("ingredient delete", func(t *testing.T) {
-		req, err := http.NewRequest("DELETE", baseURI+fmt.Sprintf("%s/%d", "ingredients", idx), nil)
+	t.Run("supplier delete", func(t *testing.T) {
+		req, err := http.NewRequest("DELETE", baseURI+fmt.Sprintf("%s/%d", "suppliers", idx), nil)
 		checkErr(err)
 
 		req.Header.Set("Authorization", tokens.Empl)
@@ -380,20 +622,19 @@ func TestIngredients(t *testing.T) {
 		checkStatus(decode)
 	})
 
-	fmt.Println(idx)
 	fmt.Println("")
 }
 
-func TestOrderInfo(t *testing.T) {
-	fmt.Println("OrderInfo testing...")
+func TestIngredients(t *testing.T) {
+	fmt.Println("Ingredients testing...")
 
 	var idx uint
-	t.Run("orderInfo create", func(t *testing.T) {
-		req, err := http.NewRequest("POST", baseURI+"orderInfo", marshal(map[string]interface{}{
-			"date":          123456,
-			"employee_name": "string",
-			"pay_type":      1,
-			"session_id":    sessionID,
+	t.Run("ingredient create", func(t *testing.T) {
+		req, err := http.NewRequest("POST", baseURI+"ingredients", marshal(map[string]interface{}{
+			"count":          10,
+			"measure_unit":   2,
+			"name":           "string",
+			"purchase_price": 10,
 		}))
 		checkErr(err)
 
@@ -408,12 +649,11 @@ func TestOrderInfo(t *testing.T) {
 		data := decode.Data.(map[string]interface{})
 		{
 			idx = uint(data["id"].(float64))
-			orderInfoID = idx
 		}
 	})
 
-	t.Run("orderInfo get", func(t *testing.T) {
-		req, err := http.NewRequest("GET", baseURI+"orderInfo", nil)
+	t.Run("ingredient get", func(t *testing.T) {
+		req, err := http.NewRequest("GET", baseURI+"ingredients", nil)
 		checkErr(err)
 
 		req.Header.Set("Authorization", tokens.Empl)
@@ -425,8 +665,12 @@ func TestOrderInfo(t *testing.T) {
 		checkStatus(decode)
 	})
 
-	t.Run("orderInfo delete", func(t *testing.T) {
-		req, err := http.NewRequest("DELETE", baseURI+fmt.Sprintf("%s/%d", "orderInfo", idx), nil)
+	t.Run("ingredient put", func(t *testing.T) {
+		req, err := http.NewRequest("PUT", baseURI+fmt.Sprintf("%s/%d", "ingredients", idx), marshal(map[string]interface{}{
+			"count":          5,
+			"name":           "string1",
+			"purchase_price": 11,
+		}))
 		checkErr(err)
 
 		req.Header.Set("Authorization", tokens.Empl)
@@ -438,8 +682,11 @@ func TestOrderInfo(t *testing.T) {
 		checkStatus(decode)
 	})
 
-	t.Run("orderInfo recovery", func(t *testing.T) {
-		req, err := http.NewRequest("POST", baseURI+fmt.Sprintf("%s/%d", "orderInfo", idx), nil)
+	t.Run("ingredient put stale version", func(t *testing.T) {
+		req, err := http.NewRequest("PUT", baseURI+fmt.Sprintf("%s/%d", "ingredients", idx), marshal(map[string]interface{}{
+			"count":   7,
+			"version": 0,
+		}))
 		checkErr(err)
 
 		req.Header.Set("Authorization", tokens.Empl)
@@ -447,27 +694,13 @@ func TestOrderInfo(t *testing.T) {
 		res, err := http.DefaultClient.Do(req)
 		checkErr(err)
 
-		decode := unmarshal(res)
-		checkStatus(decode)
+		if res.StatusCode != http.StatusConflict {
+			t.Fatalf("expected %d, got %d", http.StatusConflict, res.StatusCode)
+		}
 	})
 
-	fmt.Println(idx)
-	fmt.Println("")
-}
-
-func TestOrderList(t *testing.T) {
-	fmt.Println("OrderList testing...")
-
-	var idx uint
-	t.Run("orderList create", func(t *testing.T) {
-		req, err := http.NewRequest("POST", baseURI+"orderList", marshal(map[string]interface{}{
-			"count":         2,
-			"order_info_id": orderInfoID,
-			"product_id":    2,
-			"product_name":  "string1",
-			"product_price": 100,
-			"session_id":    sessionID,
-		}))
+	t.Run("ingredient movements", func(t *testing.T) {
+		req, err := http.NewRequest("GET", baseURI+fmt.Sprintf("ingredients.Movements?ingredient_id=%d", idx), nil)
 		checkErr(err)
 
 		req.Header.Set("Authorization", tokens.Empl)
@@ -477,10 +710,574 @@ func TestOrderList(t *testing.T) {
 
 		decode := unmarshal(res)
 		checkStatus(decode)
+	})
 
-		data := decode.Data.(map[string]interface{})
-		{
-			idx = uint(data["id"].(float64))
+	t.Run("ingredient units", func(t *testing.T) {
+		req, err := http.NewRequest("GET", baseURI+"ingredients.Units", nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		if n := len(decode.Data.([]interface{})); n != 6 {
+			t.Fatalf("expected 6 units, got %d", n)
+		}
+	})
+
+	t.Run("ingredient prices", func(t *testing.T) {
+		req, err := http.NewRequest("GET", baseURI+fmt.Sprintf("ingredients.Prices?ingredient_id=%d", idx), nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		//начальная цена и ручное изменение
+		if n := len(decode.Data.([]interface{})); n != 2 {
+			t.Fatalf("expected 2 price records, got %d", n)
+		}
+	})
+
+	t.Run("ingredient balance", func(t *testing.T) {
+		req, err := http.NewRequest("GET", baseURI+fmt.Sprintf("ingredients.Balance?ingredient_id=%d", idx), nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		if balance := decode.Data.(map[string]interface{})["balance"].(float64); balance != 5 {
+			t.Fatalf("expected balance 5, got %v", balance)
+		}
+	})
+
+	t.Run("ingredient low stock", func(t *testing.T) {
+		req, err := http.NewRequest("PUT", baseURI+fmt.Sprintf("%s/%d", "ingredients", idx), marshal(map[string]interface{}{
+			"min_count": 6,
+		}))
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+		checkStatus(unmarshal(res))
+
+		req, err = http.NewRequest("GET", baseURI+"ingredients.LowStock", nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err = http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		if len(decode.Data.([]interface{})) == 0 {
+			t.Fatal("expected ingredient below min_count")
+		}
+	})
+
+	//л -> мл: остаток пересчитывается, журнал движения восстанавливает его в новой единице
+	t.Run("ingredient unit change", func(t *testing.T) {
+		req, err := http.NewRequest("PUT", baseURI+fmt.Sprintf("%s/%d", "ingredients", idx), marshal(map[string]interface{}{
+			"measure_unit": 5,
+		}))
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+		checkStatus(unmarshal(res))
+
+		req, err = http.NewRequest("GET", baseURI+fmt.Sprintf("ingredients.Balance?ingredient_id=%d", idx), nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err = http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		if balance := decode.Data.(map[string]interface{})["balance"].(float64); balance != 5000 {
+			t.Fatalf("expected balance 5000, got %v", balance)
+		}
+	})
+
+	//списание в литрах ингредиента, хранимого в мл
+	t.Run("ingredient write off", func(t *testing.T) {
+		b, err := json.Marshal([]map[string]interface{}{
+			{
+				"ingredient_id": idx,
+				"count":         1,
+				"unit":          2,
+			},
+		})
+		checkErr(err)
+
+		req, err := http.NewRequest("POST", baseURI+"ingredients.WriteOff", bytes.NewReader(b))
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+		checkStatus(unmarshal(res))
+
+		req, err = http.NewRequest("GET", baseURI+fmt.Sprintf("ingredients.Balance?ingredient_id=%d", idx), nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err = http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		if balance := decode.Data.(map[string]interface{})["balance"].(float64); balance != 4000 {
+			t.Fatalf("expected balance 4000, got %v", balance)
+		}
+	})
+
+	t.Run("ingredient delete", func(t *testing.T) {
+		req, err := http.NewRequest("DELETE", baseURI+fmt.Sprintf("%s/%d", "ingredients", idx), nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+	})
+
+	fmt.Println(idx)
+	fmt.Println("")
+}
+
+func TestInventory(t *testing.T) {
+	fmt.Println("Inventory testing...")
+
+	//ингредиент 10 кг по 10, продукт списывает 1 кг за штуку
+	var idx, ingredientID, productID uint
+	t.Run("inventory fixture", func(t *testing.T) {
+		req, err := http.NewRequest("POST", baseURI+"ingredients", marshal(map[string]interface{}{
+			"count":          10,
+			"measure_unit":   1,
+			"name":           "inventory",
+			"purchase_price": 10,
+		}))
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+		ingredientID = uint(decode.Data.(map[string]interface{})["id"].(float64))
+
+		req, err = http.NewRequest("POST", baseURI+"products", marshal(map[string]interface{}{
+			"category_id": 3,
+			"name":        "inventory",
+			"price":       10,
+		}))
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err = http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode = unmarshal(res)
+		checkStatus(decode)
+		productID = uint(decode.Data.(map[string]interface{})["id"].(float64))
+
+		req, err = http.NewRequest("POST", baseURI+"pwis", marshal(map[string]interface{}{
+			"count_take_for_sell": 1,
+			"product_id":          productID,
+			"ingredient_id":       ingredientID,
+		}))
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err = http.DefaultClient.Do(req)
+		checkErr(err)
+		checkStatus(unmarshal(res))
+	})
+
+	t.Run("inventory open", func(t *testing.T) {
+		req, err := http.NewRequest("POST", baseURI+"inventoryHistory.Open", marshal(map[string]interface{}{
+			"date": 123456789,
+		}))
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		data := decode.Data.(map[string]interface{})
+		{
+			idx = uint(data["id"].(float64))
+		}
+	})
+
+	submitCount := func(count float64) {
+		req, err := http.NewRequest("POST", baseURI+fmt.Sprintf("inventoryHistory/%d/counts", idx), marshal(map[string]interface{}{
+			"counts": []map[string]interface{}{
+				{
+					"ingredient_id": ingredientID,
+					"count":         count,
+				},
+			},
+		}))
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+		checkStatus(unmarshal(res))
+	}
+
+	//повторный пересчет тем же сотрудником заменяет предыдущий, а не суммируется
+	t.Run("inventory counts", func(t *testing.T) {
+		submitCount(3)
+		submitCount(4)
+	})
+
+	t.Run("inventory variances", func(t *testing.T) {
+		req, err := http.NewRequest("GET", baseURI+fmt.Sprintf("inventoryHistory/%d/variances", idx), nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		for _, item := range decode.Data.([]interface{}) {
+			line := item.(map[string]interface{})
+			if uint(line["ingredient_id"].(float64)) != ingredientID {
+				continue
+			}
+			if counted := line["counted_count"].(float64); counted != 4 {
+				t.Fatalf("expected counted 4, got %v", counted)
+			}
+			if employees := line["employees"].(float64); employees != 1 {
+				t.Fatalf("expected 1 employee, got %v", employees)
+			}
+			return
+		}
+		t.Fatal("counted ingredient is missing from variances")
+	})
+
+	//продажа после пересчета: 2 кг уходят из остатка 10
+	t.Run("inventory sale", func(t *testing.T) {
+		req, err := http.NewRequest("POST", baseURI+"orderInfo.Checkout", marshal(map[string]interface{}{
+			"date":          123456,
+			"employee_name": "string",
+			"pay_type":      0,
+			"session_id":    sessionID,
+			"order_list": []map[string]interface{}{
+				{
+					"count":        2,
+					"product_id":   productID,
+					"product_name": "inventory",
+				},
+			},
+		}))
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+		checkStatus(unmarshal(res))
+	})
+
+	//недостача (10 - 4) * 10 = 60, продажа переносится в остаток: 4 + (8 - 10) = 2
+	t.Run("inventory commit", func(t *testing.T) {
+		req, err := http.NewRequest("POST", baseURI+fmt.Sprintf("inventoryHistory/%d/commit", idx), nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		data := decode.Data.(map[string]interface{})
+		if lines := data["lines"].(float64); lines != 1 {
+			t.Fatalf("expected 1 committed line, got %v", lines)
+		}
+		if lossPrice := data["loss_price"].(float64); lossPrice != 60 {
+			t.Fatalf("expected loss_price 60, got %v", lossPrice)
+		}
+	})
+
+	t.Run("inventory list", func(t *testing.T) {
+		req, err := http.NewRequest("GET", baseURI+fmt.Sprintf("inventoryList?inventory_history_id=%d", idx), nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		lines := decode.Data.([]interface{})
+		if len(lines) != 1 {
+			t.Fatalf("expected 1 line, got %d", len(lines))
+		}
+
+		line := lines[0].(map[string]interface{})
+		if oldCount, newCount := line["old_count"].(float64), line["new_count"].(float64); oldCount != 10 || newCount != 4 {
+			t.Fatalf("expected 10 -> 4, got %v -> %v", oldCount, newCount)
+		}
+		if lossPrice := line["loss_price"].(float64); lossPrice != 60 {
+			t.Fatalf("expected loss_price 60, got %v", lossPrice)
+		}
+	})
+
+	t.Run("inventory ingredient count", func(t *testing.T) {
+		req, err := http.NewRequest("GET", baseURI+"ingredients", nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		for _, item := range decode.Data.([]interface{}) {
+			ingredient := item.(map[string]interface{})
+			if uint(ingredient["id"].(float64)) != ingredientID {
+				continue
+			}
+			if count := ingredient["count"].(float64); count != 2 {
+				t.Fatalf("expected count 2, got %v", count)
+			}
+			return
+		}
+		t.Fatal("ingredient not found")
+	})
+
+	fmt.Println("")
+}
+
+func TestOrderInfo(t *testing.T) {
+	fmt.Println("OrderInfo testing...")
+
+	var idx uint
+	t.Run("orderInfo create", func(t *testing.T) {
+		req, err := http.NewRequest("POST", baseURI+"orderInfo", marshal(map[string]interface{}{
+			"date":          123456,
+			"employee_name": "string",
+			"pay_type":      1,
+			"session_id":    sessionID,
+		}))
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		data := decode.Data.(map[string]interface{})
+		{
+			idx = uint(data["id"].(float64))
+			orderInfoID = idx
+		}
+	})
+
+	t.Run("orderInfo get", func(t *testing.T) {
+		req, err := http.NewRequest("GET", baseURI+"orderInfo", nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+	})
+
+	t.Run("orderInfo get page", func(t *testing.T) {
+		req, err := http.NewRequest("GET", baseURI+"orderInfo?offset=0&limit=1&sort=-date", nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		if res.Header.Get("X-Total-Count") == "" {
+			panic("undefined X-Total-Count header")
+		}
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		if len(decode.Data.([]interface{})) > 1 {
+			panic("limit is ignored")
+		}
+	})
+
+	t.Run("orderInfo delete", func(t *testing.T) {
+		req, err := http.NewRequest("DELETE", baseURI+fmt.Sprintf("%s/%d", "orderInfo", idx), nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+	})
+
+	t.Run("orderInfo recovery", func(t *testing.T) {
+		req, err := http.NewRequest("POST", baseURI+fmt.Sprintf("%s/%d", "orderInfo", idx), nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+	})
+
+	fmt.Println(idx)
+	fmt.Println("")
+}
+
+func TestIdempotency(t *testing.T) {
+	fmt.Println("Idempotency testing...")
+
+	key := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	newRequest := func(payType int) *http.Request {
+		req, err := http.NewRequest("POST", baseURI+"orderInfo", marshal(map[string]interface{}{
+			"date":          123456,
+			"employee_name": "string",
+			"pay_type":      payType,
+			"session_id":    sessionID,
+		}))
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+		req.Header.Set("Idempotency-Key", key)
+		return req
+	}
+
+	var idx float64
+	t.Run("idempotency first request", func(t *testing.T) {
+		res, err := http.DefaultClient.Do(newRequest(1))
+		checkErr(err)
+
+		if res.Header.Get("Idempotent-Replayed") != "" {
+			t.Fatal("first request is marked as replayed")
+		}
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		idx = decode.Data.(map[string]interface{})["id"].(float64)
+	})
+
+	t.Run("idempotency replay", func(t *testing.T) {
+		res, err := http.DefaultClient.Do(newRequest(1))
+		checkErr(err)
+
+		if res.Header.Get("Idempotent-Replayed") != "true" {
+			t.Fatal("expected Idempotent-Replayed header")
+		}
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		if id := decode.Data.(map[string]interface{})["id"].(float64); id != idx {
+			t.Fatalf("expected the stored response with id %v, got %v", idx, id)
+		}
+	})
+
+	t.Run("idempotency another body", func(t *testing.T) {
+		res, err := http.DefaultClient.Do(newRequest(0))
+		checkErr(err)
+		readAll(res)
+
+		if res.StatusCode != http.StatusUnprocessableEntity {
+			t.Fatalf("expected %d, got %d", http.StatusUnprocessableEntity, res.StatusCode)
+		}
+	})
+
+	fmt.Println("")
+}
+
+func TestOrderList(t *testing.T) {
+	fmt.Println("OrderList testing...")
+
+	var idx uint
+	t.Run("orderList create", func(t *testing.T) {
+		req, err := http.NewRequest("POST", baseURI+"orderList", marshal(map[string]interface{}{
+			"count":         2,
+			"order_info_id": orderInfoID,
+			"product_id":    2,
+			"product_name":  "string1",
+			"session_id":    sessionID,
+		}))
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		data := decode.Data.(map[string]interface{})
+		{
+			idx = uint(data["id"].(float64))
 			orderInfoID = idx
 		}
 	})
@@ -502,6 +1299,254 @@ func TestOrderList(t *testing.T) {
 	fmt.Println("")
 }
 
+func TestModifiers(t *testing.T) {
+	fmt.Println("Modifiers testing...")
+
+	var idx uint
+	t.Run("modifier group create", func(t *testing.T) {
+		req, err := http.NewRequest("POST", baseURI+"modifierGroups", marshal(map[string]interface{}{
+			"name":       "string",
+			"max_select": 1,
+			"product_id": 2,
+		}))
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		data := decode.Data.(map[string]interface{})
+		{
+			idx = uint(data["id"].(float64))
+		}
+	})
+
+	t.Run("modifier groups get", func(t *testing.T) {
+		req, err := http.NewRequest("GET", baseURI+"modifierGroups?product_id=2", nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+	})
+
+	t.Run("modifier group delete", func(t *testing.T) {
+		req, err := http.NewRequest("DELETE", baseURI+fmt.Sprintf("%s/%d", "modifierGroups", idx), nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+	})
+}
+
+func TestBundles(t *testing.T) {
+	fmt.Println("Bundles testing...")
+
+	t.Run("bundle components get", func(t *testing.T) {
+		req, err := http.NewRequest("GET", baseURI+"bundleComponents", nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+	})
+
+	t.Run("sales by components", func(t *testing.T) {
+		req, err := http.NewRequest("GET", baseURI+"analytics.Sales?group_by=product&components=true", nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+	})
+}
+
+func TestOrderInfoCheckout(t *testing.T) {
+	fmt.Println("OrderInfo checkout testing...")
+
+	var idx uint
+	t.Run("orderInfo checkout", func(t *testing.T) {
+		req, err := http.NewRequest("POST", baseURI+"orderInfo.Checkout", marshal(map[string]interface{}{
+			"date":          123456,
+			"employee_name": "string",
+			"pay_type":      0,
+			"session_id":    sessionID,
+			"order_list": []map[string]interface{}{
+				{
+					"count":        2,
+					"product_id":   2,
+					"product_name": "string1",
+				},
+			},
+		}))
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		data := decode.Data.(map[string]interface{})
+		{
+			idx = uint(data["id"].(float64))
+		}
+	})
+
+	t.Run("orderInfo payments", func(t *testing.T) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%sorderInfo/%d/payments", baseURI, idx), nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+	})
+
+	fmt.Println(idx)
+	fmt.Println("")
+}
+
+func TestAnalyticsSales(t *testing.T) {
+	fmt.Println("Analytics sales testing...")
+
+	for _, groupBy := range []string{"day", "hour", "product", "category", "employee", "outlet"} {
+		t.Run("analytics sales by "+groupBy, func(t *testing.T) {
+			req, err := http.NewRequest("GET", baseURI+"analytics.Sales?group_by="+groupBy, nil)
+			checkErr(err)
+
+			req.Header.Set("Authorization", tokens.Empl)
+
+			res, err := http.DefaultClient.Do(req)
+			checkErr(err)
+
+			decode := unmarshal(res)
+			checkStatus(decode)
+		})
+	}
+
+	fmt.Println("")
+}
+
+func TestSync(t *testing.T) {
+	fmt.Println("Sync testing...")
+
+	uuid := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	sync := func(events ...map[string]interface{}) []interface{} {
+		req, err := http.NewRequest("POST", baseURI+"sync", marshal(map[string]interface{}{
+			"events": events,
+		}))
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+
+		return decode.Data.([]interface{})
+	}
+
+	event := map[string]interface{}{
+		"uuid": uuid,
+		"type": "cash_change",
+		"date": 123456789,
+		"data": map[string]interface{}{
+			"total":      0,
+			"reason":     "sync test",
+			"session_id": sessionID,
+		},
+	}
+
+	var idx float64
+	t.Run("sync applied", func(t *testing.T) {
+		result := sync(event)[0].(map[string]interface{})
+		if result["status"] != "applied" {
+			t.Fatalf("expected applied, got %v (%v)", result["status"], result["reason"])
+		}
+		idx = result["id"].(float64)
+	})
+
+	t.Run("sync duplicate", func(t *testing.T) {
+		result := sync(event)[0].(map[string]interface{})
+		if result["status"] != "duplicate" {
+			t.Fatalf("expected duplicate, got %v", result["status"])
+		}
+		if result["id"].(float64) != idx {
+			t.Fatalf("expected id %v, got %v", idx, result["id"])
+		}
+	})
+
+	t.Run("sync rejected", func(t *testing.T) {
+		rejected := map[string]interface{}{
+			"uuid": uuid + "-rejected",
+			"type": "cash_change",
+			"date": 123456789,
+			"data": map[string]interface{}{
+				"reason":     "sync test",
+				"session_id": 999999999,
+			},
+		}
+
+		//отклоненное событие не резервирует uuid: повторная передача снова проверяется
+		for i := 0; i < 2; i++ {
+			result := sync(rejected)[0].(map[string]interface{})
+			if result["status"] != "rejected" {
+				t.Fatalf("expected rejected, got %v", result["status"])
+			}
+		}
+	})
+
+	fmt.Println("")
+}
+
+func TestSessionXReport(t *testing.T) {
+	fmt.Println("Session X-report testing...")
+
+	t.Run("session x-report", func(t *testing.T) {
+		req, err := http.NewRequest("GET", baseURI+"sessions.XReport", nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+	})
+
+	fmt.Println("")
+}
+
 func TestSessionClose(t *testing.T) {
 	fmt.Println("Session close testing...")
 
@@ -527,3 +1572,22 @@ func TestSessionClose(t *testing.T) {
 	fmt.Println(sessionID)
 	fmt.Println("")
 }
+
+func TestSessionReport(t *testing.T) {
+	fmt.Println("Session report testing...")
+
+	t.Run("session report", func(t *testing.T) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%ssessions/%d/report", baseURI, sessionID), nil)
+		checkErr(err)
+
+		req.Header.Set("Authorization", tokens.Empl)
+
+		res, err := http.DefaultClient.Do(req)
+		checkErr(err)
+
+		decode := unmarshal(res)
+		checkStatus(decode)
+	})
+
+	fmt.Println("")
+}